@@ -0,0 +1,263 @@
+package apis
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"quenc/models"
+	"quenc/utils"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+)
+
+// AccountDeletionInfo - Each type of content is anonymised or deleted, the code is for two-factor users
+type AccountDeletionInfo struct {
+	Password     string `json:"password" binding:"required"`
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recoveryCode"`
+	Posts        string `json:"posts" binding:"required"`
+	Comments     string `json:"comments" binding:"required"`
+	Messages     string `json:"messages" binding:"required"`
+}
+
+// RequestAccountDeletion - Schedule the deletion of the account after the grace period
+func RequestAccountDeletion(c *gin.Context) {
+	var deletionInfo AccountDeletionInfo
+
+	if err := c.ShouldBindJSON(&deletionInfo); err != nil {
+		errStr := fmt.Sprintf("Cannot bind the given AccountDeletionInfo: %+v", err)
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"err": errStr,
+			"msg": "Cannot bind the given AccountDeletionInfo",
+		})
+		return
+	}
+
+	for _, choice := range []string{deletionInfo.Posts, deletionInfo.Comments, deletionInfo.Messages} {
+		if !models.IsValidDeletionChoice(choice) {
+			errStr := fmt.Sprintf("%q is neither %q nor %q", choice, models.DeletionAnonymise, models.DeletionDelete)
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"err": errStr,
+				"msg": errStr,
+			})
+			return
+		}
+	}
+
+	user := utils.GetUserFromContext(c)
+	if user == nil {
+		return
+	}
+
+	// The password is checked like a login, so a stolen session can't guess it
+	if abortIfLoginBackoff(c, models.LoginAttemptAccountDeletion, user.Email) {
+		return
+	}
+
+	if _, err := models.CheckingTheAuth(user.Email, deletionInfo.Password); err != nil {
+		recordLoginAttempt(c, models.LoginAttemptAccountDeletion, user.Email, &user.ID, false, loginFailWrongPassword)
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"err": "The password is not correct",
+			"msg": "The password is not correct",
+		})
+		return
+	}
+
+	if user.TwoFactorEnabled {
+		ok, err := checkTwoFactorCode(user, deletionInfo.Code, deletionInfo.RecoveryCode)
+
+		if err != nil {
+			errStr := fmt.Sprintf("Cannot check the code: %+v", err)
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+				"err": errStr,
+				"msg": "Cannot check the code",
+			})
+			return
+		}
+
+		if !ok {
+			recordLoginAttempt(c, models.LoginAttemptAccountDeletion, user.Email, &user.ID, false, loginFailTwoFactor)
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"err": "The code is not correct",
+				"msg": "The code is not correct",
+			})
+			return
+		}
+	}
+
+	recordLoginAttempt(c, models.LoginAttemptAccountDeletion, user.Email, &user.ID, true, "")
+
+	now := time.Now()
+
+	deletion := models.AccountDeletion{
+		Posts:       deletionInfo.Posts,
+		Comments:    deletionInfo.Comments,
+		Messages:    deletionInfo.Messages,
+		RequestedAt: now,
+		ScheduledAt: now.Add(models.AccountDeletionGracePeriod),
+	}
+
+	_, err := models.ScheduleAccountDeletion(user.ID, &deletion)
+
+	if err != nil {
+		errStr := fmt.Sprintf("Cannot schedule the deletion: %+v", err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"err": errStr,
+			"msg": "Cannot schedule the deletion",
+		})
+		return
+	}
+
+	if err := models.SendingAccountDeletionEmail(user, deletion.ScheduledAt); err != nil {
+		log.Printf("Cannot send the deletion email to %+v: %+v", user.ID, err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"deletion": deletion,
+	})
+}
+
+// CancelAccountDeletion - Keep the account, logging in during the grace period doesn't cancel it
+func CancelAccountDeletion(c *gin.Context) {
+	user := utils.GetUserFromContext(c)
+	if user == nil {
+		return
+	}
+
+	result, err := models.CancelAccountDeletion(user.ID)
+
+	if err != nil {
+		errStr := fmt.Sprintf("Cannot cancel the deletion: %+v", err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"err": errStr,
+			"msg": "Cannot cancel the deletion",
+		})
+		return
+	}
+
+	if result.ModifiedCount == 0 {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"err": "The account is not going to be deleted",
+			"msg": "The account is not going to be deleted",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"uid": user.ID,
+	})
+}
+
+// ExportUserData - Every personal data of the user, a zip of JSON files unless ?format=json is given
+func ExportUserData(c *gin.Context) {
+	user := utils.GetUserFromContext(c)
+	if user == nil {
+		return
+	}
+
+	export, err := collectUserData(user)
+
+	if err != nil {
+		errStr := fmt.Sprintf("Cannot collect the data: %+v", err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"err": errStr,
+			"msg": "Cannot collect the data",
+		})
+		return
+	}
+
+	if c.Query("format") == "json" {
+		c.JSON(http.StatusOK, export)
+		return
+	}
+
+	filename := fmt.Sprintf("quenc-%s-%s.zip", user.ID.Hex(), time.Now().Format("20060102"))
+	c.Header("Content-Type", "application/zip")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	c.Status(http.StatusOK)
+
+	archive := zip.NewWriter(c.Writer)
+
+	for name, data := range export {
+		w, err := archive.Create(name + ".json")
+		if err != nil {
+			log.Printf("Cannot add %s to the export of %+v: %+v", name, user.ID, err)
+			return
+		}
+
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(data); err != nil {
+			log.Printf("Cannot add %s to the export of %+v: %+v", name, user.ID, err)
+			return
+		}
+	}
+
+	if err := archive.Close(); err != nil {
+		log.Printf("Cannot finish the export of %+v: %+v", user.ID, err)
+	}
+}
+
+// collectUserData - The profile, posts, comments, messages and saved posts of the user
+func collectUserData(user *models.User) (gin.H, error) {
+	posts, err := models.FindPostByAuthor(user.ID, options.Find().SetSort(bson.M{"createdAt": 1}))
+	if err != nil {
+		return nil, err
+	}
+
+	comments, err := models.FindComments(bson.M{"author": user.ID}, options.Find().SetSort(bson.M{"createdAt": 1}))
+	if err != nil {
+		return nil, err
+	}
+
+	messages, err := models.FindMessagesByAuthor(user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	var savedPosts []*models.PostAdding
+	if len(user.SavedPosts) > 0 {
+		savedPosts, err = models.FindPosts(bson.M{"_id": bson.M{"$in": user.SavedPosts}}, options.Find())
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	media, err := models.FindMediaOfOwner(user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, m := range media {
+		m.ResolveURLs()
+	}
+
+	// So the export has [] instead of null
+	if posts == nil {
+		posts = []*models.PostAdding{}
+	}
+	if comments == nil {
+		comments = []*models.CommentAdding{}
+	}
+	if messages == nil {
+		messages = []bson.M{}
+	}
+	if savedPosts == nil {
+		savedPosts = []*models.PostAdding{}
+	}
+
+	return gin.H{
+		"profile":    user,
+		"posts":      posts,
+		"comments":   comments,
+		"messages":   messages,
+		"savedPosts": savedPosts,
+		"media":      media,
+	}, nil
+}
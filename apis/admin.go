@@ -0,0 +1,438 @@
+package apis
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"quenc/models"
+	"quenc/utils"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+)
+
+// UserRolesInfo - The roles replacing the current ones, the categories are only for the category moderator role
+type UserRolesInfo struct {
+	Roles      []string             `json:"roles" binding:"required"`
+	Categories []primitive.ObjectID `json:"categories"`
+}
+
+// recordAdminAction - Add the action to the audit trail before it's done, so no action goes unrecorded
+// nil is returned when the request has been aborted, the record is given to failAdminAction when the action fails
+func recordAdminAction(c *gin.Context, admin *models.User, target primitive.ObjectID, action string, detail gin.H) *models.AdminAction {
+	adminAction := models.AdminAction{
+		Admin:     admin.ID,
+		Target:    &target,
+		Action:    action,
+		Detail:    detail,
+		IP:        c.ClientIP(),
+		CreatedAt: time.Now(),
+	}
+
+	InsertedID, err := models.AddAdminAction(&adminAction)
+
+	if err != nil {
+		errStr := fmt.Sprintf("Cannot record the %s in the audit: %+v", action, err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"err": errStr,
+			"msg": "Cannot record the action in the audit, it has not been done",
+		})
+		return nil
+	}
+
+	adminAction.ID = InsertedID.(primitive.ObjectID)
+
+	return &adminAction
+}
+
+// failAdminAction - Mark the recorded action as not done, after the request has been aborted
+func failAdminAction(adminAction *models.AdminAction) {
+	if _, err := models.MarkAdminActionFailed(adminAction.ID); err != nil {
+		log.Printf("Cannot mark the %s %+v as failed: %+v", adminAction.Action, adminAction.ID, err)
+	}
+}
+
+// findAdminTarget - Find the admin and the user of the :uid, nil is returned when the request has been aborted
+func findAdminTarget(c *gin.Context) (*models.User, *models.User) {
+	admin := utils.GetUserFromContext(c)
+	if admin == nil {
+		return nil, nil
+	}
+
+	uid := c.Param("uid")
+
+	uOID := utils.GetOID(uid, c)
+	if uOID == nil {
+		return nil, nil
+	}
+
+	target, err := models.FindUserByOID(*uOID)
+
+	if err != nil {
+		errStr := fmt.Sprintf("Cannot find the user: %+v", err)
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{
+			"err": errStr,
+			"msg": "Cannot find the user",
+			"uid": uid,
+		})
+		return nil, nil
+	}
+
+	return admin, target
+}
+
+// FindUsersForAdmin - List the users for admin, the latest first
+// Filtering by ?domain=&role=&verified=&banned=&from=&to= (from and to are RFC3339, for the createdAt)
+func FindUsersForAdmin(c *gin.Context) {
+	filter := bson.M{}
+
+	if domain := c.Query("domain"); domain != "" {
+		filter["domain"] = domain
+	}
+
+	if role := c.Query("role"); role != "" {
+		if !models.IsValidRole(role) {
+			errStr := fmt.Sprintf("%q is not a role", role)
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"err": errStr,
+				"msg": errStr,
+			})
+			return
+		}
+		filter["roles"] = role
+	}
+
+	verified, ok := queryBool(c, "verified")
+	if !ok {
+		return
+	}
+	if verified != nil {
+		filter["emailVerified"] = *verified
+	}
+
+	banned, ok := queryBool(c, "banned")
+	if !ok {
+		return
+	}
+	if banned != nil {
+		for k, v := range models.BannedFilter(*banned) {
+			filter[k] = v
+		}
+	}
+
+	if !bindCreatedAtRange(c, filter) {
+		return
+	}
+
+	findOption := options.Find().SetSort(bson.D{{Key: "createdAt", Value: -1}, {Key: "_id", Value: -1}})
+	if err := utils.SetupFindOptions(findOption, c); err != nil {
+		return
+	}
+
+	users, err := models.FindUsersWithOptions(filter, findOption)
+
+	if err != nil {
+		errStr := fmt.Sprintf("Cannot find the users: %+v", err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"err": errStr,
+			"msg": "Cannot find the users",
+		})
+		return
+	}
+
+	total, err := models.CountUsers(filter)
+
+	if err != nil {
+		errStr := fmt.Sprintf("Cannot count the users: %+v", err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"err": errStr,
+			"msg": "Cannot count the users",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"users": users,
+		"total": total,
+	})
+}
+
+// FindUserDetailForAdmin - The user with the counts of its content
+func FindUserDetailForAdmin(c *gin.Context) {
+	_, target := findAdminTarget(c)
+	if target == nil {
+		return
+	}
+
+	counts, err := models.CountUserContent(target)
+
+	if err != nil {
+		errStr := fmt.Sprintf("Cannot count the content of the user: %+v", err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"err": errStr,
+			"msg": "Cannot count the content of the user",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"user":   target,
+		"counts": counts,
+	})
+}
+
+// VerifyUserEmailForAdmin - Verify the email of the user without the verification link
+func VerifyUserEmailForAdmin(c *gin.Context) {
+	admin, target := findAdminTarget(c)
+	if target == nil {
+		return
+	}
+
+	if target.EmailVerified {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"err": "The email has been verified",
+			"msg": "The email has been verified",
+		})
+		return
+	}
+
+	adminAction := recordAdminAction(c, admin, target.ID, models.AdminActionVerifyEmail, gin.H{"email": target.Email})
+
+	if adminAction == nil {
+		return
+	}
+
+	result, err := models.VerifyUserEmailByOID(target.ID)
+
+	if err != nil {
+		failAdminAction(adminAction)
+		errStr := fmt.Sprintf("Cannot verify the email: %+v", err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"err": errStr,
+			"msg": "Cannot verify the email",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"result": result,
+	})
+}
+
+// UpdateUserRoles - Replace the roles of the user, admins can't change their own roles
+func UpdateUserRoles(c *gin.Context) {
+	var rolesInfo UserRolesInfo
+
+	if err := c.ShouldBindJSON(&rolesInfo); err != nil {
+		errStr := fmt.Sprintf("Cannot bind the given UserRolesInfo: %+v", err)
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"err": errStr,
+			"msg": "Cannot bind the given UserRolesInfo",
+		})
+		return
+	}
+
+	admin, target := findAdminTarget(c)
+	if target == nil {
+		return
+	}
+
+	if target.ID == admin.ID {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"err": "Cannot change your own roles",
+			"msg": "Cannot change your own roles",
+		})
+		return
+	}
+
+	roles := []string{}
+	seen := map[string]bool{}
+	for _, role := range rolesInfo.Roles {
+		if !models.IsValidRole(role) {
+			errStr := fmt.Sprintf("%q is not a role", role)
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"err": errStr,
+				"msg": errStr,
+			})
+			return
+		}
+		if !seen[role] {
+			seen[role] = true
+			roles = append(roles, role)
+		}
+	}
+
+	if len(roles) == 0 {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"err": "The user has to have at least one role",
+			"msg": "The user has to have at least one role",
+		})
+		return
+	}
+
+	if seen[models.RoleCategoryModerator] != (len(rolesInfo.Categories) > 0) {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"err": "The categories are required for and only for the category moderator role",
+			"msg": "The categories are required for and only for the category moderator role",
+		})
+		return
+	}
+
+	for _, cOID := range rolesInfo.Categories {
+		if _, err := models.FindPostCategoryByOID(cOID); err != nil {
+			errStr := fmt.Sprintf("Cannot find the category %s: %+v", cOID.Hex(), err)
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"err": errStr,
+				"msg": "Cannot find the category",
+			})
+			return
+		}
+	}
+
+	adminAction := recordAdminAction(c, admin, target.ID, models.AdminActionSetRoles, gin.H{
+		"before":           target.Roles,
+		"after":            roles,
+		"categoriesBefore": target.ModeratedCategories,
+		"categoriesAfter":  rolesInfo.Categories,
+	})
+
+	if adminAction == nil {
+		return
+	}
+
+	// There has to be someone left to manage the roles
+	result, err := models.SetUserRoles(target, roles, rolesInfo.Categories)
+
+	if err != nil {
+		failAdminAction(adminAction)
+	}
+
+	if err == models.ErrLastSuperAdmin {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"err": "Cannot revoke the last super admin",
+			"msg": "Cannot revoke the last super admin",
+		})
+		return
+	}
+
+	if err != nil {
+		errStr := fmt.Sprintf("Cannot update the roles: %+v", err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"err": errStr,
+			"msg": "Cannot update the roles",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"result":     result,
+		"roles":      roles,
+		"categories": rolesInfo.Categories,
+	})
+}
+
+// ForceUserPasswordReset - Refuse the login until the user resets the password with the emailed token
+// Every session and refresh token of the user is revoked
+func ForceUserPasswordReset(c *gin.Context) {
+	admin, target := findAdminTarget(c)
+	if target == nil {
+		return
+	}
+
+	adminAction := recordAdminAction(c, admin, target.ID, models.AdminActionPasswordReset, gin.H{"email": target.Email})
+
+	if adminAction == nil {
+		return
+	}
+
+	_, err := models.RequirePasswordReset(target.ID)
+
+	if err != nil {
+		failAdminAction(adminAction)
+		errStr := fmt.Sprintf("Cannot require the password reset: %+v", err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"err": errStr,
+			"msg": "Cannot require the password reset",
+		})
+		return
+	}
+
+	if _, err := models.RevokeSessionsForUser(target.ID, nil); err != nil {
+		log.Printf("Cannot revoke the sessions of %+v: %+v", target.ID, err)
+	}
+
+	if _, err := models.RevokeRefreshTokensForUser(target.ID); err != nil {
+		log.Printf("Cannot revoke the refresh tokens of %+v: %+v", target.ID, err)
+	}
+
+	sent, err := sendPasswordReset(target)
+
+	if err != nil {
+		errStr := fmt.Sprintf("Cannot create the reset token: %+v", err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"err": errStr,
+			"msg": "Cannot create the reset token",
+		})
+		return
+	}
+
+	if !sent {
+		c.AbortWithStatusJSON(http.StatusBadGateway, gin.H{
+			"err": "Cannot send the reset email to " + target.Email,
+			"msg": "The password reset is required, but the reset email cannot be sent",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"msg": "The reset token has been sent to " + target.Email,
+	})
+}
+
+// FindAdminAudit - Query the audit trail of the admin actions, the latest first
+// Filtering by ?admin=&target=&action=&from=&to= (from and to are RFC3339)
+func FindAdminAudit(c *gin.Context) {
+	filter := bson.M{}
+
+	for _, param := range []string{"admin", "target"} {
+		if id := c.Query(param); id != "" {
+			oid := utils.GetOID(id, c)
+			if oid == nil {
+				return
+			}
+			filter[param] = *oid
+		}
+	}
+
+	if action := c.Query("action"); action != "" {
+		filter["action"] = action
+	}
+
+	if !bindCreatedAtRange(c, filter) {
+		return
+	}
+
+	findOption := options.Find().SetSort(bson.M{"createdAt": -1})
+	if err := utils.SetupFindOptions(findOption, c); err != nil {
+		return
+	}
+
+	actions, err := models.FindAdminActions(filter, findOption)
+
+	if err != nil {
+		errStr := fmt.Sprintf("Cannot find the admin audit: %+v", err)
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"err": errStr,
+			"msg": "Cannot find the admin audit",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"actions": actions,
+	})
+}
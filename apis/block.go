@@ -0,0 +1,162 @@
+package apis
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"quenc/models"
+	"quenc/utils"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+)
+
+// findExcludedAuthors - The authors hidden from the user in the context, nil for the guests
+// false is returned when the request has been aborted
+func findExcludedAuthors(c *gin.Context) ([]primitive.ObjectID, bool) {
+	user := utils.GetOptionalUserFromContext(c)
+	if user == nil {
+		return nil, true
+	}
+
+	excluded, err := models.FindBlockRelatedUsers(user)
+
+	if err != nil {
+		errStr := fmt.Sprintf("Cannot find the blocked users: %+v", err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"err": errStr,
+			"msg": "Cannot find the blocked users",
+		})
+		return nil, false
+	}
+
+	return excluded, true
+}
+
+// BlockUser - Hide the other user everywhere, the friendship, the follows and the pending friend request are removed
+func BlockUser(c *gin.Context) {
+	uid := c.Param("uid")
+
+	uOID := utils.GetOID(uid, c)
+	if uOID == nil {
+		return
+	}
+
+	user := utils.GetUserFromContext(c)
+	if user == nil {
+		return
+	}
+
+	if *uOID == user.ID {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"err": "Cannot block yourself",
+			"msg": "Cannot block yourself",
+		})
+		return
+	}
+
+	if _, err := models.FindUserByOID(*uOID); err != nil {
+		errStr := fmt.Sprintf("Cannot find the user: %+v", err)
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"err": errStr,
+			"uid": uid,
+		})
+		return
+	}
+
+	result, err := models.BlockUser(user.ID, *uOID)
+
+	if err != nil {
+		errStr := fmt.Sprintf("Cannot block the user: %+v", err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"err": errStr,
+			"msg": "Cannot block the user",
+		})
+		return
+	}
+
+	if user.IsFriendOf(*uOID) {
+		if err := models.RemoveFriendship(user.ID, *uOID); err != nil {
+			log.Printf("Cannot remove the friendship of %+v and %+v: %+v", user.ID, *uOID, err)
+		}
+	}
+
+	// Neither of them follows the other anymore
+	if _, err := models.UnfollowAuthor(user.ID, *uOID); err != nil {
+		log.Printf("Cannot unfollow %+v for %+v: %+v", *uOID, user.ID, err)
+	}
+	if _, err := models.UnfollowAuthor(*uOID, user.ID); err != nil {
+		log.Printf("Cannot unfollow %+v for %+v: %+v", user.ID, *uOID, err)
+	}
+
+	if pending, err := models.FindPendingFriendRequestBetween(user.ID, *uOID); err == nil {
+		status := models.FriendRequestDeclined
+		if pending.From == user.ID {
+			status = models.FriendRequestCancelled
+		}
+
+		if _, err := models.RespondToFriendRequest(pending.ID, status); err != nil {
+			log.Printf("Cannot close the friend request %+v: %+v", pending.ID, err)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"result": result,
+		"uid":    uid,
+	})
+}
+
+// UnblockUser - The other user can be seen again, the friendship is not restored
+func UnblockUser(c *gin.Context) {
+	uid := c.Param("uid")
+
+	uOID := utils.GetOID(uid, c)
+	if uOID == nil {
+		return
+	}
+
+	user := utils.GetUserFromContext(c)
+	if user == nil {
+		return
+	}
+
+	result, err := models.UnblockUser(user.ID, *uOID)
+
+	if err != nil {
+		errStr := fmt.Sprintf("Cannot unblock the user: %+v", err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"err": errStr,
+			"msg": "Cannot unblock the user",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"result": result,
+		"uid":    uid,
+	})
+}
+
+// FindBlockedUsers - The users blocked by the user
+func FindBlockedUsers(c *gin.Context) {
+	user := utils.GetUserFromContext(c)
+	if user == nil {
+		return
+	}
+
+	users, err := models.FindBlockedUsers(user)
+
+	if err != nil {
+		errStr := fmt.Sprintf("Cannot find the blocked users: %+v", err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"err": errStr,
+			"msg": "Cannot find the blocked users",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"users": users,
+	})
+}
@@ -2,6 +2,7 @@ package apis
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
@@ -37,6 +38,10 @@ func AddChatRoom(c *gin.Context) {
 		return
 	}
 
+	if !checkMediaID(c, "groupPhotoUrl", chatRoom.GroupPhotoUrl, user.ID) {
+		return
+	}
+
 	InsertedID, err := models.AddChatRoom(&chatRoom)
 
 	if err != nil {
@@ -109,6 +114,14 @@ func AddMessageToChatRoom(c *gin.Context) {
 
 	result, err := models.AddMessageToChatRoom(*rOID, message)
 
+	if err == models.ErrBlockedUser {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+			"err": "Cannot send messages to this user",
+			"msg": "Cannot send messages to this user",
+		})
+		return
+	}
+
 	if err != nil {
 		errStr := fmt.Sprintf("Cannot add this message : %+v", err)
 		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
@@ -167,42 +180,99 @@ func TestAddMessageToChatRoom(c *gin.Context) {
 	})
 }
 
+// UpdateChatRoomInfo - The fields of a group chat room which can be updated by its members
+type UpdateChatRoomInfo struct {
+	GroupName     *string `json:"groupName"`
+	GroupPhotoUrl *string `json:"groupPhotoUrl"` // the ID of a media uploaded by the user
+}
+
 func UpdateChatRoom(c *gin.Context) {
 
 	var err error
 	var result *mongo.UpdateResult
-	var updateFields map[string]interface{}
+	var updateInfo UpdateChatRoomInfo
 	rid := c.Param("rid") // Get the room id
 
-	if err = c.ShouldBind(&updateFields); err != nil {
-		errStr := fmt.Sprintf("Cannot bind the input json: %+v", err)
-		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
-			"err":          errStr,
-			"updateFields": updateFields,
-			"rid":          rid,
-		})
+	raw := readUpdateBody(c)
+	if raw == nil {
 		return
 	}
 
-	delete(updateFields, "_id")
-	delete(updateFields, "createdAt")
-	delete(updateFields, "isGroup")
+	user := utils.GetUserFromContext(c)
+	if user == nil {
+		return
+	}
 
-	// Only Admin and Author can update the Comment
 	rOID := utils.GetOID(rid, c)
 	if rOID == nil {
 		return
 	}
 
+	chatRoom, err := models.FindChatRoomByOID(*rOID)
+
+	if err != nil {
+		errStr := fmt.Sprintf("Cannot find the ChatRoom: %+v", err)
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"err": errStr,
+			"rid": rid,
+		})
+		return
+	}
+
+	// Only the members can update the ChatRoom, and only the group ones have a name and photo
+	isMember := false
+	for _, member := range chatRoom.Members {
+		if member == user.ID {
+			isMember = true
+		}
+	}
+
+	if !isMember {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+			"err": "Only the members can update the ChatRoom",
+			"msg": "Only the members can update the ChatRoom",
+			"rid": rid,
+		})
+		return
+	}
+
+	permitted := []string{}
+	if chatRoom.IsGroup {
+		permitted = []string{"groupName", "groupPhotoUrl"}
+	}
+
+	if !bindUpdate(c, raw, &updateInfo, permitted...) {
+		return
+	}
+
+	updateFields := bson.M{}
+
+	if updateInfo.GroupName != nil {
+		name := strings.TrimSpace(*updateInfo.GroupName)
+		if name == "" {
+			abortInvalidField(c, "groupName", errors.New("the group name can't be empty"))
+			return
+		}
+		updateFields["groupName"] = name
+	}
+
+	if updateInfo.GroupPhotoUrl != nil {
+		if !checkMediaID(c, "groupPhotoUrl", *updateInfo.GroupPhotoUrl, user.ID) {
+			return
+		}
+		updateFields["groupPhotoUrl"] = *updateInfo.GroupPhotoUrl
+	}
+
 	result, err = models.UpdateChatRoomByOID(*rOID, updateFields)
 
 	if err != nil {
 		errStr := fmt.Sprintf("Cannot update the ChatRoom with Given User: %+v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
 			"err":          errStr,
 			"updateFields": updateFields,
 			"rid":          rid,
 		})
+		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
@@ -251,17 +321,25 @@ func FindUserChatRoomDetailWithLastMessages(c *gin.Context) {
 		return
 	}
 
-	chatRooms, err := models.FindChatRoomDetailWithLastMessage(&[]bson.M{
+	page, err := utils.GetPageQueryFromContext(c)
+	if err != nil {
+		return
+	}
+
+	chatRooms, pageInfo, err := models.FindChatRoomDetailWithLastMessage(&[]bson.M{
 		bson.M{
 			"$match": bson.M{
 				"_id": bson.M{"$in": user.ChatRooms},
 			},
 		},
 	},
-		-1,
-		-1,
+		page,
 	)
 
+	if utils.AbortIfInvalidCursor(c, err) {
+		return
+	}
+
 	if err != nil {
 		errStr := fmt.Sprintf("Cannot retreive the chatRooms: %+v", err)
 		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
@@ -271,7 +349,9 @@ func FindUserChatRoomDetailWithLastMessages(c *gin.Context) {
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"chatRooms": chatRooms,
+		"chatRooms":  chatRooms,
+		"nextCursor": pageInfo.NextCursor,
+		"hasMore":    pageInfo.HasMore,
 	})
 }
 
@@ -368,26 +448,30 @@ func SubscribeUserChatRoomDetail(c *gin.Context) {
 		return
 	}
 
-	if stream != nil {
-		defer ws.Close()
+	defer ws.Close()
+
+	ctx, release := trackPresence(ws, user)
+	defer release()
+
+	if stream == nil {
+		// Nothing to watch, the connection only keeps the user online
+		<-ctx.Done()
+		return
 	}
 
-	for {
-		ok := stream.Next(context.TODO())
-		if ok {
-			next := stream.Current
-			// err = ws.WriteJSON(next) // 是否要直接傳送 不用重複encode & decode
+	for stream.Next(ctx) {
+		next := stream.Current
+		// err = ws.WriteJSON(next) // 是否要直接傳送 不用重複encode & decode
 
-			var m map[string]interface{}
+		var m map[string]interface{}
 
-			err := bson.Unmarshal(next, &m)
-			if err != nil {
-				log.Print(err)
-			}
-			err = ws.WriteJSON(m)
-			if err != nil {
-				log.Print(err)
-			}
+		err := bson.Unmarshal(next, &m)
+		if err != nil {
+			log.Print(err)
+		}
+		err = ws.WriteJSON(m)
+		if err != nil {
+			log.Print(err)
 		}
 	}
 }
@@ -405,7 +489,7 @@ func AssignRandomChatRoomForUser(c *gin.Context) {
 		return
 	}
 
-	anotherUser, err := models.FindUsersWithoutRandomChat(user.ID)
+	anotherUser, err := models.FindUsersWithoutRandomChat(user)
 
 	if err != nil {
 		errStr := fmt.Sprintf("Cannot find the user for this chatRoom %+v", err)
@@ -486,26 +570,30 @@ func SubscribeUserRandomChatRoomDetail(c *gin.Context) {
 		return
 	}
 
-	if stream != nil {
-		defer ws.Close()
+	defer ws.Close()
+
+	ctx, release := trackPresence(ws, user)
+	defer release()
+
+	if stream == nil {
+		// Nothing to watch, the connection only keeps the user online
+		<-ctx.Done()
+		return
 	}
 
-	for {
-		ok := stream.Next(context.TODO())
-		if ok {
-			next := stream.Current
-			// err = ws.WriteJSON(next) // 是否要直接傳送 不用重複encode & decode
+	for stream.Next(ctx) {
+		next := stream.Current
+		// err = ws.WriteJSON(next) // 是否要直接傳送 不用重複encode & decode
 
-			var m map[string]interface{}
+		var m map[string]interface{}
 
-			err := bson.Unmarshal(next, &m)
-			if err != nil {
-				log.Print(err)
-			}
-			err = ws.WriteJSON(m)
-			if err != nil {
-				log.Print(err)
-			}
+		err := bson.Unmarshal(next, &m)
+		if err != nil {
+			log.Print(err)
+		}
+		err = ws.WriteJSON(m)
+		if err != nil {
+			log.Print(err)
 		}
 	}
 }
@@ -516,15 +604,14 @@ func FindDetailOfRandomRoom(c *gin.Context) {
 		return
 	}
 
-	chatRooms, err := models.FindChatRoomDetailWithLastMessage(&[]bson.M{
+	chatRooms, _, err := models.FindChatRoomDetailWithLastMessage(&[]bson.M{
 		bson.M{
 			"$match": bson.M{
 				"_id": user.RandomChatRoom,
 			},
 		},
 	},
-		-1,
-		-1,
+		nil,
 	)
 
 	if err != nil {
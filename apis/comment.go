@@ -1,6 +1,7 @@
 package apis
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"quenc/models"
@@ -56,44 +57,58 @@ func AddComment(c *gin.Context) {
 	})
 }
 
+// UpdateCommentInfo - The fields of a comment which can be updated by the moderators
+type UpdateCommentInfo struct {
+	Content *string `json:"content"`
+}
+
 func UpdateComment(c *gin.Context) {
 
 	var err error
 	var result *mongo.UpdateResult
-	var updateFields map[string]interface{}
+	var updateInfo UpdateCommentInfo
 	cid := c.Param("cid")
 
-	if err = c.ShouldBind(&updateFields); err != nil {
-		errStr := fmt.Sprintf("Cannot bind the input json: %+v", err)
-		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
-			"err":          errStr,
-			"updateFields": updateFields,
-			"cid":          cid,
-		})
+	raw := readUpdateBody(c)
+	if raw == nil {
 		return
 	}
 
-	delete(updateFields, "_id")
-	delete(updateFields, "createdAt")
-	delete(updateFields, "author")
-	delete(updateFields, "updatedAt")
-
-	// Only Admin and Author can update the Comment
+	// Only the moderators of the category can update the Comment
 	cOID := utils.GetOID(cid, c)
 	if cOID == nil {
 		return
 	}
 
-	updateFields["updatedAt"] = time.Now()
+	if !abortIfNoPermissionForComment(c, *cOID, models.PermissionCommentUpdateAny) {
+		return
+	}
+
+	if !bindUpdate(c, raw, &updateInfo, "content") {
+		return
+	}
+
+	if strings.TrimSpace(*updateInfo.Content) == "" {
+		abortInvalidField(c, "content", errors.New("the content can't be empty"))
+		return
+	}
+
+	updateFields := bson.M{
+		"content":      *updateInfo.Content,
+		"contentGrams": models.SearchGrams(*updateInfo.Content),
+		"updatedAt":    time.Now(),
+	}
+
 	result, err = models.UpdateCommentByOID(*cOID, updateFields)
 
 	if err != nil {
 		errStr := fmt.Sprintf("Cannot update the Comment with Given User: %+v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
 			"err":          errStr,
 			"updateFields": updateFields,
 			"cid":          cid,
 		})
+		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
@@ -115,7 +130,10 @@ func DeleteComment(c *gin.Context) {
 		})
 	}
 
-	// Only Admin and Author Can delete the Comment
+	// Only the moderators of the category Can delete the Comment
+	if !abortIfNoPermissionForComment(c, pOID, models.PermissionCommentDeleteAny) {
+		return
+	}
 
 	err = models.DeleteCommentByOID(pOID)
 
@@ -132,6 +150,48 @@ func DeleteComment(c *gin.Context) {
 	})
 }
 
+// abortIfNoPermissionForComment - Check the user has the permission in the category of the post of the comment
+// false is returned when the request has been aborted
+func abortIfNoPermissionForComment(c *gin.Context, cOID primitive.ObjectID, permission string) bool {
+	user := utils.GetUserFromContext(c)
+	if user == nil {
+		return false
+	}
+
+	comment, err := models.FindCommentByOID(cOID)
+
+	if err != nil {
+		errStr := fmt.Sprintf("Cannot find the comment: %+v", err)
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"err": errStr,
+			"cid": cOID,
+		})
+		return false
+	}
+
+	post, err := models.FindPostByOID(comment.BelongPost)
+
+	if err != nil {
+		errStr := fmt.Sprintf("Cannot find the post of the comment: %+v", err)
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"err": errStr,
+			"cid": cOID,
+		})
+		return false
+	}
+
+	if !utils.HasPermissionInCategory(c, user, permission, &post.Category) {
+		errStr := fmt.Sprintf("Unauthorised, %s is required for this category", permission)
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+			"err":        errStr,
+			"permission": permission,
+		})
+		return false
+	}
+
+	return true
+}
+
 func FindAllComment(c *gin.Context) {
 
 	findOption := options.Find()
@@ -162,27 +222,32 @@ func FindCommentsByPost(c *gin.Context) {
 		return
 	}
 
-	skip, limit, sort, err := utils.GetSkipLimitSortFromContext(c)
+	page, err := utils.GetPageQueryFromContext(c)
 	if err != nil {
 		return
 	}
 
-	var sortByLikeCount bool
-	if sort != nil {
-		if strings.ToLower(*sort) == "likecount" {
-			sortByLikeCount = true
-		} else {
-			sortByLikeCount = false
-		}
+	sort := models.CommentSortOldest
+	if strings.ToLower(c.Query("sort")) == "likecount" {
+		sort = models.CommentSortLikeCount
 	}
 
-	comments, err := models.FindCommentsWithDetailForPost(
+	excludedAuthors, ok := findExcludedAuthors(c)
+	if !ok {
+		return
+	}
+
+	comments, pageInfo, err := models.FindCommentsWithDetailForPost(
 		*pOID,
-		*skip,
-		*limit,
-		sortByLikeCount,
+		sort,
+		page,
+		excludedAuthors,
 	)
 
+	if utils.AbortIfInvalidCursor(c, err) {
+		return
+	}
+
 	if err != nil {
 		errStr := fmt.Sprintf("Cannot retreive the Comment: %+v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -192,7 +257,9 @@ func FindCommentsByPost(c *gin.Context) {
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"comments": comments,
+		"comments":   comments,
+		"nextCursor": pageInfo.NextCursor,
+		"hasMore":    pageInfo.HasMore,
 	})
 }
 
@@ -247,7 +314,7 @@ func LikeComment(c *gin.Context) {
 	result, err := models.ToggleLikerForComment(*cOID, user.ID, like)
 
 	if err != nil {
-		errStr := fmt.Sprint("Cannnot toggle the post like: %+v", err)
+		errStr := fmt.Sprintf("Cannnot toggle the post like: %+v", err)
 		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
 			"err": errStr,
 		})
@@ -0,0 +1,103 @@
+package apis
+
+import (
+	"fmt"
+	"net/http"
+	"quenc/models"
+	"quenc/utils"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+)
+
+// seenPostsMaxCount - How many posts can be marked as seen at once
+const seenPostsMaxCount = 100
+
+// SeenPostsInfo - The posts the client has shown to the user
+type SeenPostsInfo struct {
+	Posts []primitive.ObjectID `json:"posts" binding:"required"`
+}
+
+// FindHomeFeed - The posts of the followed categories and authors, with the trending ones of the domain of the user
+// The seen and hidden posts are left out, see MarkPostsSeen and /user/hidden-posts
+// The pages go from the newest to the oldest and the posts are ranked within each page, not across the pages:
+// a page never holds a post older than one of the next page, and a better post on the next page stays there
+func FindHomeFeed(c *gin.Context) {
+	user := utils.GetUserFromContext(c)
+	if user == nil {
+		return
+	}
+
+	page, err := utils.GetPageQueryFromContext(c)
+	if err != nil {
+		return
+	}
+
+	excludedAuthors, ok := findExcludedAuthors(c)
+	if !ok {
+		return
+	}
+
+	posts, pageInfo, err := models.FindHomeFeed(user, excludedAuthors, page)
+
+	if utils.AbortIfInvalidCursor(c, err) {
+		return
+	}
+
+	if err != nil {
+		errStr := fmt.Sprintf("Cannot find the home feed: %+v", err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"err": errStr,
+			"msg": "Cannot find the home feed",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"posts":      posts,
+		"nextCursor": pageInfo.NextCursor,
+		"hasMore":    pageInfo.HasMore,
+	})
+}
+
+// MarkPostsSeen - Leave the posts out of the home feed of the user
+func MarkPostsSeen(c *gin.Context) {
+	var seenInfo SeenPostsInfo
+
+	if err := c.ShouldBindJSON(&seenInfo); err != nil {
+		errStr := fmt.Sprintf("Cannot bind the given SeenPostsInfo: %+v", err)
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"err": errStr,
+			"msg": "Cannot bind the given SeenPostsInfo",
+		})
+		return
+	}
+
+	if len(seenInfo.Posts) > seenPostsMaxCount {
+		errStr := fmt.Sprintf("At most %d posts can be marked as seen at once", seenPostsMaxCount)
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"err": errStr,
+			"msg": errStr,
+		})
+		return
+	}
+
+	user := utils.GetUserFromContext(c)
+	if user == nil {
+		return
+	}
+
+	if err := models.MarkPostsSeen(user.ID, seenInfo.Posts); err != nil {
+		errStr := fmt.Sprintf("Cannot mark the posts as seen: %+v", err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"err": errStr,
+			"msg": "Cannot mark the posts as seen",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"posts": seenInfo.Posts,
+	})
+}
@@ -0,0 +1,216 @@
+package apis
+
+import (
+	"fmt"
+	"net/http"
+	"quenc/models"
+	"quenc/utils"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+)
+
+// FollowAuthor - Get the posts of the author in the home feed, only the ones which are not anonymous
+func FollowAuthor(c *gin.Context) {
+	uid := c.Param("uid")
+
+	uOID := utils.GetOID(uid, c)
+	if uOID == nil {
+		return
+	}
+
+	user := utils.GetUserFromContext(c)
+	if user == nil {
+		return
+	}
+
+	if *uOID == user.ID {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"err": "Cannot follow yourself",
+			"msg": "Cannot follow yourself",
+		})
+		return
+	}
+
+	if _, err := models.FindUserByOID(*uOID); err != nil {
+		errStr := fmt.Sprintf("Cannot find the user: %+v", err)
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"err": errStr,
+			"uid": uid,
+		})
+		return
+	}
+
+	blocked, err := models.IsBlockedBetween(user.ID, []primitive.ObjectID{*uOID})
+
+	if err != nil {
+		errStr := fmt.Sprintf("Cannot check the blocked users: %+v", err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"err": errStr,
+			"msg": "Cannot check the blocked users",
+		})
+		return
+	}
+
+	if blocked {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+			"err": models.ErrBlockedUser.Error(),
+			"msg": "Cannot follow the user",
+		})
+		return
+	}
+
+	result, err := models.FollowAuthor(user.ID, *uOID)
+
+	if err != nil {
+		errStr := fmt.Sprintf("Cannot follow the user: %+v", err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"err": errStr,
+			"msg": "Cannot follow the user",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"result": result,
+		"uid":    uid,
+	})
+}
+
+// UnfollowAuthor - The posts of the author are not in the home feed anymore, unless they are trending
+func UnfollowAuthor(c *gin.Context) {
+	uid := c.Param("uid")
+
+	uOID := utils.GetOID(uid, c)
+	if uOID == nil {
+		return
+	}
+
+	user := utils.GetUserFromContext(c)
+	if user == nil {
+		return
+	}
+
+	result, err := models.UnfollowAuthor(user.ID, *uOID)
+
+	if err != nil {
+		errStr := fmt.Sprintf("Cannot unfollow the user: %+v", err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"err": errStr,
+			"msg": "Cannot unfollow the user",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"result": result,
+		"uid":    uid,
+	})
+}
+
+// FollowPostCategory - Get the posts of the category in the home feed
+func FollowPostCategory(c *gin.Context) {
+	cid := c.Param("cid")
+
+	cOID := utils.GetOID(cid, c)
+	if cOID == nil {
+		return
+	}
+
+	user := utils.GetUserFromContext(c)
+	if user == nil {
+		return
+	}
+
+	if _, err := models.FindPostCategoryByOID(*cOID); err != nil {
+		errStr := fmt.Sprintf("Cannot find the category: %+v", err)
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"err": errStr,
+			"cid": cid,
+		})
+		return
+	}
+
+	result, err := models.FollowPostCategory(user.ID, *cOID)
+
+	if err != nil {
+		errStr := fmt.Sprintf("Cannot follow the category: %+v", err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"err": errStr,
+			"msg": "Cannot follow the category",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"result": result,
+		"cid":    cid,
+	})
+}
+
+// UnfollowPostCategory - The posts of the category are not in the home feed anymore, unless they are trending
+func UnfollowPostCategory(c *gin.Context) {
+	cid := c.Param("cid")
+
+	cOID := utils.GetOID(cid, c)
+	if cOID == nil {
+		return
+	}
+
+	user := utils.GetUserFromContext(c)
+	if user == nil {
+		return
+	}
+
+	result, err := models.UnfollowPostCategory(user.ID, *cOID)
+
+	if err != nil {
+		errStr := fmt.Sprintf("Cannot unfollow the category: %+v", err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"err": errStr,
+			"msg": "Cannot unfollow the category",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"result": result,
+		"cid":    cid,
+	})
+}
+
+// FindFollowing - The authors and categories followed by the user
+func FindFollowing(c *gin.Context) {
+	user := utils.GetUserFromContext(c)
+	if user == nil {
+		return
+	}
+
+	users, err := models.FindFollowedAuthors(user)
+
+	if err != nil {
+		errStr := fmt.Sprintf("Cannot find the followed users: %+v", err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"err": errStr,
+			"msg": "Cannot find the followed users",
+		})
+		return
+	}
+
+	categories, err := models.FindFollowedPostCategories(user)
+
+	if err != nil {
+		errStr := fmt.Sprintf("Cannot find the followed categories: %+v", err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"err": errStr,
+			"msg": "Cannot find the followed categories",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"users":      users,
+		"categories": categories,
+	})
+}
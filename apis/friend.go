@@ -0,0 +1,404 @@
+package apis
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"quenc/models"
+	"quenc/utils"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+)
+
+type FriendRequestInfo struct {
+	To primitive.ObjectID `json:"to" binding:"required"`
+}
+
+// SendFriendRequest - Ask the other user to be friends
+func SendFriendRequest(c *gin.Context) {
+	var requestInfo FriendRequestInfo
+
+	if err := c.ShouldBindJSON(&requestInfo); err != nil {
+		errStr := fmt.Sprintf("Cannot bind the given FriendRequestInfo: %+v", err)
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"err": errStr,
+			"msg": "Cannot bind the given FriendRequestInfo",
+		})
+		return
+	}
+
+	user := utils.GetUserFromContext(c)
+	if user == nil {
+		return
+	}
+
+	if requestInfo.To == user.ID {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"err": "Cannot send the friend request to yourself",
+			"msg": "Cannot send the friend request to yourself",
+		})
+		return
+	}
+
+	if user.IsFriendOf(requestInfo.To) {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"err": "You are already friends",
+			"msg": "You are already friends",
+		})
+		return
+	}
+
+	if _, err := models.FindUserByOID(requestInfo.To); err != nil {
+		errStr := fmt.Sprintf("Cannot find the user: %+v", err)
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"err": errStr,
+			"uid": requestInfo.To,
+		})
+		return
+	}
+
+	blocked, err := models.IsBlockedBetween(user.ID, []primitive.ObjectID{requestInfo.To})
+
+	if err != nil {
+		errStr := fmt.Sprintf("Cannot check the blocked users: %+v", err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"err": errStr,
+			"msg": "Cannot check the blocked users",
+		})
+		return
+	}
+
+	if blocked {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+			"err": "Cannot send the friend request to this user",
+			"msg": "Cannot send the friend request to this user",
+		})
+		return
+	}
+
+	request := models.FriendRequest{
+		From:      user.ID,
+		To:        requestInfo.To,
+		Pair:      models.FriendRequestPair(user.ID, requestInfo.To),
+		Status:    models.FriendRequestPending,
+		CreatedAt: time.Now(),
+	}
+
+	InsertedID, err := models.AddFriendRequest(&request)
+
+	if err == models.ErrFriendRequestPending {
+		// The other user may have sent one already, it can be accepted instead
+		pending, _ := models.FindPendingFriendRequestBetween(user.ID, requestInfo.To)
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"err":     "There is already a pending friend request between you",
+			"msg":     "There is already a pending friend request between you",
+			"request": pending,
+		})
+		return
+	}
+
+	if err != nil {
+		errStr := fmt.Sprintf("Cannot add the friend request: %+v", err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"err": errStr,
+			"msg": "Cannot add the friend request",
+		})
+		return
+	}
+
+	request.ID = InsertedID.(primitive.ObjectID)
+
+	c.JSON(http.StatusOK, gin.H{
+		"request": request,
+	})
+}
+
+// findPendingFriendRequestFor - Find the pending request the user is the sender (isSender) or the receiver of
+// nil is returned when the request has been aborted
+func findPendingFriendRequestFor(c *gin.Context, user *models.User, isSender bool) *models.FriendRequest {
+	rOID := utils.GetOID(c.Param("rid"), c)
+	if rOID == nil {
+		return nil
+	}
+
+	request, err := models.FindFriendRequestByOID(*rOID)
+
+	if err != nil {
+		errStr := fmt.Sprintf("Cannot find the friend request: %+v", err)
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"err": errStr,
+			"msg": "Cannot find the friend request",
+		})
+		return nil
+	}
+
+	if (isSender && request.From != user.ID) || (!isSender && request.To != user.ID) {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+			"err": "The friend request is not yours",
+			"msg": "The friend request is not yours",
+		})
+		return nil
+	}
+
+	if request.Status != models.FriendRequestPending {
+		errStr := fmt.Sprintf("The friend request has been %s", request.Status)
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"err": errStr,
+			"msg": errStr,
+		})
+		return nil
+	}
+
+	return request
+}
+
+// respondToFriendRequest - Change the status, false is returned when the request has been aborted
+func respondToFriendRequest(c *gin.Context, request *models.FriendRequest, status string) bool {
+	ok, err := models.RespondToFriendRequest(request.ID, status)
+
+	if err != nil {
+		errStr := fmt.Sprintf("Cannot update the friend request: %+v", err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"err": errStr,
+			"msg": "Cannot update the friend request",
+		})
+		return false
+	}
+
+	if !ok {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"err": "The friend request is no longer pending",
+			"msg": "The friend request is no longer pending",
+		})
+		return false
+	}
+
+	request.Status = status
+	return true
+}
+
+// AcceptFriendRequest - Become friends with the sender, ?createChatRoom=true also starts the 1:1 chat
+// The request is accepted first so only one accept goes through, and it's pending again when the friendship cannot be added
+// The friendship is kept when only the chat room fails, the chat can be started later
+func AcceptFriendRequest(c *gin.Context) {
+	user := utils.GetUserFromContext(c)
+	if user == nil {
+		return
+	}
+
+	request := findPendingFriendRequestFor(c, user, false)
+	if request == nil {
+		return
+	}
+
+	if !respondToFriendRequest(c, request, models.FriendRequestAccepted) {
+		return
+	}
+
+	if err := models.AddFriendship(request.From, request.To); err != nil {
+		if _, err := models.ReopenFriendRequest(request.ID); err != nil {
+			log.Printf("Cannot reopen the friend request %+v: %+v", request.ID, err)
+		}
+
+		errStr := fmt.Sprintf("Cannot add the friendship: %+v", err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"err": errStr,
+			"msg": "Cannot add the friendship",
+		})
+		return
+	}
+
+	if c.Query("createChatRoom") != "true" {
+		c.JSON(http.StatusOK, gin.H{
+			"request": request,
+		})
+		return
+	}
+
+	chatRoom, err := models.FindDirectChatRoom(user.ChatRooms, request.From)
+
+	if err != nil {
+		errStr := fmt.Sprintf("Cannot find the chat room: %+v", err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"err":     errStr,
+			"msg":     "The friend request has been accepted, but the chat room cannot be found",
+			"request": request,
+		})
+		return
+	}
+
+	if chatRoom == nil {
+		chatRoom, err = createDirectChatRoom(request.From, request.To)
+
+		if err != nil {
+			errStr := fmt.Sprintf("Cannot add the chat room: %+v", err)
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+				"err":     errStr,
+				"msg":     "The friend request has been accepted, but the chat room cannot be added",
+				"request": request,
+			})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"request":  request,
+		"chatRoom": chatRoom,
+	})
+}
+
+// createDirectChatRoom - Add the 1:1 chat room and add it to the chat rooms of both users
+func createDirectChatRoom(aOID primitive.ObjectID, bOID primitive.ObjectID) (*models.ChatRoomAdding, error) {
+	// AddChatRoom fails when the larger OID comes first, so the members are in order
+	if aOID.Hex() > bOID.Hex() {
+		aOID, bOID = bOID, aOID
+	}
+
+	chatRoom := models.ChatRoomAdding{
+		Members: []primitive.ObjectID{aOID, bOID},
+		IsGroup: false,
+	}
+
+	InsertedID, err := models.AddChatRoom(&chatRoom)
+
+	if err != nil {
+		return nil, err
+	}
+
+	chatRoom.ID = InsertedID.(primitive.ObjectID)
+
+	for _, uOID := range chatRoom.Members {
+		if _, err := models.ToggleElementToUserArray("chatRooms", true, chatRoom.ID, uOID); err != nil {
+			return nil, err
+		}
+	}
+
+	return &chatRoom, nil
+}
+
+// DeclineFriendRequest - The sender can send another request later
+func DeclineFriendRequest(c *gin.Context) {
+	user := utils.GetUserFromContext(c)
+	if user == nil {
+		return
+	}
+
+	request := findPendingFriendRequestFor(c, user, false)
+	if request == nil {
+		return
+	}
+
+	if !respondToFriendRequest(c, request, models.FriendRequestDeclined) {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"request": request,
+	})
+}
+
+// CancelFriendRequest - The sender takes the request back
+func CancelFriendRequest(c *gin.Context) {
+	user := utils.GetUserFromContext(c)
+	if user == nil {
+		return
+	}
+
+	request := findPendingFriendRequestFor(c, user, true)
+	if request == nil {
+		return
+	}
+
+	if !respondToFriendRequest(c, request, models.FriendRequestCancelled) {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"request": request,
+	})
+}
+
+// Unfriend - Both users are removed from the friends of each other
+func Unfriend(c *gin.Context) {
+	uid := c.Param("uid")
+
+	uOID := utils.GetOID(uid, c)
+	if uOID == nil {
+		return
+	}
+
+	user := utils.GetUserFromContext(c)
+	if user == nil {
+		return
+	}
+
+	if !user.IsFriendOf(*uOID) {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"err": "You are not friends",
+			"msg": "You are not friends",
+		})
+		return
+	}
+
+	if err := models.RemoveFriendship(user.ID, *uOID); err != nil {
+		errStr := fmt.Sprintf("Cannot remove the friendship: %+v", err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"err": errStr,
+			"msg": "Cannot remove the friendship",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"uid": uid,
+	})
+}
+
+// FindFriendRequestsFunc - List the incoming, outgoing or accepted friend requests of the user, the latest first
+func FindFriendRequestsFunc(box string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user := utils.GetUserFromContext(c)
+		if user == nil {
+			return
+		}
+
+		var filter bson.M
+
+		switch box {
+		case "incoming":
+			filter = bson.M{"to": user.ID, "status": models.FriendRequestPending}
+		case "outgoing":
+			filter = bson.M{"from": user.ID, "status": models.FriendRequestPending}
+		default:
+			filter = bson.M{
+				"$or":    bson.A{bson.M{"from": user.ID}, bson.M{"to": user.ID}},
+				"status": models.FriendRequestAccepted,
+			}
+		}
+
+		findOption := options.Find().SetSort(bson.M{"createdAt": -1})
+		if err := utils.SetupFindOptions(findOption, c); err != nil {
+			return
+		}
+
+		requests, err := models.FindFriendRequests(filter, findOption)
+
+		if err != nil {
+			errStr := fmt.Sprintf("Cannot find the friend requests: %+v", err)
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"err": errStr,
+				"msg": "Cannot find the friend requests",
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"requests": requests,
+		})
+	}
+}
@@ -0,0 +1,249 @@
+package apis
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"quenc/models"
+	"quenc/utils"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+)
+
+// Reasons of the failed LoginAttempts, only for the audit
+const (
+	loginFailUnknownEmail  = "unknownEmail"
+	loginFailWrongPassword = "wrongPassword"
+	loginFailLocked        = "locked"
+	loginFailBanned        = "banned"
+	loginFailResetRequired = "resetRequired"
+	signupFailEmailExists  = "emailExists"
+	signupFailDomain       = "unsupportedDomain"
+	signupFailBanned       = "banned"
+)
+
+// normaliseLoginEmail - The email used as the key of the backoff, so "A@qut.edu.au" and "a@qut.edu.au" share it
+func normaliseLoginEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// recordLoginAttempt - Add the attempt to the login audit, failing to record it doesn't fail the request
+func recordLoginAttempt(c *gin.Context, kind string, email string, uOID *primitive.ObjectID, success bool, reason string) {
+	attempt := models.LoginAttempt{
+		Kind:      kind,
+		Email:     normaliseLoginEmail(email),
+		User:      uOID,
+		IP:        c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+		Success:   success,
+		Reason:    reason,
+		CreatedAt: time.Now(),
+	}
+
+	if _, err := models.AddLoginAttempt(&attempt); err != nil {
+		log.Printf("Cannot record the %s attempt of %s: %+v", kind, attempt.Email, err)
+	}
+}
+
+// abortIfLoginBackoff - Abort with 429 when the email or the IP has failed too many times recently
+func abortIfLoginBackoff(c *gin.Context, kind string, email string) bool {
+	wait, err := models.CheckLoginBackoff(kind, normaliseLoginEmail(email), c.ClientIP())
+
+	if err != nil {
+		errStr := fmt.Sprintf("Cannot check the previous attempts: %+v", err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"err": errStr,
+			"msg": "Cannot check the previous attempts",
+		})
+		return true
+	}
+
+	if wait > 0 {
+		retryAfter := int(wait.Seconds()) + 1
+		c.Header("Retry-After", strconv.Itoa(retryAfter))
+		c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{
+			"err":        fmt.Sprintf("Too many attempts, please wait %d seconds", retryAfter),
+			"msg":        "Too many attempts, please try again later",
+			"retryAfter": retryAfter,
+		})
+		return true
+	}
+
+	return false
+}
+
+// handleFailedLogin - Count the failure and lock the account with an unlock email once it reaches the threshold
+func handleFailedLogin(uOID primitive.ObjectID) {
+	user, err := models.RegisterFailedLogin(uOID)
+
+	if err != nil {
+		log.Printf("Cannot count the failed login of %+v: %+v", uOID, err)
+		return
+	}
+
+	if user.FailedLoginCount < models.LoginLockThreshold {
+		return
+	}
+
+	unlockToken, err := utils.GenerateRandomToken(32)
+
+	if err != nil {
+		log.Printf("Cannot generate the unlock token of %+v: %+v", uOID, err)
+		return
+	}
+
+	locked, err := models.LockUserAccount(uOID, utils.HashToken(unlockToken), time.Now().Add(models.LoginLockDuration))
+
+	if err != nil {
+		log.Printf("Cannot lock the account %+v: %+v", uOID, err)
+		return
+	}
+
+	// Another request has locked it and sent the email
+	if !locked {
+		return
+	}
+
+	if err := models.SendingAccountLockedEmail(user, unlockToken); err != nil {
+		log.Printf("Cannot send the account locked email to %+v: %+v", uOID, err)
+	}
+}
+
+// UnlockUserAccount - Unlock the account with the link in the account locked email
+func UnlockUserAccount(c *gin.Context) {
+	token := c.Param("token")
+
+	user, err := models.UnlockUserAccountByToken(utils.HashToken(token))
+
+	if err != nil {
+		c.HTML(http.StatusInternalServerError, "AccountUnlockFail.tmpl", gin.H{
+			"error": err.Error(),
+			"msg":   "無法解鎖此帳號",
+		})
+		return
+	}
+
+	if user == nil {
+		c.HTML(http.StatusBadRequest, "AccountUnlockFail.tmpl", gin.H{
+			"error": "The unlock link is not valid or has been used",
+			"msg":   "此連結無效或已被使用",
+		})
+		return
+	}
+
+	c.HTML(http.StatusOK, "AccountUnlockSuccessful.tmpl", gin.H{
+		"email": user.Email,
+	})
+}
+
+// queryBool - The boolean query parameter, nil when it's not given
+// false is returned when the request has been aborted
+func queryBool(c *gin.Context, param string) (*bool, bool) {
+	str := c.Query(param)
+	if str == "" {
+		return nil, true
+	}
+
+	value, err := strconv.ParseBool(str)
+	if err != nil {
+		errStr := fmt.Sprintf("Cannot convert the given %s: %+v", param, err)
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"err": errStr,
+			"msg": fmt.Sprintf("Cannot convert the given %s", param),
+		})
+		return nil, false
+	}
+
+	return &value, true
+}
+
+// bindCreatedAtRange - Add ?from=&to= (RFC3339) to the filter as the range of createdAt
+// false is returned when the request has been aborted
+func bindCreatedAtRange(c *gin.Context, filter bson.M) bool {
+	createdAt := bson.M{}
+	for param, op := range map[string]string{"from": "$gte", "to": "$lte"} {
+		if timeStr := c.Query(param); timeStr != "" {
+			t, err := time.Parse(time.RFC3339, timeStr)
+			if err != nil {
+				errStr := fmt.Sprintf("Cannot convert the given %s: %+v", param, err)
+				c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+					"err": errStr,
+					"msg": "The time has to be in RFC3339",
+				})
+				return false
+			}
+			createdAt[op] = t
+		}
+	}
+
+	if len(createdAt) > 0 {
+		filter["createdAt"] = createdAt
+	}
+
+	return true
+}
+
+// FindLoginAudit - Query the login audit for admin
+// Filtering by ?email=&ip=&user=&kind=&success=&from=&to= (from and to are RFC3339)
+func FindLoginAudit(c *gin.Context) {
+	filter := bson.M{}
+
+	if email := c.Query("email"); email != "" {
+		filter["email"] = normaliseLoginEmail(email)
+	}
+
+	if ip := c.Query("ip"); ip != "" {
+		filter["ip"] = ip
+	}
+
+	if kind := c.Query("kind"); kind != "" {
+		filter["kind"] = kind
+	}
+
+	if uid := c.Query("user"); uid != "" {
+		uOID := utils.GetOID(uid, c)
+		if uOID == nil {
+			return
+		}
+		filter["user"] = *uOID
+	}
+
+	success, ok := queryBool(c, "success")
+	if !ok {
+		return
+	}
+	if success != nil {
+		filter["success"] = *success
+	}
+
+	if !bindCreatedAtRange(c, filter) {
+		return
+	}
+
+	findOption := options.Find().SetSort(bson.M{"createdAt": -1})
+	if err := utils.SetupFindOptions(findOption, c); err != nil {
+		return
+	}
+
+	attempts, err := models.FindLoginAttempts(filter, findOption)
+
+	if err != nil {
+		errStr := fmt.Sprintf("Cannot find the login audit: %+v", err)
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"err": errStr,
+			"msg": "Cannot find the login audit",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"attempts": attempts,
+	})
+}
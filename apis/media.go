@@ -0,0 +1,296 @@
+package apis
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"quenc/models"
+	"quenc/storage"
+	"quenc/utils"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+)
+
+// storeUploadedImage - Validate the image in the "file" field, then store its variants and the Media
+// The metadata is stripped by decoding and encoding again, nil is returned when the request has been aborted
+func storeUploadedImage(c *gin.Context, user *models.User) *models.Media {
+	// Leaving some room for the rest of the multipart body
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, models.MaxMediaSize+1<<20)
+
+	fileHeader, err := c.FormFile("file")
+
+	if err != nil {
+		errStr := fmt.Sprintf("Cannot read the uploaded file: %+v", err)
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"err": errStr,
+			"msg": "Cannot read the uploaded file",
+		})
+		return nil
+	}
+
+	if fileHeader.Size > models.MaxMediaSize {
+		errStr := fmt.Sprintf("The file can't be larger than %d bytes", models.MaxMediaSize)
+		c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, gin.H{
+			"err": errStr,
+			"msg": errStr,
+		})
+		return nil
+	}
+
+	file, err := fileHeader.Open()
+
+	if err != nil {
+		errStr := fmt.Sprintf("Cannot read the uploaded file: %+v", err)
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"err": errStr,
+			"msg": "Cannot read the uploaded file",
+		})
+		return nil
+	}
+
+	defer file.Close()
+
+	data, err := ioutil.ReadAll(file)
+
+	if err != nil {
+		errStr := fmt.Sprintf("Cannot read the uploaded file: %+v", err)
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"err": errStr,
+			"msg": "Cannot read the uploaded file",
+		})
+		return nil
+	}
+
+	contentType, err := utils.DetectImageType(data)
+
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusUnsupportedMediaType, gin.H{
+			"err": err.Error(),
+			"msg": err.Error(),
+		})
+		return nil
+	}
+
+	// The decoded image and its variants are the large part, so only a few uploads hold them at once
+	release, err := utils.AcquireImageSlot(c.Request.Context())
+
+	if err != nil {
+		errStr := fmt.Sprintf("Cannot wait for the image to be processed: %+v", err)
+		c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{
+			"err": errStr,
+			"msg": "The images are busy, please try again later",
+		})
+		return nil
+	}
+
+	defer release()
+
+	img, err := utils.DecodeImage(data)
+
+	if err != nil {
+		errStr := fmt.Sprintf("Cannot decode the image: %+v", err)
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"err": errStr,
+			"msg": "Cannot decode the image",
+		})
+		return nil
+	}
+
+	media := models.Media{
+		ID:          primitive.NewObjectID(),
+		Owner:       user.ID,
+		ContentType: contentType,
+		Size:        int64(len(data)),
+		Variants:    []models.MediaVariant{},
+		CreatedAt:   time.Now(),
+	}
+
+	// The stored variants are removed again when any step fails
+	removeStored := func() {
+		for _, variant := range media.Variants {
+			if err := storage.Delete(variant.Key); err != nil {
+				log.Printf("Cannot remove %+v from the storage: %+v", variant.Key, err)
+			}
+		}
+	}
+
+	for _, size := range models.MediaVariantSizes {
+		resized := utils.ResizeImage(img, size.MaxSide)
+
+		encoded, encodedType, err := utils.EncodeImage(resized, contentType)
+
+		if err == nil {
+			key := models.MediaKey(media.ID, size.Name, encodedType)
+			err = storage.Put(key, encodedType, encoded)
+
+			media.Variants = append(media.Variants, models.MediaVariant{
+				Name:        size.Name,
+				Key:         key,
+				ContentType: encodedType,
+				Width:       resized.Bounds().Dx(),
+				Height:      resized.Bounds().Dy(),
+				Size:        len(encoded),
+			})
+		}
+
+		if err != nil {
+			removeStored()
+			errStr := fmt.Sprintf("Cannot store the image: %+v", err)
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+				"err": errStr,
+				"msg": "Cannot store the image",
+			})
+			return nil
+		}
+	}
+
+	if _, err := models.AddMedia(&media); err != nil {
+		removeStored()
+		errStr := fmt.Sprintf("Cannot add the media: %+v", err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"err": errStr,
+			"msg": "Cannot add the media",
+		})
+		return nil
+	}
+
+	return media.ResolveURLs()
+}
+
+// checkMediaID - Abort the request when the ID is not of a Media uploaded by the owner
+func checkMediaID(c *gin.Context, field string, id string, owner primitive.ObjectID) bool {
+	err := models.CheckMediaID(id, owner)
+
+	if err == models.ErrMediaNotFound || err == models.ErrMediaNotOwned {
+		abortInvalidField(c, field, err)
+		return false
+	}
+
+	if err != nil {
+		errStr := fmt.Sprintf("Cannot find the media: %+v", err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"err": errStr,
+			"msg": "Cannot find the media",
+		})
+		return false
+	}
+
+	return true
+}
+
+// UploadMedia - Upload an image, its ID can be used as the previewPhoto and groupPhotoUrl
+func UploadMedia(c *gin.Context) {
+	user := utils.GetUserFromContext(c)
+	if user == nil {
+		return
+	}
+
+	media := storeUploadedImage(c, user)
+	if media == nil {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"media": media,
+	})
+}
+
+// UploadUserPhoto - Upload an image and use it as the photo of the user
+func UploadUserPhoto(c *gin.Context) {
+	user := utils.GetUserFromContext(c)
+	if user == nil {
+		return
+	}
+
+	media := storeUploadedImage(c, user)
+	if media == nil {
+		return
+	}
+
+	result, err := models.UpdateUserByOID(user.ID, bson.M{"photoURL": media.ID.Hex()})
+
+	if err != nil {
+		errStr := fmt.Sprintf("Cannot update the photo of the user: %+v", err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"err": errStr,
+			"msg": "Cannot update the photo of the user",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"media":    media,
+		"photoURL": media.ID.Hex(),
+		"result":   result,
+	})
+}
+
+// FindMedia - The Media with the URLs of its variants
+func FindMedia(c *gin.Context) {
+	mid := c.Param("mid")
+
+	mOID := utils.GetOID(mid, c)
+	if mOID == nil {
+		return
+	}
+
+	media, err := models.FindMediaByOID(*mOID)
+
+	if err != nil {
+		errStr := fmt.Sprintf("Cannot find the media: %+v", err)
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{
+			"err": errStr,
+			"msg": "Cannot find the media",
+			"mid": mid,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"media": media.ResolveURLs(),
+	})
+}
+
+// RedirectToMediaVariant - Redirect to the file of the variant, so the clients can show a Media by its ID
+func RedirectToMediaVariant(c *gin.Context) {
+	mid := c.Param("mid")
+	name := c.Param("variant")
+
+	mOID := utils.GetOID(mid, c)
+	if mOID == nil {
+		return
+	}
+
+	media, err := models.FindMediaByOID(*mOID)
+
+	if err != nil {
+		errStr := fmt.Sprintf("Cannot find the media: %+v", err)
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{
+			"err": errStr,
+			"msg": "Cannot find the media",
+			"mid": mid,
+		})
+		return
+	}
+
+	variant := media.Variant(name)
+
+	if variant == nil {
+		errStr := fmt.Sprintf("The media has no %q variant", name)
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{
+			"err": errStr,
+			"msg": errStr,
+			"mid": mid,
+		})
+		return
+	}
+
+	// The files never change, a new upload gets a new ID
+	c.Header("Cache-Control", "public, max-age=86400")
+	c.Redirect(http.StatusFound, storage.URL(variant.Key))
+}
@@ -0,0 +1,292 @@
+package apis
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"quenc/models"
+	"quenc/utils"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+)
+
+type SuspendingInfo struct {
+	Reason        string `json:"reason" binding:"required"`
+	DurationHours int    `json:"durationHours" binding:"required,min=1"`
+}
+
+type ModerationReasonInfo struct {
+	Reason string `json:"reason" binding:"required"`
+}
+
+// findModerationTarget - Find the user to moderate, moderators can't moderate themselves or other staff
+// Only super admins can moderate staff, nil is returned when the request has been aborted
+func findModerationTarget(c *gin.Context, uid string) (*models.User, *models.User) {
+	moderator := utils.GetUserFromContext(c)
+	if moderator == nil {
+		return nil, nil
+	}
+
+	uOID := utils.GetOID(uid, c)
+	if uOID == nil {
+		return nil, nil
+	}
+
+	if *uOID == moderator.ID {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"err": "Cannot moderate yourself",
+			"msg": "Cannot moderate yourself",
+		})
+		return nil, nil
+	}
+
+	target, err := models.FindUserByOID(*uOID)
+
+	if err != nil {
+		errStr := fmt.Sprintf("Cannot find the user: %+v", err)
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"err": errStr,
+			"uid": uid,
+		})
+		return nil, nil
+	}
+
+	if target.IsStaff() && !moderator.IsSuperAdmin() {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+			"err": "Only super admins can moderate the staff",
+			"msg": "Only super admins can moderate the staff",
+		})
+		return nil, nil
+	}
+
+	return moderator, target
+}
+
+// restrictUser - Put the restriction in effect and add it to the moderation history
+func restrictUser(c *gin.Context, moderator *models.User, target *models.User, restrictionType string, reason string, expiresAt *time.Time) {
+	now := time.Now()
+
+	restriction := models.Restriction{
+		Type:      restrictionType,
+		Reason:    reason,
+		Moderator: moderator.ID,
+		ExpiresAt: expiresAt,
+		CreatedAt: now,
+	}
+
+	adminAction := recordAdminAction(c, moderator, target.ID, models.AdminActionOfModeration(restrictionType), gin.H{
+		"reason":    reason,
+		"expiresAt": expiresAt,
+	})
+
+	if adminAction == nil {
+		return
+	}
+
+	_, err := models.SetUserRestriction(target.ID, &restriction)
+
+	if err != nil {
+		failAdminAction(adminAction)
+		errStr := fmt.Sprintf("Cannot restrict the user: %+v", err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"err": errStr,
+			"msg": "Cannot restrict the user",
+		})
+		return
+	}
+
+	action := models.ModerationAction{
+		User:      target.ID,
+		Moderator: moderator.ID,
+		Type:      restrictionType,
+		Reason:    reason,
+		ExpiresAt: expiresAt,
+		CreatedAt: now,
+	}
+
+	InsertedID, err := models.AddModerationAction(&action)
+
+	if err != nil {
+		errStr := fmt.Sprintf("Cannot add the moderation history: %+v", err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"err": errStr,
+			"msg": "Cannot add the moderation history",
+		})
+		return
+	}
+
+	action.ID = InsertedID.(primitive.ObjectID)
+
+	c.JSON(http.StatusOK, gin.H{
+		"restriction": restriction,
+		"action":      action,
+	})
+}
+
+// SuspendUser - The user can only read until the suspension ends
+func SuspendUser(c *gin.Context) {
+	var suspendingInfo SuspendingInfo
+
+	if err := c.ShouldBindJSON(&suspendingInfo); err != nil {
+		errStr := fmt.Sprintf("Cannot bind the given SuspendingInfo: %+v", err)
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"err": errStr,
+			"msg": "Cannot bind the given SuspendingInfo",
+		})
+		return
+	}
+
+	moderator, target := findModerationTarget(c, c.Param("uid"))
+	if target == nil {
+		return
+	}
+
+	if target.IsBanned() {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"err": "The user has been banned, lift the ban first",
+			"msg": "The user has been banned, lift the ban first",
+		})
+		return
+	}
+
+	expiresAt := time.Now().Add(time.Duration(suspendingInfo.DurationHours) * time.Hour)
+
+	restrictUser(c, moderator, target, models.ModerationSuspend, suspendingInfo.Reason, &expiresAt)
+}
+
+// BanUser - The user can't use the service anymore, every session is revoked
+func BanUser(c *gin.Context) {
+	var reasonInfo ModerationReasonInfo
+
+	if err := c.ShouldBindJSON(&reasonInfo); err != nil {
+		errStr := fmt.Sprintf("Cannot bind the given ModerationReasonInfo: %+v", err)
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"err": errStr,
+			"msg": "Cannot bind the given ModerationReasonInfo",
+		})
+		return
+	}
+
+	moderator, target := findModerationTarget(c, c.Param("uid"))
+	if target == nil {
+		return
+	}
+
+	restrictUser(c, moderator, target, models.ModerationBan, reasonInfo.Reason, nil)
+
+	if c.IsAborted() {
+		return
+	}
+
+	if _, err := models.RevokeSessionsForUser(target.ID, nil); err != nil {
+		log.Printf("Cannot revoke the sessions of the banned user %+v: %+v", target.ID, err)
+	}
+}
+
+// LiftRestriction - End the suspension or ban of the user
+func LiftRestriction(c *gin.Context) {
+	var reasonInfo ModerationReasonInfo
+
+	if err := c.ShouldBindJSON(&reasonInfo); err != nil {
+		errStr := fmt.Sprintf("Cannot bind the given ModerationReasonInfo: %+v", err)
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"err": errStr,
+			"msg": "Cannot bind the given ModerationReasonInfo",
+		})
+		return
+	}
+
+	moderator, target := findModerationTarget(c, c.Param("uid"))
+	if target == nil {
+		return
+	}
+
+	if target.Restriction == nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"err": "The user is neither suspended nor banned",
+			"msg": "The user is neither suspended nor banned",
+		})
+		return
+	}
+
+	adminAction := recordAdminAction(c, moderator, target.ID, models.AdminActionLift, gin.H{
+		"reason":      reasonInfo.Reason,
+		"restriction": target.Restriction,
+	})
+
+	if adminAction == nil {
+		return
+	}
+
+	_, err := models.LiftUserRestriction(target.ID)
+
+	if err != nil {
+		failAdminAction(adminAction)
+		errStr := fmt.Sprintf("Cannot lift the restriction: %+v", err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"err": errStr,
+			"msg": "Cannot lift the restriction",
+		})
+		return
+	}
+
+	action := models.ModerationAction{
+		User:      target.ID,
+		Moderator: moderator.ID,
+		Type:      models.ModerationLift,
+		Reason:    reasonInfo.Reason,
+		CreatedAt: time.Now(),
+	}
+
+	InsertedID, err := models.AddModerationAction(&action)
+
+	if err != nil {
+		errStr := fmt.Sprintf("Cannot add the moderation history: %+v", err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"err": errStr,
+			"msg": "Cannot add the moderation history",
+		})
+		return
+	}
+
+	action.ID = InsertedID.(primitive.ObjectID)
+
+	c.JSON(http.StatusOK, gin.H{
+		"action": action,
+	})
+}
+
+// FindModerationHistory - Every suspension, ban and lift of the user, the latest first
+func FindModerationHistory(c *gin.Context) {
+	uid := c.Param("uid")
+
+	uOID := utils.GetOID(uid, c)
+	if uOID == nil {
+		return
+	}
+
+	findOption := options.Find().SetSort(bson.M{"createdAt": -1})
+	if err := utils.SetupFindOptions(findOption, c); err != nil {
+		return
+	}
+
+	actions, err := models.FindModerationActions(bson.M{"user": *uOID}, findOption)
+
+	if err != nil {
+		errStr := fmt.Sprintf("Cannot find the moderation history: %+v", err)
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"err": errStr,
+			"msg": "Cannot find the moderation history",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"actions": actions,
+	})
+}
@@ -2,7 +2,9 @@ package apis
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"log"
 	"net/http"
 	"quenc/database"
 	"quenc/models"
@@ -34,6 +36,11 @@ func AddPost(c *gin.Context) {
 	if user == nil {
 		return
 	}
+
+	if !checkMediaID(c, "previewPhoto", post.PreviewPhoto, user.ID) {
+		return
+	}
+
 	post.Author = user.ID
 	post.CreatedAt = time.Now()
 	post.UpdatedAt = time.Now()
@@ -55,64 +62,173 @@ func AddPost(c *gin.Context) {
 	})
 }
 
+// UpdatePostInfo - The fields of a post which can be updated
+// The moderators can't change the anonymity, it's the choice of the author
+type UpdatePostInfo struct {
+	Title        *string `json:"title"`
+	Content      *string `json:"content"`
+	PreviewText  *string `json:"previewText"`
+	PreviewPhoto *string `json:"previewPhoto"` // the ID of a media uploaded by the author
+	Category     *string `json:"category"`
+	Anonymous    *bool   `json:"anonymous"`
+}
+
+var (
+	postAuthorFields    = []string{"title", "content", "previewText", "previewPhoto", "category", "anonymous"}
+	postModeratorFields = []string{"title", "content", "previewText", "previewPhoto", "category"}
+)
+
 func UpdatePost(c *gin.Context) {
 
 	var err error
 	var result *mongo.UpdateResult
-	var updateFields map[string]interface{}
+	var updateInfo UpdatePostInfo
 	pid := c.Param("pid")
 
-	// Remove some fields so it can be modified
+	raw := readUpdateBody(c)
+	if raw == nil {
+		return
+	}
 
-	// if we have category fields, then convert it to ObjectID
+	user := utils.GetUserFromContext(c)
+	if user == nil {
+		return
+	}
 
-	if err = c.ShouldBind(&updateFields); err != nil {
-		errStr := fmt.Sprintf("Cannot bind the input json: %+v", err)
+	// Only the moderators of the category and the author can update the post
+	pOID := utils.GetOID(pid, c)
+	if pOID == nil {
+		return
+	}
+
+	post, err := models.FindPostByOID(*pOID)
+
+	if err != nil {
+		errStr := fmt.Sprintf("Cannot find the Post: %+v", err)
 		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
-			"err":          errStr,
-			"updateFields": updateFields,
-			"pid":          pid,
+			"err": errStr,
+			"pid": pid,
 		})
 		return
 	}
 
-	if cStr, ok := updateFields["category"]; ok {
+	isAuthor := post.Author == user.ID
+	canModerate := utils.HasPermissionInCategory(c, user, models.PermissionPostUpdateAny, &post.Category)
+
+	permitted := []string{}
+	switch {
+	case isAuthor:
+		permitted = postAuthorFields
+	case canModerate:
+		permitted = postModeratorFields
+	}
+
+	if !bindUpdate(c, raw, &updateInfo, permitted...) {
+		return
+	}
+
+	updateFields := bson.M{}
+
+	if updateInfo.Title != nil {
+		title := strings.TrimSpace(*updateInfo.Title)
+		if title == "" {
+			abortInvalidField(c, "title", errors.New("the title can't be empty"))
+			return
+		}
+		updateFields["title"] = title
+	}
+
+	if updateInfo.Content != nil {
+		if strings.TrimSpace(*updateInfo.Content) == "" {
+			abortInvalidField(c, "content", errors.New("the content can't be empty"))
+			return
+		}
+		updateFields["content"] = *updateInfo.Content
+	}
+
+	if updateInfo.PreviewText != nil {
+		updateFields["previewText"] = *updateInfo.PreviewText
+	}
+
+	if updateInfo.PreviewPhoto != nil {
+		// The photo stays the author's, the moderators can only pick another one of them or remove it
+		if !checkMediaID(c, "previewPhoto", *updateInfo.PreviewPhoto, post.Author) {
+			return
+		}
+		updateFields["previewPhoto"] = *updateInfo.PreviewPhoto
+	}
+
+	if updateInfo.Anonymous != nil {
+		updateFields["anonymous"] = *updateInfo.Anonymous
+	}
 
-		categoryOID, err := primitive.ObjectIDFromHex(cStr.(string))
+	if updateInfo.Category != nil {
+		categoryOID, err := primitive.ObjectIDFromHex(*updateInfo.Category)
+
+		if err == nil {
+			_, err = models.FindPostCategoryByOID(categoryOID)
+		}
 
 		if err != nil {
-			errStr := fmt.Sprintf("Cannot get the category OID: %+v", err)
-			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
-				"err":          errStr,
-				"updateFields": updateFields,
-				"pid":          pid,
-			})
+			abortInvalidField(c, "category", fmt.Errorf("cannot find the category %q", *updateInfo.Category))
 			return
 		}
 
-		updateFields["category"] = categoryOID
+		// The moderators can only move the post to another category they moderate
+		if !isAuthor && !utils.HasPermissionInCategory(c, user, models.PermissionPostUpdateAny, &categoryOID) {
+			abortRejectedFields(c, []RejectedField{{Field: "category", Reason: RejectedForbidden, Detail: "the category is not moderated by the user"}})
+			return
+		}
 
+		updateFields["category"] = categoryOID
 	}
 
-	delete(updateFields, "_id")
-	delete(updateFields, "createdAt")
-	delete(updateFields, "author")
-	delete(updateFields, "updatedAt")
+	// The grams for the search follow the text
+	if updateInfo.Title != nil || updateInfo.Content != nil || updateInfo.PreviewText != nil {
+		searchable := *post
+		if updateInfo.Title != nil {
+			searchable.Title = updateFields["title"].(string)
+		}
+		if updateInfo.Content != nil {
+			searchable.Content = *updateInfo.Content
+		}
+		if updateInfo.PreviewText != nil {
+			searchable.PreviewText = *updateInfo.PreviewText
+		}
+		searchable.SetSearchGrams()
+		updateFields["titleGrams"] = searchable.TitleGrams
+		updateFields["bodyGrams"] = searchable.BodyGrams
+	}
 
-	user := utils.GetUserFromContext(c)
-	if user == nil {
-		return
+	// The edits of the content are kept as revisions, the one before the first edit included
+	revised := false
+	for field, current := range map[string]interface{}{
+		"title":        post.Title,
+		"content":      post.Content,
+		"previewText":  post.PreviewText,
+		"previewPhoto": post.PreviewPhoto,
+		"category":     post.Category,
+	} {
+		if value, ok := updateFields[field]; ok && value != current {
+			revised = true
+		}
 	}
 
-	// Only Admin and Author can update the post
-	pOID := utils.GetOID(pid, c)
-	if pOID == nil {
-		return
+	if revised {
+		if err := models.EnsureBasePostRevision(post); err != nil {
+			errStr := fmt.Sprintf("Cannot keep the revision of the Post: %+v", err)
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+				"err": errStr,
+				"pid": pid,
+			})
+			return
+		}
+		updateFields["edited"] = true
 	}
 
 	updateFields["updatedAt"] = time.Now()
 
-	if user.Role == 0 {
+	if canModerate {
 		result, err = models.UpdatePostByOID(*pOID, updateFields)
 	} else {
 		result, err = database.PostCollection.UpdateOne(context.TODO(),
@@ -123,12 +239,36 @@ func UpdatePost(c *gin.Context) {
 
 	if err != nil {
 		errStr := fmt.Sprintf("Cannot update the Post with Given User: %+v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
 			"err":          errStr,
-			"user":         user,
 			"updateFields": updateFields,
 			"pid":          pid,
 		})
+		return
+	}
+
+	// The revision is the content of this edit, a concurrent one has its own
+	if revised && result.ModifiedCount > 0 {
+		edited := *post
+		if title, ok := updateFields["title"]; ok {
+			edited.Title = title.(string)
+		}
+		if content, ok := updateFields["content"]; ok {
+			edited.Content = content.(string)
+		}
+		if previewText, ok := updateFields["previewText"]; ok {
+			edited.PreviewText = previewText.(string)
+		}
+		if previewPhoto, ok := updateFields["previewPhoto"]; ok {
+			edited.PreviewPhoto = previewPhoto.(string)
+		}
+		if category, ok := updateFields["category"]; ok {
+			edited.Category = category.(primitive.ObjectID)
+		}
+
+		if !addPostRevision(c, &edited, user.ID, updateFields["updatedAt"].(time.Time), 0) {
+			return
+		}
 	}
 
 	c.JSON(http.StatusOK, gin.H{
@@ -154,14 +294,28 @@ func DeletePost(c *gin.Context) {
 		return
 	}
 
-	// Only Admin and Author Can delete the post
+	// Only the moderators of the category and Author Can delete the post
+	post, err := models.FindPostByOID(pOID)
 
-	if user.Role == 0 {
+	if err != nil {
+		errStr := fmt.Sprintf("Cannot find the Post: %+v", err)
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"err": errStr,
+			"pid": pid,
+		})
+		return
+	}
+
+	deleted := true
+
+	if utils.HasPermissionInCategory(c, user, models.PermissionPostDeleteAny, &post.Category) {
 		err = models.DeletePostByOID(pOID)
 	} else {
-		_, err = database.PostCollection.DeleteOne(context.TODO(),
+		var result *mongo.DeleteResult
+		result, err = database.PostCollection.DeleteOne(context.TODO(),
 			bson.M{"_id": pOID, "author": user.ID},
 		)
+		deleted = err == nil && result.DeletedCount > 0
 	}
 
 	if err != nil {
@@ -172,11 +326,47 @@ func DeletePost(c *gin.Context) {
 		})
 	}
 
+	if err == nil && deleted {
+		if err := models.DeletePostRevisions([]primitive.ObjectID{pOID}); err != nil {
+			log.Printf("Cannot delete the revisions of the post %+v: %+v", pOID, err)
+		}
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"pid": pid,
 	})
 }
 
+// postSortFromContext - The sort of ?sort=likecount|hot|top|rising, the latest first when it's not given
+// The posts created before the returned time are left out, it's zero when all of them are listed
+// top ranks the likes within the ?window=day|week|month, the day by default
+func postSortFromContext(c *gin.Context) (models.CursorSort, time.Time, bool) {
+	now := time.Now()
+
+	switch strings.ToLower(c.Query("sort")) {
+	case "likecount":
+		return models.PostSortLikeCount, time.Time{}, true
+	case "hot":
+		return models.PostSortHot, now.Add(-models.PostHotMaxAge), true
+	case "rising":
+		return models.PostSortRising, now.Add(-models.PostRisingMaxAge), true
+	case "top":
+		window := strings.ToLower(c.DefaultQuery("window", "day"))
+		duration, ok := models.PostTopWindows[window]
+		if !ok {
+			errStr := fmt.Sprintf("%q is not a window, it can be day, week or month", window)
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"err": errStr,
+				"msg": errStr,
+			})
+			return models.CursorSort{}, time.Time{}, false
+		}
+		return models.PostSortLikeCount, now.Add(-duration), true
+	}
+
+	return models.PostSortLatest, time.Time{}, true
+}
+
 func FindAllPostWithCategory(c *gin.Context) {
 
 	// findOption := options.Find()
@@ -199,23 +389,27 @@ func FindAllPostWithCategory(c *gin.Context) {
 		}
 	}
 
-	skip, limit, sort, err := utils.GetSkipLimitSortFromContext(c)
+	page, err := utils.GetPageQueryFromContext(c)
 
 	if err != nil {
 		return
 	}
 
-	sortByLikeCount := false
+	sort, since, ok := postSortFromContext(c)
+	if !ok {
+		return
+	}
 
-	if sort != nil {
-		if strings.ToLower(*sort) == "likecount" {
-			sortByLikeCount = true
-		} else {
-			sortByLikeCount = false
-		}
+	excludedAuthors, ok := findExcludedAuthors(c)
+	if !ok {
+		return
 	}
 
-	posts, err := models.FindAllCategoryPostsWithPreview(cOID, *skip, *limit, sortByLikeCount)
+	posts, pageInfo, err := models.FindAllCategoryPostsWithPreview(cOID, since, sort, page, excludedAuthors)
+
+	if utils.AbortIfInvalidCursor(c, err) {
+		return
+	}
 
 	// posts, err := models.FindPosts(bson.M{}, findOption)
 	if err != nil {
@@ -227,7 +421,9 @@ func FindAllPostWithCategory(c *gin.Context) {
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"posts": posts,
+		"posts":      posts,
+		"nextCursor": pageInfo.NextCursor,
+		"hasMore":    pageInfo.HasMore,
 	})
 }
 
@@ -244,6 +440,13 @@ func FindPostById(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"err": errStr,
 		})
+		return
+	}
+
+	if user := utils.GetOptionalUserFromContext(c); user != nil {
+		if err := models.RecordPostView(*pOID, user.ID); err != nil {
+			log.Printf("Cannot record the view of the post %+v: %+v", *pOID, err)
+		}
 	}
 
 	c.JSON(http.StatusOK, gin.H{
@@ -259,22 +462,34 @@ func FindPostByAuthor(c *gin.Context) {
 		return
 	}
 
-	findOption := options.Find()
-	err := utils.SetupFindOptions(findOption, c)
+	page, err := utils.GetPageQueryFromContext(c)
 	if err != nil {
 		return
 	}
 
-	posts, err := models.FindPostsWithPreview(&[]bson.M{bson.M{"$match": bson.M{"author": aOID}}}, -1, -1, false)
+	excludedAuthors, ok := findExcludedAuthors(c)
+	if !ok {
+		return
+	}
+
+	posts, pageInfo, err := models.FindPostsWithPreview(&[]bson.M{bson.M{"$match": bson.M{"author": aOID}}}, models.PostSortLatest, page, excludedAuthors)
+
+	if utils.AbortIfInvalidCursor(c, err) {
+		return
+	}
+
 	if err != nil {
 		errStr := fmt.Sprintf("Cannot retreive the post: %+v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"err": errStr,
 		})
+		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"posts": posts,
+		"posts":      posts,
+		"nextCursor": pageInfo.NextCursor,
+		"hasMore":    pageInfo.HasMore,
 	})
 }
 
@@ -284,8 +499,10 @@ func FindSavedPost(c *gin.Context) {
 		return
 	}
 
-	findOption := options.Find()
-	utils.SetupFindOptions(findOption, c)
+	page, err := utils.GetPageQueryFromContext(c)
+	if err != nil {
+		return
+	}
 
 	// makin the save post to ObjectID
 
@@ -299,10 +516,19 @@ func FindSavedPost(c *gin.Context) {
 	// 	savedOIDs = append(savedOIDs, oid)
 	// }
 
-	posts, err := models.FindPostsWithPreview(&[]bson.M{bson.M{"$match": bson.M{"_id": bson.M{"$in": user.SavedPosts}}}}, -1, -1, false)
+	excludedAuthors, ok := findExcludedAuthors(c)
+	if !ok {
+		return
+	}
+
+	posts, pageInfo, err := models.FindPostsWithPreview(&[]bson.M{bson.M{"$match": bson.M{"_id": bson.M{"$in": user.SavedPosts}}}}, models.PostSortLatest, page, excludedAuthors)
 
 	// posts, err := models.FindPosts(bson.M{"_id": bson.M{"$in": savedOIDs}}, findOption)
 
+	if utils.AbortIfInvalidCursor(c, err) {
+		return
+	}
+
 	if err != nil {
 		errStr := fmt.Sprintf("Cannot find the SavedPosts: %+v", err)
 		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
@@ -312,7 +538,9 @@ func FindSavedPost(c *gin.Context) {
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"posts": posts,
+		"posts":      posts,
+		"nextCursor": pageInfo.NextCursor,
+		"hasMore":    pageInfo.HasMore,
 	})
 }
 
@@ -337,7 +565,12 @@ func FindArrayOfPosts(c *gin.Context) {
 	utils.SetupFindOptions(findOption, c)
 
 	// makin the save post to ObjectID
-	posts, err := models.FindPostsWithPreview(&[]bson.M{bson.M{"_id": bson.M{"$in": postsOID}}}, -1, -1, false)
+	excludedAuthors, ok := findExcludedAuthors(c)
+	if !ok {
+		return
+	}
+
+	posts, _, err := models.FindPostsWithPreview(&[]bson.M{bson.M{"_id": bson.M{"$in": postsOID}}}, models.PostSortLatest, nil, excludedAuthors)
 	// posts, err := models.FindPosts(}, findOption)
 
 	if err != nil {
@@ -379,7 +612,7 @@ func LikePost(c *gin.Context) {
 	result, err := models.ToggleLikerForPost(*pOID, user.ID, like)
 
 	if err != nil {
-		errStr := fmt.Sprint("Cannnot toggle the post like: %+v", err)
+		errStr := fmt.Sprintf("Cannnot toggle the post like: %+v", err)
 		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
 			"err": errStr,
 		})
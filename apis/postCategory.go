@@ -30,7 +30,7 @@ func AddPostCategory(c *gin.Context) {
 	// Only admin can add post category
 
 	// Do this in the Middleware
-	// if !user.IsAmin() {
+	// if !user.HasPermission(models.PermissionCategoryManage) {
 	// 	errStr := fmt.Sprintf("Only Admin can add post category")
 	// 	c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
 	// 		"err": errStr,
@@ -81,7 +81,7 @@ func UpdatePostCategory(c *gin.Context) {
 		return
 	}
 
-	if !user.IsAmin() {
+	if !user.HasPermission(models.PermissionCategoryManage) {
 		errStr := fmt.Sprintf("Only Admin can update post category")
 		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
 			"err": errStr,
@@ -116,7 +116,7 @@ func DeletePostCategoryById(c *gin.Context) {
 		return
 	}
 
-	if !user.IsAmin() {
+	if !user.HasPermission(models.PermissionCategoryManage) {
 		errStr := fmt.Sprintf("Only Admin can delete post category")
 		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
 			"err": errStr,
@@ -0,0 +1,239 @@
+package apis
+
+import (
+	"fmt"
+	"net/http"
+	"quenc/models"
+	"quenc/utils"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+)
+
+// PostRevisionChange - A field other than the content which differs between two revisions
+type PostRevisionChange struct {
+	Field string      `json:"field"`
+	From  interface{} `json:"from"`
+	To    interface{} `json:"to"`
+}
+
+// addPostRevision - Keep the content the post has been updated to as a revision
+// false is returned when the request has been aborted, the post has been updated already so the client can retry the edit
+func addPostRevision(c *gin.Context, revised *models.PostAdding, editor primitive.ObjectID, createdAt time.Time, restoredFrom int) bool {
+	revision := models.NewPostRevision(revised, editor, createdAt)
+	revision.RestoredFrom = restoredFrom
+
+	if _, err := models.AddPostRevision(revision); err != nil {
+		errStr := fmt.Sprintf("Cannot keep the revision of the Post: %+v", err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"err": errStr,
+			"msg": "The Post has been updated, but its revision cannot be kept",
+			"pid": revised.ID.Hex(),
+		})
+		return false
+	}
+
+	return true
+}
+
+// findRevisedPost - Find the post of the :pid, nil is returned when the request has been aborted
+func findRevisedPost(c *gin.Context) *models.PostAdding {
+	pid := c.Param("pid")
+
+	pOID := utils.GetOID(pid, c)
+	if pOID == nil {
+		return nil
+	}
+
+	post, err := models.FindPostByOID(*pOID)
+
+	if err != nil {
+		errStr := fmt.Sprintf("Cannot find the Post: %+v", err)
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{
+			"err": errStr,
+			"msg": "Cannot find the Post",
+			"pid": pid,
+		})
+		return nil
+	}
+
+	return post
+}
+
+// findRevisionOfNumber - Find the revision numbered by the param or query, nil is returned when the request has been aborted
+func findRevisionOfNumber(c *gin.Context, pOID primitive.ObjectID, name string, value string) *models.PostRevision {
+	number, err := strconv.Atoi(value)
+
+	if err != nil || number <= 0 {
+		errStr := fmt.Sprintf("%s has to be the number of a revision", name)
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"err": errStr,
+			"msg": errStr,
+		})
+		return nil
+	}
+
+	revision, err := models.FindPostRevision(pOID, number)
+
+	if err != nil {
+		errStr := fmt.Sprintf("Cannot find the revision %d: %+v", number, err)
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{
+			"err": errStr,
+			"msg": "Cannot find the revision",
+		})
+		return nil
+	}
+
+	return revision
+}
+
+// FindPostRevisions - The revisions of the post, the oldest first
+// The author of an anonymous post is only shown as the editor to the author and the moderators
+func FindPostRevisions(c *gin.Context) {
+	post := findRevisedPost(c)
+	if post == nil {
+		return
+	}
+
+	revisions, err := models.FindPostRevisions(post.ID)
+
+	if err != nil {
+		errStr := fmt.Sprintf("Cannot find the revisions: %+v", err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"err": errStr,
+			"msg": "Cannot find the revisions",
+		})
+		return
+	}
+
+	if post.Anonymous {
+		viewer := utils.GetOptionalUserFromContext(c)
+		revealed := viewer != nil && (viewer.ID == post.Author || utils.HasPermissionInCategory(c, viewer, models.PermissionPostUpdateAny, &post.Category))
+
+		for _, revision := range revisions {
+			if !revealed && revision.Editor != nil && *revision.Editor == post.Author {
+				revision.Editor = nil
+			}
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"revisions": revisions,
+	})
+}
+
+// DiffPostRevisions - The changes from the revision ?from= to the revision ?to=
+// The content is compared line by line, the other fields as a whole
+func DiffPostRevisions(c *gin.Context) {
+	post := findRevisedPost(c)
+	if post == nil {
+		return
+	}
+
+	from := findRevisionOfNumber(c, post.ID, "from", c.Query("from"))
+	if from == nil {
+		return
+	}
+
+	to := findRevisionOfNumber(c, post.ID, "to", c.Query("to"))
+	if to == nil {
+		return
+	}
+
+	changes := []PostRevisionChange{}
+	for _, field := range []PostRevisionChange{
+		{Field: "title", From: from.Title, To: to.Title},
+		{Field: "previewText", From: from.PreviewText, To: to.PreviewText},
+		{Field: "previewPhoto", From: from.PreviewPhoto, To: to.PreviewPhoto},
+		{Field: "category", From: from.Category, To: to.Category},
+	} {
+		if field.From != field.To {
+			changes = append(changes, field)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"from":    from.Number,
+		"to":      to.Number,
+		"changes": changes,
+		"content": utils.DiffLines(from.Content, to.Content),
+	})
+}
+
+// RestorePostRevision - Set the content of the post back to the revision, as a new revision by the admin
+func RestorePostRevision(c *gin.Context) {
+	admin := utils.GetUserFromContext(c)
+	if admin == nil {
+		return
+	}
+
+	post := findRevisedPost(c)
+	if post == nil {
+		return
+	}
+
+	revision := findRevisionOfNumber(c, post.ID, "number", c.Param("number"))
+	if revision == nil {
+		return
+	}
+
+	if _, err := models.FindPostCategoryByOID(revision.Category); err != nil {
+		errStr := fmt.Sprintf("Cannot find the category of the revision: %+v", err)
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"err": errStr,
+			"msg": "The category of the revision has been deleted",
+		})
+		return
+	}
+
+	restored := *post
+	revision.Apply(&restored)
+	restored.SetSearchGrams()
+
+	now := time.Now()
+
+	adminAction := recordAdminAction(c, admin, post.Author, models.AdminActionRestorePost, gin.H{
+		"post":     post.ID,
+		"revision": revision.Number,
+	})
+
+	if adminAction == nil {
+		return
+	}
+
+	result, err := models.UpdatePostByOID(post.ID, bson.M{
+		"title":        restored.Title,
+		"content":      restored.Content,
+		"previewText":  restored.PreviewText,
+		"previewPhoto": restored.PreviewPhoto,
+		"category":     restored.Category,
+		"titleGrams":   restored.TitleGrams,
+		"bodyGrams":    restored.BodyGrams,
+		"edited":       true,
+		"updatedAt":    now,
+	})
+
+	if err != nil {
+		failAdminAction(adminAction)
+		errStr := fmt.Sprintf("Cannot restore the revision: %+v", err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"err": errStr,
+			"msg": "Cannot restore the revision",
+		})
+		return
+	}
+
+	if !addPostRevision(c, &restored, admin.ID, now, revision.Number) {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"result":   result,
+		"pid":      post.ID.Hex(),
+		"revision": revision.Number,
+	})
+}
@@ -0,0 +1,155 @@
+package apis
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"quenc/models"
+	"quenc/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+)
+
+// trackPresence - Keep the user online while the websocket is open
+// The context is done once the client disconnects, the returned function has to be called when the handler returns
+func trackPresence(ws *websocket.Conn, user *models.User) (context.Context, func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	disconnect := models.ConnectPresence(user.ID)
+
+	// The clients don't send anything, reading is only for noticing the close
+	go func() {
+		defer cancel()
+		for {
+			if _, _, err := ws.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+
+	return ctx, func() {
+		cancel()
+		disconnect()
+	}
+}
+
+// FindFriendStatuses - Whether the friends of the user are online, and when they were last seen
+func FindFriendStatuses(c *gin.Context) {
+	user := utils.GetUserFromContext(c)
+	if user == nil {
+		return
+	}
+
+	statuses, err := models.FindFriendStatuses(user)
+
+	if err != nil {
+		errStr := fmt.Sprintf("Cannot find the status of the friends: %+v", err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"err": errStr,
+			"msg": "Cannot find the status of the friends",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"statuses": statuses,
+	})
+}
+
+// SubscribeFriendStatuses - Send the status of every friend, then each change of them
+// The friends are the ones at the time of connecting, the client reconnects to follow the new ones
+func SubscribeFriendStatuses(c *gin.Context) {
+
+	upGrader := websocket.Upgrader{
+		CheckOrigin: func(r *http.Request) bool {
+			return true
+		},
+	}
+
+	user := utils.GetUserFromContext(c)
+	if user == nil {
+		return
+	}
+
+	stream, err := models.WatchFriendPresence(user.Friends)
+
+	if err != nil {
+		errStr := fmt.Sprintf("Cannot get the stream: %+v \n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": errStr,
+		})
+		return
+	}
+
+	defer stream.Close(context.TODO())
+
+	statuses, err := models.FindFriendStatuses(user)
+
+	if err != nil {
+		errStr := fmt.Sprintf("Cannot find the status of the friends: %+v \n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": errStr,
+		})
+		return
+	}
+
+	ws, err := upGrader.Upgrade(c.Writer, c.Request, nil)
+
+	if err != nil {
+		errStr := fmt.Sprintf("The websocket is not working due to the error: %+v \n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": errStr,
+		})
+		return
+	}
+
+	defer ws.Close()
+
+	ctx, release := trackPresence(ws, user)
+	defer release()
+
+	// Only the changes of the online status or its visibility are sent, not every lastSeen write
+	key := func(status *models.FriendStatus) string {
+		if status.Online == nil {
+			return "hidden"
+		}
+		return fmt.Sprint(*status.Online)
+	}
+
+	last := map[primitive.ObjectID]string{}
+	for _, status := range statuses {
+		last[status.ID] = key(status)
+	}
+
+	if err := ws.WriteJSON(gin.H{"statuses": statuses}); err != nil {
+		log.Print(err)
+		return
+	}
+
+	for stream.Next(ctx) {
+		var change struct {
+			FullDocument models.User `bson:"fullDocument"`
+		}
+
+		if err := bson.Unmarshal(stream.Current, &change); err != nil {
+			log.Print(err)
+			break
+		}
+
+		status := change.FullDocument.StatusFor(user)
+
+		if last[status.ID] == key(status) {
+			continue
+		}
+		last[status.ID] = key(status)
+
+		if err := ws.WriteJSON(gin.H{"status": status}); err != nil {
+			log.Print(err)
+			break
+		}
+	}
+}
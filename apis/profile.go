@@ -0,0 +1,123 @@
+package apis
+
+import (
+	"fmt"
+	"net/http"
+	"quenc/models"
+	"quenc/utils"
+
+	"github.com/gin-gonic/gin"
+
+)
+
+// FindUserProfile - The profile of the user as seen by the requester, guests only see the public fields
+// Served under /user/profile/:uid rather than /user/:uid, which the router of Gin 1.5 rejects next to the static /user routes
+func FindUserProfile(c *gin.Context) {
+	uid := c.Param("uid")
+
+	uOID := utils.GetOID(uid, c)
+	if uOID == nil {
+		return
+	}
+
+	target, err := models.FindUserByOID(*uOID)
+
+	notFound := func() {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{
+			"err": "Cannot find the user",
+			"msg": "Cannot find the user",
+			"uid": uid,
+		})
+	}
+
+	if err != nil || target.IsBanned() {
+		notFound()
+		return
+	}
+
+	viewer := utils.GetOptionalUserFromContext(c)
+
+	// The blocked users can't see each other at all
+	if viewer != nil && (viewer.HasBlocked(target.ID) || target.HasBlocked(viewer.ID)) {
+		notFound()
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"profile": target.PublicProfileFor(viewer),
+	})
+}
+
+// FindPrivacySettings - The privacy settings of the user, with the defaults filled in
+func FindPrivacySettings(c *gin.Context) {
+	user := utils.GetUserFromContext(c)
+	if user == nil {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"privacy": user.PrivacySettings(),
+	})
+}
+
+// UpdatePrivacySettings - Only the given fields are changed
+func UpdatePrivacySettings(c *gin.Context) {
+	var privacyInfo models.PrivacySettings
+
+	if err := c.ShouldBindJSON(&privacyInfo); err != nil {
+		errStr := fmt.Sprintf("Cannot bind the given PrivacySettings: %+v", err)
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"err": errStr,
+			"msg": "Cannot bind the given PrivacySettings",
+		})
+		return
+	}
+
+	user := utils.GetUserFromContext(c)
+	if user == nil {
+		return
+	}
+
+	settings := user.PrivacySettings()
+
+	for _, field := range []struct {
+		given   string
+		setting *string
+	}{
+		{privacyInfo.Major, &settings.Major},
+		{privacyInfo.Dob, &settings.Dob},
+		{privacyInfo.Gender, &settings.Gender},
+		{privacyInfo.LastSeen, &settings.LastSeen},
+		{privacyInfo.Friends, &settings.Friends},
+	} {
+		if field.given == "" {
+			continue
+		}
+
+		if !models.IsValidPrivacy(field.given) {
+			errStr := fmt.Sprintf("%q is not one of %q, %q and %q", field.given, models.PrivacyPublic, models.PrivacyFriends, models.PrivacyPrivate)
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"err": errStr,
+				"msg": errStr,
+			})
+			return
+		}
+
+		*field.setting = field.given
+	}
+
+	_, err := models.UpdatePrivacySettings(user.ID, &settings)
+
+	if err != nil {
+		errStr := fmt.Sprintf("Cannot update the privacy settings: %+v", err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"err": errStr,
+			"msg": "Cannot update the privacy settings",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"privacy": settings,
+	})
+}
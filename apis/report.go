@@ -33,6 +33,9 @@ func AddReport(c *gin.Context) {
 		return
 	}
 
+	// Set from the reported content, so the moderators of the category can see the report
+	report.Category = nil
+
 	switch report.ReportTarget {
 	case 0:
 		// find post
@@ -56,6 +59,7 @@ func AddReport(c *gin.Context) {
 		}
 
 		report.ReportObject = retreivedMap
+		report.Category = &post.Category.ID
 
 	case 1:
 		// find comment
@@ -68,6 +72,10 @@ func AddReport(c *gin.Context) {
 			return
 		}
 
+		if post, err := models.FindPostByOID(comment.BelongPost); err == nil {
+			report.Category = &post.Category
+		}
+
 		retreivedMap, err := utils.StructToMap(comment)
 
 		if err != nil {
@@ -126,20 +134,20 @@ func AddReport(c *gin.Context) {
 	})
 }
 
+// UpdateReportInfo - The fields of a report which can be updated by the moderators, the reported content stays as it was
+type UpdateReportInfo struct {
+	Solve *bool `json:"solve"`
+}
+
 func UpdateReport(c *gin.Context) {
 
 	var err error
 	var result *mongo.UpdateResult
-	var updateFields map[string]interface{}
+	var updateInfo UpdateReportInfo
 	rid := c.Param("rid")
 
-	if err = c.ShouldBind(&updateFields); err != nil {
-		errStr := fmt.Sprintf("Cannot bind the input json: %+v", err)
-		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
-			"err":          errStr,
-			"updateFields": updateFields,
-			"pid":          rid,
-		})
+	raw := readUpdateBody(c)
+	if raw == nil {
 		return
 	}
 
@@ -148,26 +156,32 @@ func UpdateReport(c *gin.Context) {
 		return
 	}
 
-	// Only Admin and Author can update the Report
+	// Only the moderators of the category can update the Report
 	rOID := utils.GetOID(rid, c)
 	if rOID == nil {
 		return
 	}
 
-	delete(updateFields, "_id")
-	delete(updateFields, "author")
-	delete(updateFields, "createdAt")
+	if !abortIfNoPermissionForReport(c, *rOID, models.PermissionReportResolve) {
+		return
+	}
+
+	if !bindUpdate(c, raw, &updateInfo, "solve") {
+		return
+	}
+
+	updateFields := bson.M{"solve": *updateInfo.Solve}
 
 	result, err = models.UpdateReportByOID(*rOID, updateFields)
 
 	if err != nil {
 		errStr := fmt.Sprintf("Cannot update the Report with Given User: %+v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
 			"err":          errStr,
-			"user":         user,
 			"updateFields": updateFields,
 			"rid":          rid,
 		})
+		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
@@ -202,6 +216,37 @@ func DeleteReport(c *gin.Context) {
 	})
 }
 
+// abortIfNoPermissionForReport - Check the user has the permission in the category of the report
+// false is returned when the request has been aborted
+func abortIfNoPermissionForReport(c *gin.Context, rOID primitive.ObjectID, permission string) bool {
+	user := utils.GetUserFromContext(c)
+	if user == nil {
+		return false
+	}
+
+	report, err := models.FindReportByOID(rOID)
+
+	if err != nil {
+		errStr := fmt.Sprintf("Cannot find the report: %+v", err)
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"err": errStr,
+			"rid": rOID,
+		})
+		return false
+	}
+
+	if !utils.HasPermissionInCategory(c, user, permission, report.Category) {
+		errStr := fmt.Sprintf("Unauthorised, %s is required for this category", permission)
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+			"err":        errStr,
+			"permission": permission,
+		})
+		return false
+	}
+
+	return true
+}
+
 func FindAllReports(c *gin.Context) {
 	findOption := options.Find()
 	err := utils.SetupFindOptions(findOption, c)
@@ -231,6 +276,10 @@ func FindSingleReport(c *gin.Context) {
 		return
 	}
 
+	if !abortIfNoPermissionForReport(c, *rOID, models.PermissionReportView) {
+		return
+	}
+
 	report, err := models.FindSingleReportWithDetail(*rOID)
 
 	if err != nil {
@@ -254,52 +303,77 @@ func FindSingleReport(c *gin.Context) {
 
 func FindReportsForPreview(c *gin.Context) {
 
-	skip, limit, _, err := utils.GetSkipLimitSortFromContext(c)
+	page, err := utils.GetPageQueryFromContext(c)
 
 	if err != nil {
 		return
 	}
 
-	reports, err := models.FindAllReporstWithPreview(*skip, *limit)
+	reports, pageInfo, err := models.FindAllReporstWithPreview(page)
+
+	if utils.AbortIfInvalidCursor(c, err) {
+		return
+	}
 
 	if err != nil {
-		errStr := fmt.Sprintf("Cannot fetch the reports: %+v", reports)
+		errStr := fmt.Sprintf("Cannot fetch the reports: %+v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"err":   errStr,
-			"limit": limit,
-			"skip":  skip,
+			"limit": page.Limit,
+			"skip":  page.Skip,
 		})
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"reports": reports,
+		"reports":    reports,
+		"nextCursor": pageInfo.NextCursor,
+		"hasMore":    pageInfo.HasMore,
 	})
 
 }
 
 func FindReportsWithDetail(c *gin.Context) {
 
-	skip, limit, _, err := utils.GetSkipLimitSortFromContext(c)
+	page, err := utils.GetPageQueryFromContext(c)
 
 	if err != nil {
 		return
 	}
 
-	reports, err := models.FindAllReporstWithDetail(*skip, *limit)
+	user := utils.GetUserFromContext(c)
+	if user == nil {
+		return
+	}
+
+	// Category moderators only see the reports of their categories
+	var matchingCond *[]bson.M
+	if !utils.HasPermissionInCategory(c, user, models.PermissionReportView, nil) {
+		matchingCond = &[]bson.M{
+			bson.M{"$match": bson.M{"category": bson.M{"$in": user.ModeratedCategories}}},
+		}
+	}
+
+	reports, pageInfo, err := models.FindReportsWithDetail(matchingCond, page)
+
+	if utils.AbortIfInvalidCursor(c, err) {
+		return
+	}
 
 	if err != nil {
-		errStr := fmt.Sprintf("Cannot fetch the reports: %+v", reports)
+		errStr := fmt.Sprintf("Cannot fetch the reports: %+v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"err":   errStr,
-			"limit": limit,
-			"skip":  skip,
+			"limit": page.Limit,
+			"skip":  page.Skip,
 		})
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"reports": reports,
+		"reports":    reports,
+		"nextCursor": pageInfo.NextCursor,
+		"hasMore":    pageInfo.HasMore,
 	})
 
 }
@@ -0,0 +1,190 @@
+package apis
+
+import (
+	"fmt"
+	"net/http"
+	"quenc/models"
+	"quenc/utils"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+)
+
+// RoleInfo - The categories are only for the category moderator role
+type RoleInfo struct {
+	Role       string               `json:"role" binding:"required"`
+	Categories []primitive.ObjectID `json:"categories"`
+}
+
+// FindRoles - Every role with its permissions
+func FindRoles(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"roles": models.RolePermissions,
+	})
+}
+
+// bindRoleInfo - Bind and check the RoleInfo, nil is returned when the request has been aborted
+func bindRoleInfo(c *gin.Context) *RoleInfo {
+	var roleInfo RoleInfo
+
+	if err := c.ShouldBindJSON(&roleInfo); err != nil {
+		errStr := fmt.Sprintf("Cannot bind the given RoleInfo: %+v", err)
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"err": errStr,
+			"msg": "Cannot bind the given RoleInfo",
+		})
+		return nil
+	}
+
+	if !models.IsValidRole(roleInfo.Role) {
+		errStr := fmt.Sprintf("%q is not a role", roleInfo.Role)
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"err": errStr,
+			"msg": errStr,
+		})
+		return nil
+	}
+
+	if roleInfo.Role != models.RoleCategoryModerator && len(roleInfo.Categories) > 0 {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"err": "Only the category moderator role has categories",
+			"msg": "Only the category moderator role has categories",
+		})
+		return nil
+	}
+
+	for _, cOID := range roleInfo.Categories {
+		if _, err := models.FindPostCategoryByOID(cOID); err != nil {
+			errStr := fmt.Sprintf("Cannot find the category %s: %+v", cOID.Hex(), err)
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"err": errStr,
+				"msg": "Cannot find the category",
+			})
+			return nil
+		}
+	}
+
+	return &roleInfo
+}
+
+// GrantRole - Give the role to the user, category moderators need the categories
+func GrantRole(c *gin.Context) {
+	uid := c.Param("uid")
+
+	admin := utils.GetUserFromContext(c)
+	if admin == nil {
+		return
+	}
+
+	roleInfo := bindRoleInfo(c)
+	if roleInfo == nil {
+		return
+	}
+
+	uOID := utils.GetOID(uid, c)
+	if uOID == nil {
+		return
+	}
+
+	if roleInfo.Role == models.RoleCategoryModerator && len(roleInfo.Categories) == 0 {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"err": "The categories are required for the category moderator role",
+			"msg": "The categories are required for the category moderator role",
+		})
+		return
+	}
+
+	adminAction := recordAdminAction(c, admin, *uOID, models.AdminActionGrantRole, gin.H{
+		"role":       roleInfo.Role,
+		"categories": roleInfo.Categories,
+	})
+
+	if adminAction == nil {
+		return
+	}
+
+	result, err := models.GrantRoleToUser(*uOID, roleInfo.Role, roleInfo.Categories)
+
+	if err != nil || result.MatchedCount == 0 {
+		failAdminAction(adminAction)
+	}
+
+	if err != nil {
+		errStr := fmt.Sprintf("Cannot grant the role: %+v", err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"err": errStr,
+			"msg": "Cannot grant the role",
+		})
+		return
+	}
+
+	if result.MatchedCount == 0 {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"err": "Cannot find the user",
+			"msg": "Cannot find the user",
+			"uid": uid,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"result": result,
+		"uid":    uid,
+		"role":   roleInfo,
+	})
+}
+
+// RevokeRole - Remove the role from the user, or only the given categories of a category moderator
+func RevokeRole(c *gin.Context) {
+	uid := c.Param("uid")
+
+	roleInfo := bindRoleInfo(c)
+	if roleInfo == nil {
+		return
+	}
+
+	admin, target := findAdminTarget(c)
+	if target == nil {
+		return
+	}
+
+	adminAction := recordAdminAction(c, admin, target.ID, models.AdminActionRevokeRole, gin.H{
+		"role":       roleInfo.Role,
+		"categories": roleInfo.Categories,
+	})
+
+	if adminAction == nil {
+		return
+	}
+
+	// There has to be someone left to manage the roles
+	result, err := models.RevokeRoleFromUser(target, roleInfo.Role, roleInfo.Categories)
+
+	if err != nil {
+		failAdminAction(adminAction)
+	}
+
+	if err == models.ErrLastSuperAdmin {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"err": "Cannot revoke the last super admin",
+			"msg": "Cannot revoke the last super admin",
+		})
+		return
+	}
+
+	if err != nil {
+		errStr := fmt.Sprintf("Cannot revoke the role: %+v", err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"err": errStr,
+			"msg": "Cannot revoke the role",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"result": result,
+		"uid":    uid,
+		"role":   roleInfo,
+	})
+}
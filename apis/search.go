@@ -0,0 +1,131 @@
+package apis
+
+import (
+	"fmt"
+	"net/http"
+	"quenc/models"
+	"quenc/utils"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+
+)
+
+const (
+	searchDefaultLimit = 20
+	searchMaxLimit     = 50
+)
+
+// searchLimit - The given limit within searchMaxLimit
+func searchLimit(limit int) int {
+	if limit <= 0 {
+		return searchDefaultLimit
+	}
+	if limit > searchMaxLimit {
+		return searchMaxLimit
+	}
+	return limit
+}
+
+// bindSearchFilter - Read ?q=&category=&domain=&from=&to= (from and to are RFC3339)
+// nil is returned when the request has been aborted
+func bindSearchFilter(c *gin.Context) *models.SearchFilter {
+	filter := models.SearchFilter{
+		Query:  c.Query("q"),
+		Domain: strings.TrimSpace(c.Query("domain")),
+	}
+
+	if models.SearchTerms(filter.Query) == "" {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"err": "The query q is required",
+			"msg": "The query q is required",
+		})
+		return nil
+	}
+
+	if cid := c.Query("category"); cid != "" {
+		filter.Category = utils.GetOID(cid, c)
+		if filter.Category == nil {
+			return nil
+		}
+	}
+
+	createdAtFilter := bson.M{}
+	if !bindCreatedAtRange(c, createdAtFilter) {
+		return nil
+	}
+	if createdAt, ok := createdAtFilter["createdAt"].(bson.M); ok {
+		filter.CreatedAt = createdAt
+	}
+
+	return &filter
+}
+
+// SearchPosts - Find the posts by the words in the title, content and previewText, the most relevant and recent first
+// Filtering by ?category=&domain=&from=&to=, paginated with ?skip= and ?limit=
+func SearchPosts(c *gin.Context) {
+	filter := bindSearchFilter(c)
+	if filter == nil {
+		return
+	}
+
+	skip, limit, _, err := utils.GetSkipLimitSortFromContext(c)
+	if err != nil {
+		return
+	}
+
+	excludedAuthors, ok := findExcludedAuthors(c)
+	if !ok {
+		return
+	}
+
+	posts, err := models.SearchPosts(filter, excludedAuthors, *skip, searchLimit(*limit))
+
+	if err != nil {
+		errStr := fmt.Sprintf("Cannot search the posts: %+v", err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"err": errStr,
+			"msg": "Cannot search the posts",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"posts": posts,
+	})
+}
+
+// SearchComments - Find the comments by the words in the content, the most relevant and recent first
+// Filtering by ?category= of the post, ?domain=&from=&to=, paginated with ?skip= and ?limit=
+func SearchComments(c *gin.Context) {
+	filter := bindSearchFilter(c)
+	if filter == nil {
+		return
+	}
+
+	skip, limit, _, err := utils.GetSkipLimitSortFromContext(c)
+	if err != nil {
+		return
+	}
+
+	excludedAuthors, ok := findExcludedAuthors(c)
+	if !ok {
+		return
+	}
+
+	comments, err := models.SearchComments(filter, excludedAuthors, *skip, searchLimit(*limit))
+
+	if err != nil {
+		errStr := fmt.Sprintf("Cannot search the comments: %+v", err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"err": errStr,
+			"msg": "Cannot search the comments",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"comments": comments,
+	})
+}
@@ -0,0 +1,469 @@
+package apis
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"quenc/middlewares"
+	"quenc/models"
+	"quenc/utils"
+
+	"github.com/gin-gonic/gin"
+
+)
+
+type TwoFactorCodeInfo struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// TwoFactorLoginInfo - Either the TOTP code or one of the recovery codes
+type TwoFactorLoginInfo struct {
+	ChallengeToken string `json:"challengeToken" binding:"required"`
+	Code           string `json:"code"`
+	RecoveryCode   string `json:"recoveryCode"`
+}
+
+// Reason of the failed LoginAttempts of the second step, only for the audit
+const loginFailTwoFactor = "wrongTwoFactorCode"
+
+// checkTwoFactorCode - Check the TOTP code or the recovery code of the User, both can only be used once
+func checkTwoFactorCode(user *models.User, code string, recoveryCode string) (bool, error) {
+	if code != "" {
+		counter, ok := utils.ValidateTwoFactorCode(user, code)
+
+		if !ok {
+			return false, nil
+		}
+
+		return models.UseTwoFactorCounter(user.ID, counter)
+	}
+
+	if recoveryCode != "" {
+		if _, ok := utils.UseRecoveryCodeHash(user.RecoveryCodeHashes, recoveryCode); !ok {
+			return false, nil
+		}
+
+		return models.UseRecoveryCode(user.ID, utils.HashRecoveryCode(recoveryCode))
+	}
+
+	return false, nil
+}
+
+// hashRecoveryCodes - The hashes stored for the recovery codes
+func hashRecoveryCodes(codes []string) []string {
+	hashes := make([]string, len(codes))
+	for i, code := range codes {
+		hashes[i] = utils.HashRecoveryCode(code)
+	}
+	return hashes
+}
+
+// EnrolTwoFactor - Generate a new secret, the two-factor authentication is enabled after verifying the first code
+func EnrolTwoFactor(c *gin.Context) {
+	user := utils.GetUserFromContext(c)
+
+	if user == nil {
+		return
+	}
+
+	if user.TwoFactorEnabled {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"err": "The two-factor authentication has been enabled",
+			"msg": "The two-factor authentication has been enabled",
+		})
+		return
+	}
+
+	secret, err := utils.GenerateTOTPSecret()
+
+	if err != nil {
+		errStr := fmt.Sprintf("Cannot generate the secret: %+v", err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"err": errStr,
+			"msg": "Cannot generate the secret",
+		})
+		return
+	}
+
+	_, err = models.SetPendingTwoFactorSecret(user.ID, secret)
+
+	if err != nil {
+		errStr := fmt.Sprintf("Cannot save the secret: %+v", err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"err": errStr,
+			"msg": "Cannot save the secret",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"secret":     secret,
+		"otpauthURI": utils.TOTPAuthURI(secret, user.Email),
+	})
+}
+
+// VerifyTwoFactorEnrolment - Enable the two-factor authentication with the first code from the authenticator app
+// The recovery codes are only shown here, and the session gets new tokens which passed the two-factor authentication
+func VerifyTwoFactorEnrolment(c *gin.Context) {
+	var codeInfo TwoFactorCodeInfo
+
+	if err := c.ShouldBindJSON(&codeInfo); err != nil {
+		errStr := fmt.Sprintf("Cannot bind the given TwoFactorCodeInfo: %+v", err)
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"err": errStr,
+			"msg": "Cannot bind the given TwoFactorCodeInfo",
+		})
+		return
+	}
+
+	user := utils.GetUserFromContext(c)
+	session := utils.GetSessionFromContext(c)
+
+	if user == nil || session == nil {
+		return
+	}
+
+	if user.TwoFactorPendingSecret == "" {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"err": "Please start the enrolment first",
+			"msg": "Please start the enrolment first",
+		})
+		return
+	}
+
+	counter, ok := utils.ValidateTOTP(user.TwoFactorPendingSecret, codeInfo.Code)
+
+	if !ok {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"err": "The code is not correct",
+			"msg": "The code is not correct",
+		})
+		return
+	}
+
+	recoveryCodes, err := utils.GenerateRecoveryCodes()
+
+	if err != nil {
+		errStr := fmt.Sprintf("Cannot generate the recovery codes: %+v", err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"err": errStr,
+			"msg": "Cannot generate the recovery codes",
+		})
+		return
+	}
+
+	enabled, err := models.EnableTwoFactor(user.ID, user.TwoFactorPendingSecret, counter, hashRecoveryCodes(recoveryCodes))
+
+	if err != nil {
+		errStr := fmt.Sprintf("Cannot enable the two-factor authentication: %+v", err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"err": errStr,
+			"msg": "Cannot enable the two-factor authentication",
+		})
+		return
+	}
+
+	if !enabled {
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{
+			"err": "The enrolment has been restarted, please use the new secret",
+			"msg": "The enrolment has been restarted, please use the new secret",
+		})
+		return
+	}
+
+	_, err = models.MarkSessionTwoFactor(session.ID)
+
+	if err != nil {
+		errStr := fmt.Sprintf("Cannot update the session: %+v", err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"err": errStr,
+			"msg": "Cannot update the session",
+		})
+		return
+	}
+
+	session.TwoFactor = true
+
+	authToken, refreshToken, err := utils.GenerateTokensForSession(session)
+
+	if err != nil {
+		errStr := fmt.Sprintf("Cannot generate auth token for this user: %+v", err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"err": errStr,
+			"msg": "Cannot generate auth token for this user",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"recoveryCodes": recoveryCodes,
+		"token":         authToken,
+		"refreshToken":  refreshToken,
+	})
+}
+
+// RegenerateRecoveryCodes - Replace the recovery codes, the old ones can't be used anymore
+func RegenerateRecoveryCodes(c *gin.Context) {
+	var codeInfo TwoFactorCodeInfo
+
+	if err := c.ShouldBindJSON(&codeInfo); err != nil {
+		errStr := fmt.Sprintf("Cannot bind the given TwoFactorCodeInfo: %+v", err)
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"err": errStr,
+			"msg": "Cannot bind the given TwoFactorCodeInfo",
+		})
+		return
+	}
+
+	user := utils.GetUserFromContext(c)
+
+	if user == nil {
+		return
+	}
+
+	if !user.TwoFactorEnabled {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"err": "The two-factor authentication is not enabled",
+			"msg": "The two-factor authentication is not enabled",
+		})
+		return
+	}
+
+	ok, err := checkTwoFactorCode(user, codeInfo.Code, "")
+
+	if err != nil {
+		errStr := fmt.Sprintf("Cannot check the code: %+v", err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"err": errStr,
+			"msg": "Cannot check the code",
+		})
+		return
+	}
+
+	if !ok {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"err": "The code is not correct",
+			"msg": "The code is not correct",
+		})
+		return
+	}
+
+	recoveryCodes, err := utils.GenerateRecoveryCodes()
+
+	if err != nil {
+		errStr := fmt.Sprintf("Cannot generate the recovery codes: %+v", err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"err": errStr,
+			"msg": "Cannot generate the recovery codes",
+		})
+		return
+	}
+
+	_, err = models.SetRecoveryCodes(user.ID, hashRecoveryCodes(recoveryCodes))
+
+	if err != nil {
+		errStr := fmt.Sprintf("Cannot save the recovery codes: %+v", err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"err": errStr,
+			"msg": "Cannot save the recovery codes",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"recoveryCodes": recoveryCodes,
+	})
+}
+
+// DisableTwoFactor - Turn off the two-factor authentication, not allowed for moderators
+func DisableTwoFactor(c *gin.Context) {
+	var codeInfo TwoFactorCodeInfo
+
+	if err := c.ShouldBindJSON(&codeInfo); err != nil {
+		errStr := fmt.Sprintf("Cannot bind the given TwoFactorCodeInfo: %+v", err)
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"err": errStr,
+			"msg": "Cannot bind the given TwoFactorCodeInfo",
+		})
+		return
+	}
+
+	user := utils.GetUserFromContext(c)
+
+	if user == nil {
+		return
+	}
+
+	if user.RequiresTwoFactor() {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+			"err": "The two-factor authentication is mandatory for moderators",
+			"msg": "The two-factor authentication is mandatory for moderators",
+		})
+		return
+	}
+
+	if !user.TwoFactorEnabled {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"err": "The two-factor authentication is not enabled",
+			"msg": "The two-factor authentication is not enabled",
+		})
+		return
+	}
+
+	ok, err := checkTwoFactorCode(user, codeInfo.Code, "")
+
+	if err != nil {
+		errStr := fmt.Sprintf("Cannot check the code: %+v", err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"err": errStr,
+			"msg": "Cannot check the code",
+		})
+		return
+	}
+
+	if !ok {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"err": "The code is not correct",
+			"msg": "The code is not correct",
+		})
+		return
+	}
+
+	_, err = models.DisableTwoFactor(user.ID)
+
+	if err != nil {
+		errStr := fmt.Sprintf("Cannot disable the two-factor authentication: %+v", err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"err": errStr,
+			"msg": "Cannot disable the two-factor authentication",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"msg": "The two-factor authentication has been disabled",
+	})
+}
+
+// LoginWithTwoFactor - The second step of the login, exchange the challenge token and a code for the tokens
+func LoginWithTwoFactor(c *gin.Context) {
+	var loginInfo TwoFactorLoginInfo
+
+	if err := c.ShouldBindJSON(&loginInfo); err != nil {
+		errStr := fmt.Sprintf("Cannot bind the given TwoFactorLoginInfo: %+v", err)
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"err": errStr,
+			"msg": "Cannot bind the given TwoFactorLoginInfo",
+		})
+		return
+	}
+
+	uOID, err := utils.ParseTwoFactorChallengeToken(loginInfo.ChallengeToken)
+
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+			"err":  "The challenge token is not valid or has expired, please login again",
+			"msg":  "The challenge token is not valid or has expired, please login again",
+			"code": middlewares.ErrCodeTwoFactorRequired,
+		})
+		return
+	}
+
+	user, err := models.FindUserByOID(*uOID)
+
+	if err != nil || !user.TwoFactorEnabled {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+			"err":  "The challenge token is not valid or has expired, please login again",
+			"msg":  "The challenge token is not valid or has expired, please login again",
+			"code": middlewares.ErrCodeTwoFactorRequired,
+		})
+		return
+	}
+
+	if abortIfLoginBackoff(c, models.LoginAttemptTwoFactor, user.Email) {
+		return
+	}
+
+	if user.IsLocked() {
+		recordLoginAttempt(c, models.LoginAttemptTwoFactor, user.Email, &user.ID, false, loginFailLocked)
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"err": "The code is not correct",
+			"msg": "The code is not correct",
+		})
+		return
+	}
+
+	ok, err := checkTwoFactorCode(user, loginInfo.Code, loginInfo.RecoveryCode)
+
+	if err != nil {
+		errStr := fmt.Sprintf("Cannot check the code: %+v", err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"err": errStr,
+			"msg": "Cannot check the code",
+		})
+		return
+	}
+
+	if !ok {
+		// Whoever gets here knows the password, so the failures count towards the lock as well
+		handleFailedLogin(user.ID)
+		recordLoginAttempt(c, models.LoginAttemptTwoFactor, user.Email, &user.ID, false, loginFailTwoFactor)
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"err": "The code is not correct",
+			"msg": "The code is not correct",
+		})
+		return
+	}
+
+	// Only told once the password is correct, so the bans can't be probed
+	if user.IsBanned() {
+		recordLoginAttempt(c, models.LoginAttemptTwoFactor, user.Email, &user.ID, false, loginFailBanned)
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+			"err":         "The account has been banned",
+			"msg":         "The account has been banned",
+			"restriction": user.Restriction,
+			"code":        middlewares.ErrCodeAccountBanned,
+		})
+		return
+	}
+
+	if user.FailedLoginCount > 0 {
+		if _, err := models.ResetFailedLogins(user.ID); err != nil {
+			log.Printf("Cannot reset the failed logins of %+v: %+v", user.ID, err)
+		}
+	}
+
+	// The password has been checked by LoginUser, the login is complete only now
+	recordLoginAttempt(c, models.LoginAttemptTwoFactor, user.Email, &user.ID, true, "")
+	recordLoginAttempt(c, models.LoginAttemptLogin, user.Email, &user.ID, true, "")
+
+	user.Password = ""
+
+	session, err := utils.CreateSession(user.ID, true, c)
+
+	if err != nil {
+		errStr := fmt.Sprintf("Cannot create session for this user: %+v", err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"err": errStr,
+			"msg": "Cannot create session for this user",
+		})
+		return
+	}
+
+	authToken, refreshToken, err := utils.GenerateTokensForSession(session)
+
+	if err != nil {
+		errStr := fmt.Sprintf("Cannot generate auth token for this user: %+v", err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"err": errStr,
+			"msg": "Cannot generate auth token for this user",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"token":        authToken,
+		"refreshToken": refreshToken,
+		"user":         user,
+	})
+}
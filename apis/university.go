@@ -0,0 +1,304 @@
+package apis
+
+import (
+	"fmt"
+	"net/http"
+	"quenc/models"
+	"quenc/utils"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+)
+
+type AddingUniversityInfo struct {
+	Domains []string          `json:"domains" binding:"required"`
+	Names   map[string]string `json:"names" binding:"required"`
+	LogoURL string            `json:"logoURL"`
+	Majors  []string          `json:"majors"`
+	Enabled bool              `json:"enabled"`
+}
+
+type UpdateUniversityInfo struct {
+	Domains []string          `json:"domains"`
+	Names   map[string]string `json:"names"`
+	LogoURL *string           `json:"logoURL"`
+	Majors  []string          `json:"majors"`
+	Enabled *bool             `json:"enabled"`
+}
+
+// normaliseUniversityDomains - Lower case the domains and check none of them is used by another University
+func normaliseUniversityDomains(domains []string, uOID *primitive.ObjectID) ([]string, error) {
+	normalised := []string{}
+	seen := map[string]bool{}
+
+	for _, d := range domains {
+		d = strings.ToLower(strings.TrimSpace(d))
+
+		if d == "" || !strings.Contains(d, ".") || strings.Contains(d, "@") {
+			return nil, fmt.Errorf("%q is not a valid domain", d)
+		}
+
+		if seen[d] {
+			continue
+		}
+		seen[d] = true
+
+		found, err := models.FindUniversityByDomain(d)
+		if err != nil {
+			return nil, err
+		}
+
+		// Only the exact domain conflicts, subdomains are allowed to be another University
+		if found != nil && (uOID == nil || found.ID != *uOID) {
+			for _, fd := range found.Domains {
+				if fd == d {
+					return nil, fmt.Errorf("%q is used by another university", d)
+				}
+			}
+		}
+
+		normalised = append(normalised, d)
+	}
+
+	if len(normalised) == 0 {
+		return nil, fmt.Errorf("at least one domain is required")
+	}
+
+	return normalised, nil
+}
+
+// normaliseUniversityMajors - Trim the majors and remove the empty and repeated ones
+func normaliseUniversityMajors(majors []string) []string {
+	normalised := []string{}
+	seen := map[string]bool{}
+
+	for _, m := range majors {
+		m = strings.TrimSpace(m)
+
+		if m == "" || seen[m] {
+			continue
+		}
+		seen[m] = true
+
+		normalised = append(normalised, m)
+	}
+
+	return normalised
+}
+
+func AddUniversity(c *gin.Context) {
+	var addingInfo AddingUniversityInfo
+
+	if err := c.ShouldBindJSON(&addingInfo); err != nil {
+		errStr := fmt.Sprintf("Cannot bind the input json: %+v", err)
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"err": errStr,
+		})
+		return
+	}
+
+	domains, err := normaliseUniversityDomains(addingInfo.Domains, nil)
+
+	if err != nil {
+		errStr := fmt.Sprintf("The domains are not valid: %+v", err)
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"err": errStr,
+		})
+		return
+	}
+
+	now := time.Now()
+	university := models.University{
+		Domains:   domains,
+		Names:     addingInfo.Names,
+		LogoURL:   addingInfo.LogoURL,
+		Majors:    normaliseUniversityMajors(addingInfo.Majors),
+		Enabled:   addingInfo.Enabled,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	InsertedID, err := models.AddUniversity(&university)
+
+	if err != nil {
+		errStr := fmt.Sprintf("Cannot add this university: %+v", err)
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"err": errStr,
+		})
+		return
+	}
+
+	university.ID = InsertedID.(primitive.ObjectID)
+
+	c.JSON(http.StatusOK, gin.H{
+		"university": university,
+	})
+}
+
+func UpdateUniversity(c *gin.Context) {
+	var updateInfo UpdateUniversityInfo
+
+	unid := c.Param("unid")
+
+	if err := c.ShouldBindJSON(&updateInfo); err != nil {
+		errStr := fmt.Sprintf("Cannot bind the input json: %+v", err)
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"err": errStr,
+		})
+		return
+	}
+
+	unOID := utils.GetOID(unid, c)
+	if unOID == nil {
+		return
+	}
+
+	updateFields := bson.M{"updatedAt": time.Now()}
+
+	if updateInfo.Domains != nil {
+		domains, err := normaliseUniversityDomains(updateInfo.Domains, unOID)
+
+		if err != nil {
+			errStr := fmt.Sprintf("The domains are not valid: %+v", err)
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"err": errStr,
+			})
+			return
+		}
+
+		updateFields["domains"] = domains
+	}
+
+	if updateInfo.Names != nil {
+		updateFields["names"] = updateInfo.Names
+	}
+
+	if updateInfo.LogoURL != nil {
+		updateFields["logoURL"] = *updateInfo.LogoURL
+	}
+
+	if updateInfo.Majors != nil {
+		updateFields["majors"] = normaliseUniversityMajors(updateInfo.Majors)
+	}
+
+	if updateInfo.Enabled != nil {
+		updateFields["enabled"] = *updateInfo.Enabled
+	}
+
+	result, err := models.UpdateUniversityByOID(*unOID, updateFields)
+
+	if err != nil {
+		errStr := fmt.Sprintf("Cannot update the university: %+v", err)
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"err": errStr,
+		})
+		return
+	}
+
+	if result.MatchedCount == 0 {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{
+			"err": "The university is not found",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"result":       result,
+		"updateFields": updateFields,
+	})
+}
+
+func DeleteUniversityById(c *gin.Context) {
+	unid := c.Param("unid")
+	unOID := utils.GetOID(unid, c)
+	if unOID == nil {
+		return
+	}
+
+	result, err := models.DeleteUniversityByOID(*unOID)
+
+	if err != nil {
+		errStr := fmt.Sprintf("Cannot delete the university: %+v", err)
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"err": errStr,
+		})
+		return
+	}
+
+	if result.DeletedCount == 0 {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{
+			"err": "The university is not found",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"unid": unid,
+	})
+}
+
+// FindEnabledUniversities - The universities users can sign up with
+func FindEnabledUniversities(c *gin.Context) {
+	universities, err := models.FindUniversities(bson.M{"enabled": true}, options.Find().SetSort(bson.M{"createdAt": 1}))
+
+	if err != nil {
+		errStr := fmt.Sprintf("Cannot find the universities: %+v", err)
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"err": errStr,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"universities": universities,
+	})
+}
+
+// FindAllUniversities - Every university including the disabled ones, for admin
+func FindAllUniversities(c *gin.Context) {
+	findOption := options.Find()
+	if err := utils.SetupFindOptions(findOption, c); err != nil {
+		return
+	}
+
+	universities, err := models.FindUniversities(bson.M{}, findOption)
+
+	if err != nil {
+		errStr := fmt.Sprintf("Cannot find the universities: %+v", err)
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"err": errStr,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"universities": universities,
+	})
+}
+
+func FindUniversityByID(c *gin.Context) {
+	unid := c.Param("unid")
+	unOID := utils.GetOID(unid, c)
+	if unOID == nil {
+		return
+	}
+
+	university, err := models.FindUniversityByOID(*unOID)
+
+	if err != nil {
+		errStr := fmt.Sprintf("Cannot find the university: %+v", err)
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"err": errStr,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"university": university,
+	})
+}
@@ -0,0 +1,157 @@
+package apis
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+)
+
+// ErrCodeFieldsRejected - Some fields of the update can't be changed, see the rejected list
+const ErrCodeFieldsRejected = "FIELDS_REJECTED"
+
+// Why a field of an update is rejected
+const (
+	RejectedUnknown   = "unknown"   // not a field which can be updated
+	RejectedForbidden = "forbidden" // the user is not allowed to change it
+	RejectedInvalid   = "invalid"   // the value is not valid
+)
+
+// RejectedField - A field of the update which is not applied
+type RejectedField struct {
+	Field  string `json:"field"`
+	Reason string `json:"reason"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// abortRejectedFields - Answer with a 400 listing the rejected fields
+func abortRejectedFields(c *gin.Context, rejected []RejectedField) {
+	fields := []string{}
+	for _, r := range rejected {
+		fields = append(fields, r.Field)
+	}
+
+	errStr := fmt.Sprintf("These fields can't be updated: %s", strings.Join(fields, ", "))
+	c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+		"err":      errStr,
+		"msg":      errStr,
+		"code":     ErrCodeFieldsRejected,
+		"rejected": rejected,
+	})
+}
+
+// abortInvalidField - abortRejectedFields for a single field with an invalid value
+func abortInvalidField(c *gin.Context, field string, err error) {
+	abortRejectedFields(c, []RejectedField{{Field: field, Reason: RejectedInvalid, Detail: err.Error()}})
+}
+
+// updateFieldNames - The JSON names of the fields of the typed update
+func updateFieldNames(update interface{}) []string {
+	names := []string{}
+
+	t := reflect.TypeOf(update)
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	for i := 0; i < t.NumField(); i++ {
+		name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		if name != "" && name != "-" {
+			names = append(names, name)
+		}
+	}
+
+	return names
+}
+
+// readUpdateBody - Read the JSON object of the update, so the allowed fields can be decided before binding
+// nil is returned when the request has been aborted
+func readUpdateBody(c *gin.Context) map[string]json.RawMessage {
+	var raw map[string]json.RawMessage
+
+	body, err := ioutil.ReadAll(c.Request.Body)
+
+	if err == nil {
+		err = json.Unmarshal(body, &raw)
+	}
+
+	if err != nil || raw == nil {
+		errStr := fmt.Sprintf("Cannot bind the input json: %+v", err)
+		if err == nil {
+			errStr = "The update has to be a JSON object"
+		}
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"err": errStr,
+			"msg": "Cannot bind the input json",
+		})
+		return nil
+	}
+
+	return raw
+}
+
+// bindUpdate - Bind the fields to the typed update, only the permitted ones can be given
+// The others, and the nulls, are rejected all at once with abortRejectedFields, false is returned when the request has been aborted
+// So every field given is set in the update
+func bindUpdate(c *gin.Context, raw map[string]json.RawMessage, update interface{}, permitted ...string) bool {
+	known := map[string]bool{}
+	for _, name := range updateFieldNames(update) {
+		known[name] = true
+	}
+
+	allowed := map[string]bool{}
+	for _, name := range permitted {
+		allowed[name] = true
+	}
+
+	rejected := []RejectedField{}
+	for field := range raw {
+		switch {
+		case !known[field]:
+			rejected = append(rejected, RejectedField{Field: field, Reason: RejectedUnknown})
+		case !allowed[field]:
+			rejected = append(rejected, RejectedField{Field: field, Reason: RejectedForbidden})
+		}
+	}
+
+	// Each field is decoded alone, so a wrong type is reported with its field
+	// A null would leave the field as not given, so it's rejected rather than ignored
+	for field, value := range raw {
+		if !known[field] || !allowed[field] {
+			continue
+		}
+
+		if bytes.Equal(bytes.TrimSpace(value), []byte("null")) {
+			rejected = append(rejected, RejectedField{Field: field, Reason: RejectedInvalid, Detail: "the value can't be null"})
+			continue
+		}
+
+		single, _ := json.Marshal(map[string]json.RawMessage{field: value})
+		if err := json.Unmarshal(single, update); err != nil {
+			rejected = append(rejected, RejectedField{Field: field, Reason: RejectedInvalid, Detail: err.Error()})
+		}
+	}
+
+	if len(rejected) > 0 {
+		sort.Slice(rejected, func(i, j int) bool { return rejected[i].Field < rejected[j].Field })
+		abortRejectedFields(c, rejected)
+		return false
+	}
+
+	if len(raw) == 0 {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"err": "Nothing to update",
+			"msg": "Nothing to update",
+		})
+		return false
+	}
+
+	return true
+}
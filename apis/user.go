@@ -5,8 +5,10 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"quenc/middlewares"
 	"quenc/models"
 	"quenc/utils"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -22,19 +24,49 @@ type SingupInfo struct {
 }
 
 type ChangingPasswordInfo struct {
-	OldPassword string `json:"oldPassword" bson:"oldPassword"`
-	NewPasswrod string `json:"newPassword" bson:"newPassword"`
+	OldPassword string `json:"oldPassword" bson:"oldPassword" binding:"required"`
+	NewPassword string `json:"newPassword" bson:"newPassword" binding:"required"`
 }
 
+type ForgotPasswordInfo struct {
+	Email string `json:"email" binding:"required"`
+}
+
+type ResetPasswordInfo struct {
+	Token       string `json:"token" binding:"required"`
+	NewPassword string `json:"newPassword" binding:"required"`
+}
+
+// The minimum length of a new password
+const passwordMinLength = 8
+
 type LoginInfo struct {
 	Eamil    string `json:"email" bson:"email"`
 	Password string `json:"password" bson:"password"`
 }
 
+type RefreshTokenInfo struct {
+	RefreshToken string `json:"refreshToken" binding:"required"`
+}
+
+// Error codes for the client to know when it has to login again
+const (
+	ErrCodeRefreshTokenInvalid = "REFRESH_TOKEN_INVALID"
+	ErrCodeRefreshTokenExpired = "REFRESH_TOKEN_EXPIRED"
+	ErrCodeRefreshTokenReused  = "REFRESH_TOKEN_REUSED"
+)
+
+// UpdateUserInfo - The profile fields a user can change, the others are set by their own endpoints
 type UpdateUserInfo struct {
-	UpdateDetail map[string]interface{} `json:"updateDetail" bson:"updateDetail"`
+	Name     *string `json:"name"`
+	PhotoURL *string `json:"photoURL"` // the ID of an uploaded media
+	Major    *string `json:"major"`
+	Dob      *string `json:"dob"`
+	Gender   *int    `json:"gender"`
 }
 
+// SingupUser - Create the User and send the verification email
+// It only answers {email, msg}, whether the email is new, used or banned, the tokens come from /user/login
 func SingupUser(c *gin.Context) {
 
 	// Hava to use the uni email
@@ -44,7 +76,7 @@ func SingupUser(c *gin.Context) {
 	// Create a User in the backend
 
 	if err != nil {
-		errStr := fmt.Sprint("Cannot bind the given signup info: %+v", err)
+		errStr := fmt.Sprintf("Cannot bind the given signup info: %+v", err)
 		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
 			"err": errStr,
 			"msg": "Cannot bind the given LoginInfo",
@@ -52,65 +84,112 @@ func SingupUser(c *gin.Context) {
 		return
 	}
 
-	if foundUser, _ := models.FindUserByEmail(singupInfo.Email); foundUser != nil {
+	if abortIfLoginBackoff(c, models.LoginAttemptSignup, singupInfo.Email) {
+		return
+	}
+
+	// Subdomains (e.g. connect.qut.edu.au) are stored as the main domain of their University
+	university, err := models.FindUniversityByDomain(utils.GetDomainFromEmail(singupInfo.Email))
+
+	if err != nil {
+		errStr := fmt.Sprintf("Cannot find the university of this email: %+v", err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"err": errStr,
+			"msg": "Cannot find the university of this email",
+		})
+		return
+	}
+
+	if university == nil || !university.Enabled {
+		recordLoginAttempt(c, models.LoginAttemptSignup, singupInfo.Email, nil, false, signupFailDomain)
 		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
-			"err":        "The email has been used",
-			"msg":        "The email has been used",
-			"singupInfo": singupInfo,
-			"foundUser":  foundUser,
+			"err": "Please use supported email domain for registering",
+			"msg": "Please use supported email domain for registering",
 		})
 		return
 	}
 
+	// Hashing before checking the email, so used emails take as long as new ones
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(singupInfo.Password), bcrypt.DefaultCost)
 
 	if err != nil {
-		errStr := fmt.Sprint("Cannot has the password: %+v", err)
+		errStr := fmt.Sprintf("Cannot has the password: %+v", err)
 		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
-			"err":        errStr,
-			"msg":        "Cannot hash the Password",
-			"singupInfo": singupInfo,
+			"err": errStr,
+			"msg": "Cannot hash the Password",
 		})
 		return
 	}
 
-	// Creating user here
+	// Used emails and new ones get the same response, so the emails can't be probed
+	// The owner of a used email is told by email instead, the client logs in after signing up
+	respondSignup := func() {
+		c.JSON(http.StatusOK, gin.H{
+			"email": singupInfo.Email,
+			"msg":   "Please check your email to activate the account, then login",
+		})
+	}
+
+	if foundUser, _ := models.FindUserByEmail(singupInfo.Email); foundUser != nil {
+		recordLoginAttempt(c, models.LoginAttemptSignup, singupInfo.Email, &foundUser.ID, false, signupFailEmailExists)
+
+		if err := models.SendingAccountExistsEmail(foundUser); err != nil {
+			log.Printf("Cannot send the account exists email to %+v: %+v", foundUser.ID, err)
+		}
 
-	userDomain := utils.GetDomainFromEmail(singupInfo.Email)
+		respondSignup()
+		return
+	}
 
-	if valid := utils.CheckDomainValid(userDomain); !valid {
+	banned, err := models.IsEmailBanned(singupInfo.Email)
+
+	if err != nil {
+		errStr := fmt.Sprintf("Cannot check the bans of this email: %+v", err)
 		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
-			"err":        "Please use supported email domain for registering",
-			"msg":        "Please use supported email domain for registering",
-			"singupInfo": singupInfo,
+			"err": errStr,
+			"msg": "Cannot check the bans of this email",
 		})
 		return
 	}
 
+	// The email of a banned account which has been deleted, answered as any other so the bans can't be probed
+	if banned {
+		recordLoginAttempt(c, models.LoginAttemptSignup, singupInfo.Email, nil, false, signupFailBanned)
+
+		respondSignup()
+		return
+	}
+
+	// Creating user here
+
 	user := models.User{
-		Domain:        userDomain,
-		Email:         singupInfo.Email,
-		Name:          "",
-		Password:      string(hashedPassword),
-		PhotoURL:      "",
-		Major:         "",
-		Role:          1,
-		Gender:        -1,
-		EmailVerified: false,
-		Dob:           "",
-		LastSeen:      time.Now(),
-		CreatedAt:     time.Now(),
-		LikePosts:     []primitive.ObjectID{},
-		LikeComments:  []primitive.ObjectID{},
-		ChatRooms:     []primitive.ObjectID{},
-		Friends:       []primitive.ObjectID{},
-		SavedPosts:    []primitive.ObjectID{},
+		Domain:              university.MainDomain(),
+		Email:               singupInfo.Email,
+		Name:                "",
+		Password:            string(hashedPassword),
+		PhotoURL:            "",
+		Major:               "",
+		Roles:               []string{models.RoleUser},
+		Gender:              -1,
+		EmailVerified:       false,
+		Dob:                 "",
+		LastSeen:            time.Now(),
+		CreatedAt:           time.Now(),
+		LikePosts:           []primitive.ObjectID{},
+		LikeComments:        []primitive.ObjectID{},
+		ChatRooms:           []primitive.ObjectID{},
+		Friends:             []primitive.ObjectID{},
+		SavedPosts:          []primitive.ObjectID{},
+		HiddenPosts:         []primitive.ObjectID{},
+		FollowedCategories:  []primitive.ObjectID{},
+		FollowedAuthors:     []primitive.ObjectID{},
+		ModeratedCategories: []primitive.ObjectID{},
 	}
 
 	InsertedID, err := models.AddUser(&user)
 
 	if err != nil {
-		errStr := fmt.Sprint("Unable to add the user to Database: %+v", err)
+		errStr := fmt.Sprintf("Unable to add the user to Database: %+v", err)
 		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
 			"err": errStr,
 			"msg": "Unable to add the user to Database",
@@ -119,58 +198,80 @@ func SingupUser(c *gin.Context) {
 	}
 
 	user.ID = InsertedID.(primitive.ObjectID)
-	user.Password = ""
 
-	authToken, err := utils.GenerateAuthToken(user.ID.Hex())
-
-	if err != nil {
-		errStr := fmt.Sprint("Cannot Generate the Auth Token: %+v", err)
-		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
-			"err":  errStr,
-			"msg":  "Cannot Generate the Auth Token",
-			"user": user,
-		})
-		return
-	}
+	recordLoginAttempt(c, models.LoginAttemptSignup, singupInfo.Email, &user.ID, true, "")
 
 	// Send verification email here
 
-	err = models.SendingVerificationEmail(&user)
-
-	if err != nil {
-		errStr := fmt.Sprint("Cannot send the email to this account: %+v", err)
-		c.AbortWithStatusJSON(
-			http.StatusBadGateway, gin.H{
-				"err": errStr,
-				"msg": "Cannot send the email to this account",
-			},
-		)
-		return
+	// The user has been created, so failing to send the email should not fail the signup
+	// The client can ask for another email with /user/send-verification-email after login
+	if err := issueVerificationEmail(&user); err != nil {
+		log.Printf("Cannot send the verification email to %+v: %+v", user.ID, err)
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"user":  user,
-		"token": authToken,
-		"msg":   "Email verification has been sent to" + user.Email,
-	})
+	respondSignup()
 }
 
 func TokenAutoLogin(c *gin.Context) {
 	user := utils.GetUserFromContext(c)
 
+	if user == nil {
+		return
+	}
+
 	c.JSON(
 		http.StatusOK,
 		gin.H{
-			"user": user,
+			"user":        user,
+			"permissions": user.Permissions(),
 		},
 	)
 }
 
+// issueVerificationEmail - Generate a new verification token for the user and email it
+func issueVerificationEmail(user *models.User) error {
+	verificationToken, err := utils.GenerateRandomToken(32)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = models.SetEmailVerificationToken(user.ID, utils.HashToken(verificationToken))
+
+	if err != nil {
+		return err
+	}
+
+	return models.SendingVerificationEmail(user, verificationToken)
+}
+
 func SendVerificationEmailForUser(c *gin.Context) {
 	// Have to login to do this
 	user := utils.GetUserFromContext(c)
 
-	err := models.SendingVerificationEmail(user)
+	if user == nil {
+		return
+	}
+
+	if user.EmailVerified {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"err": "The email has been verified",
+			"msg": "The email has been verified",
+		})
+		return
+	}
+
+	if wait := models.EmailVerificationResendInterval - time.Since(user.EmailVerificationSentAt); wait > 0 {
+		errStr := fmt.Sprintf("Please wait %d seconds before sending another email", int(wait.Seconds())+1)
+		c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{
+			"err":        errStr,
+			"msg":        "Please wait before sending another email",
+			"retryAfter": int(wait.Seconds()) + 1,
+		})
+		return
+	}
+
+	err := issueVerificationEmail(user)
 
 	if err != nil {
 		errStr := fmt.Sprintf("Cannot send the email to this account: %+v", err)
@@ -190,44 +291,49 @@ func SendVerificationEmailForUser(c *gin.Context) {
 }
 
 func ActivateUserEmail(c *gin.Context) {
-	uid := c.Param("uid")
+	token := c.Param("token")
+	tokenHash := utils.HashToken(token)
 
-	uOID, err := primitive.ObjectIDFromHex(uid)
+	// The token is removed after activation, so a used token can't be found either
+	user, err := models.FindUserByEmailVerificationTokenHash(tokenHash)
 
 	if err != nil {
-		errStr := fmt.Sprintf("Cannot get ObjectID from Hex: %+v", err)
 		c.HTML(http.StatusBadRequest, "EmailVerificationFail.tmpl", gin.H{
-			"email": uid,
-			"error": errStr,
-			"msg":   "無法找到此使用者",
+			"email": "",
+			"error": "The verification link is not valid or has been used",
+			"msg":   "此連結無效或已被使用",
 		})
 		return
 	}
 
-	user, err := models.FindUserByOID(uOID)
-
-	if err != nil {
+	if time.Now().After(user.EmailVerificationExpiresAt) {
 		c.HTML(http.StatusBadRequest, "EmailVerificationFail.tmpl", gin.H{
 			"email": user.Email,
-			"error": err.Error,
-			"msg":   "無法找到此使用者",
+			"error": "The verification link has expired",
+			"msg":   "此連結已過期，請重新發送激活信",
 		})
 		return
 	}
 
-	_, err = models.UpdateUserByOID(uOID, bson.M{"emailVerified": true})
+	activated, err := models.ActivateUserEmailByToken(user.ID, tokenHash)
 
 	if err != nil {
-
-		c.HTML(http.StatusBadRequest, "EmailVerificationFail.tmpl", gin.H{
+		c.HTML(http.StatusInternalServerError, "EmailVerificationFail.tmpl", gin.H{
 			"email": user.Email,
-			"error": err.Error,
+			"error": err.Error(),
 			"msg":   "無法激活此使用者",
 		})
 		return
 	}
 
-	user.EmailVerified = true
+	if !activated {
+		c.HTML(http.StatusBadRequest, "EmailVerificationFail.tmpl", gin.H{
+			"email": user.Email,
+			"error": "The verification link has been used",
+			"msg":   "此連結已被使用",
+		})
+		return
+	}
 
 	c.HTML(http.StatusOK, "EmailVerificationSuccessful.tmpl", gin.H{
 		"email": user.Email,
@@ -257,19 +363,114 @@ func LoginUser(c *gin.Context) {
 		return
 	}
 
+	if abortIfLoginBackoff(c, models.LoginAttemptLogin, loginInfo.Eamil) {
+		return
+	}
+
+	// Unknown emails, wrong passwords and locked accounts get the same response, so the emails can't be probed
+	failLogin := func(uOID *primitive.ObjectID, reason string) {
+		recordLoginAttempt(c, models.LoginAttemptLogin, loginInfo.Eamil, uOID, false, reason)
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"err": "Email or Password is not correct",
+			"msg": "Email or Password is not correct",
+		})
+	}
+
 	user, err := models.CheckingTheAuth(loginInfo.Eamil, loginInfo.Password)
 
 	if err != nil {
-		errStr := fmt.Sprintf("Email or Passwrod is not correct: %+v", err)
-		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
-			"err":       errStr,
-			"msg":       "Email or Passwrod is not correct",
-			"loginInfo": loginInfo,
+		foundUser, _ := models.FindUserByEmail(loginInfo.Eamil)
+
+		if foundUser == nil {
+			failLogin(nil, loginFailUnknownEmail)
+			return
+		}
+
+		if foundUser.IsLocked() {
+			failLogin(&foundUser.ID, loginFailLocked)
+			return
+		}
+
+		handleFailedLogin(foundUser.ID)
+		failLogin(&foundUser.ID, loginFailWrongPassword)
+		return
+	}
+
+	// The password is correct, but the account has to be unlocked with the email or wait for the lock to expire
+	if user.IsLocked() {
+		failLogin(&user.ID, loginFailLocked)
+		return
+	}
+
+	// Only told once the password is correct, so the bans can't be probed
+	if user.IsBanned() {
+		recordLoginAttempt(c, models.LoginAttemptLogin, loginInfo.Eamil, &user.ID, false, loginFailBanned)
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+			"err":         "The account has been banned",
+			"msg":         "The account has been banned",
+			"restriction": user.Restriction,
+			"code":        middlewares.ErrCodeAccountBanned,
+		})
+		return
+	}
+
+	// The reset email has been sent when it was forced, the old password can't be used anymore
+	if user.PasswordResetRequired {
+		recordLoginAttempt(c, models.LoginAttemptLogin, loginInfo.Eamil, &user.ID, false, loginFailResetRequired)
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+			"err":  "The password has to be reset, please check the email",
+			"msg":  "The password has to be reset, please check the email",
+			"code": middlewares.ErrCodePasswordResetRequired,
+		})
+		return
+	}
+
+	user.Password = ""
+
+	// The tokens are only given after the code, see LoginWithTwoFactor
+	// The login is only recorded as a success there, so a correct password alone doesn't clear the backoff
+	if user.TwoFactorEnabled {
+		challengeToken, err := utils.GenerateTwoFactorChallengeToken(user.ID.Hex())
+
+		if err != nil {
+			errStr := fmt.Sprintf("Cannot generate the challenge token: %+v", err)
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+				"err": errStr,
+				"msg": "Cannot generate the challenge token",
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"twoFactorRequired": true,
+			"challengeToken":    challengeToken,
+		})
+		return
+	}
+
+	recordLoginAttempt(c, models.LoginAttemptLogin, loginInfo.Eamil, &user.ID, true, "")
+
+	// Reset after the two-factor step, so failed codes keep counting towards the lock
+	if user.FailedLoginCount > 0 {
+		if _, err := models.ResetFailedLogins(user.ID); err != nil {
+			log.Printf("Cannot reset the failed logins of %+v: %+v", user.ID, err)
+		}
+	}
+
+	session, err := utils.CreateSession(user.ID, false, c)
+
+	if err != nil {
+		errStr := fmt.Sprintf("Cannot create session for this user: %+v", err)
+
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"err":  errStr,
+			"msg":  "Cannot create session for this user",
+			"user": user,
 		})
 		return
 	}
 
-	authToken, err := utils.GenerateAuthToken(user.ID.Hex())
+	authToken, refreshToken, err := utils.GenerateTokensForSession(session)
 
 	if err != nil {
 		errStr := fmt.Sprintf("Cannot generate auth token for this user: %+v", err)
@@ -282,53 +483,135 @@ func LoginUser(c *gin.Context) {
 		return
 	}
 
+	// Moderators can login to enrol, but the moderation APIs are rejected until the two-factor authentication is enabled
 	c.JSON(http.StatusOK, gin.H{
-		"token": authToken,
-		"user":  user,
+		"token":                      authToken,
+		"refreshToken":               refreshToken,
+		"user":                       user,
+		"twoFactorEnrolmentRequired": user.RequiresTwoFactor(),
 	})
 }
 
-func UpdateUser(c *gin.Context) {
-	var updateFields map[string]interface{}
-	err := c.ShouldBindJSON(&updateFields)
+// RefreshAuthToken - Exchange a refresh token for a new token pair
+// Each refresh token can only be used once, reusing one will revoke the whole family
+func RefreshAuthToken(c *gin.Context) {
+	var refreshInfo RefreshTokenInfo
+	err := c.ShouldBindJSON(&refreshInfo)
+
+	if err != nil {
+		errStr := fmt.Sprintf("Cannot bind the given RefreshTokenInfo: %+v", err)
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"err": errStr,
+			"msg": "Cannot bind the given RefreshTokenInfo",
+		})
+		return
+	}
+
+	storedToken, err := models.FindRefreshTokenByHash(utils.HashToken(refreshInfo.RefreshToken))
+
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+			"err":  "The refresh token is not valid",
+			"msg":  "The refresh token is not valid",
+			"code": ErrCodeRefreshTokenInvalid,
+		})
+		return
+	}
+
+	if storedToken.Revoked {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+			"err":  "The refresh token has been revoked",
+			"msg":  "The refresh token has been revoked",
+			"code": ErrCodeRefreshTokenInvalid,
+		})
+		return
+	}
+
+	if time.Now().After(storedToken.ExpiresAt) {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+			"err":  "The refresh token is expired",
+			"msg":  "The refresh token is expired",
+			"code": ErrCodeRefreshTokenExpired,
+		})
+		return
+	}
+
+	marked, err := models.MarkRefreshTokenUsed(storedToken.ID)
+
+	if err != nil {
+		errStr := fmt.Sprintf("Cannot use the refresh token: %+v", err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"err": errStr,
+			"msg": "Cannot use the refresh token",
+		})
+		return
+	}
+
+	if !marked {
+		// The token has been used before, someone else may hold a copy of it
+		// Revoking the session also revokes the whole refresh token family
+		_, err = models.RevokeSessionByOID(storedToken.Family)
 
-	if _, ok := updateFields["dob"]; ok {
-		_, err := time.Parse("2006-01-02 15:04:05.000Z", updateFields["dob"].(string))
 		if err != nil {
-			errStr := fmt.Sprint("The given DOB is not valid time %+v", err)
-			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
-				"err": errStr,
-				"msg": "The given DOB is not valid time",
-			})
-			return
+			log.Printf("Cannot revoke the session %+v: %+v", storedToken.Family, err)
 		}
+
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+			"err":  "The refresh token has been used already",
+			"msg":  "The refresh token has been used already",
+			"code": ErrCodeRefreshTokenReused,
+		})
+		return
 	}
 
-	delete(updateFields, "_id")
-	delete(updateFields, "email")
-	delete(updateFields, "createdAt")
-	delete(updateFields, "emailVerified")
-	delete(updateFields, "chatRooms")
-	delete(updateFields, "likePosts")
-	delete(updateFields, "likeComments")
-	delete(updateFields, "friends")
-	delete(updateFields, "savedPosts")
+	session, err := models.FindSessionByOID(storedToken.Family)
 
-	if err != nil {
-		errStr := fmt.Sprintf("Cannot bind the given data with UpdateUserInfo: %+v", err)
+	if err != nil || session.Revoked {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+			"err":  "The session has been revoked",
+			"msg":  "The session has been revoked",
+			"code": ErrCodeRefreshTokenInvalid,
+		})
+		return
+	}
 
-		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+	authToken, refreshToken, err := utils.GenerateTokensForSession(session)
+
+	if err != nil {
+		errStr := fmt.Sprintf("Cannot generate auth token for this user: %+v", err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
 			"err": errStr,
-			"msg": "Cannot bind the given data with UpdateUserInfo",
+			"msg": "Cannot generate auth token for this user",
 		})
 		return
 	}
 
-	if updateFields["password"] != nil {
+	_, err = models.TouchSession(session.ID)
+
+	if err != nil {
+		log.Printf("Cannot update the last used time of session %+v: %+v", session.ID, err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"token":        authToken,
+		"refreshToken": refreshToken,
+	})
+}
+
+// UpdateUser - Update the profile of the user, each given field is validated
+func UpdateUser(c *gin.Context) {
+	var updateInfo UpdateUserInfo
+
+	raw := readUpdateBody(c)
+	if raw == nil {
+		return
+	}
+
+	if _, ok := raw["password"]; ok {
 
 		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
-			"err": "Using change-password node to change password",
-			"msg": "Using change-password node to change password",
+			"err": "Using /user/change-password to change password",
+			"msg": "Using /user/change-password to change password",
 		})
 		return
 	}
@@ -338,11 +621,74 @@ func UpdateUser(c *gin.Context) {
 	if user == nil {
 		return
 	}
-	// Admin should be able to do
 
-	UpsertedID, err := models.UpdateUserByOID(user.ID, updateFields)
+	if !bindUpdate(c, raw, &updateInfo, updateFieldNames(&updateInfo)...) {
+		return
+	}
 
-	fmt.Printf("error is %+v\n", err)
+	updateFields := bson.M{}
+
+	if updateInfo.Name != nil {
+		name, err := models.NormaliseName(*updateInfo.Name)
+		if err != nil {
+			abortInvalidField(c, models.ProfileFieldName, err)
+			return
+		}
+
+		updateFields["name"] = name
+		updateFields["searchName"] = models.SearchName(name)
+	}
+
+	if updateInfo.PhotoURL != nil {
+		if !checkMediaID(c, "photoURL", *updateInfo.PhotoURL, user.ID) {
+			return
+		}
+
+		updateFields["photoURL"] = *updateInfo.PhotoURL
+	}
+
+	if updateInfo.Gender != nil {
+		if !models.IsValidGender(*updateInfo.Gender) {
+			abortInvalidField(c, models.ProfileFieldGender, fmt.Errorf("%d is not one of %d, %d and %d", *updateInfo.Gender, models.GenderMale, models.GenderFemale, models.GenderOther))
+			return
+		}
+
+		updateFields["gender"] = *updateInfo.Gender
+	}
+
+	if updateInfo.Major != nil {
+		major := strings.TrimSpace(*updateInfo.Major)
+
+		university, err := models.FindUniversityByDomain(user.Domain)
+
+		if err != nil {
+			errStr := fmt.Sprintf("Cannot find the university of the user: %+v", err)
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+				"err": errStr,
+				"msg": "Cannot find the university of the user",
+			})
+			return
+		}
+
+		if major == "" || !university.HasMajor(major) {
+			abortInvalidField(c, models.ProfileFieldMajor, fmt.Errorf("%q is not a major of the university", major))
+			return
+		}
+
+		updateFields["major"] = major
+	}
+
+	if updateInfo.Dob != nil {
+		dob, err := models.ParseDob(*updateInfo.Dob, time.Now())
+		if err != nil {
+			abortInvalidField(c, models.ProfileFieldDob, err)
+			return
+		}
+
+		updateFields["dob"] = dob
+	}
+
+	UpsertedID, err := models.UpdateUserByOID(user.ID, updateFields)
 
 	if err != nil {
 		errStr := fmt.Sprintf("Cannot update this user: %+v", err)
@@ -352,7 +698,6 @@ func UpdateUser(c *gin.Context) {
 			gin.H{
 				"err":            errStr,
 				"msg":            "Cannot update this user",
-				"user":           user,
 				"UpdateUserInfo": updateFields,
 			},
 		)
@@ -369,6 +714,331 @@ func UpdateUser(c *gin.Context) {
 
 }
 
+// FindOnboardingStatus - The required profile fields the user still has to fill in before posting or chatting
+func FindOnboardingStatus(c *gin.Context) {
+	user := utils.GetUserFromContext(c)
+
+	if user == nil {
+		return
+	}
+
+	status, err := user.OnboardingStatus()
+
+	if err != nil {
+		errStr := fmt.Sprintf("Cannot find the onboarding status: %+v", err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"err": errStr,
+			"msg": "Cannot find the onboarding status",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"onboarding": status,
+	})
+}
+
+// ChangePassword - Change the password after checking the old one
+// Every other session of the user will be revoked
+func ChangePassword(c *gin.Context) {
+	var changingInfo ChangingPasswordInfo
+	err := c.ShouldBindJSON(&changingInfo)
+
+	if err != nil {
+		errStr := fmt.Sprintf("Cannot bind the given ChangingPasswordInfo: %+v", err)
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"err": errStr,
+			"msg": "Cannot bind the given ChangingPasswordInfo",
+		})
+		return
+	}
+
+	if len(changingInfo.NewPassword) < passwordMinLength {
+		errStr := fmt.Sprintf("The new password must have at least %d characters", passwordMinLength)
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"err": errStr,
+			"msg": errStr,
+		})
+		return
+	}
+
+	user := utils.GetUserFromContext(c)
+	if user == nil {
+		return
+	}
+
+	session := utils.GetSessionFromContext(c)
+	if session == nil {
+		return
+	}
+
+	if _, err := models.CheckingTheAuth(user.Email, changingInfo.OldPassword); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"err": "The old password is not correct",
+			"msg": "The old password is not correct",
+		})
+		return
+	}
+
+	_, err = models.UpdatePasswordByOID(user.ID, changingInfo.NewPassword)
+
+	if err != nil {
+		errStr := fmt.Sprintf("Cannot update the password: %+v", err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"err": errStr,
+			"msg": "Cannot update the password",
+		})
+		return
+	}
+
+	_, err = models.RevokeSessionsForUser(user.ID, &session.ID)
+
+	if err != nil {
+		errStr := fmt.Sprintf("Cannot revoke the other sessions: %+v", err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"err": errStr,
+			"msg": "Cannot revoke the other sessions",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"msg": "The password has been changed",
+	})
+}
+
+// sendPasswordReset - Create a reset token for the user and send it by email, only the latest token can be used
+// false is returned when the email cannot be sent, it's logged and the user can ask for another one
+func sendPasswordReset(user *models.User) (bool, error) {
+	resetToken, err := utils.GenerateRandomToken(32)
+
+	if err != nil {
+		return false, err
+	}
+
+	_, err = models.InvalidatePasswordResetsForUser(user.ID)
+
+	if err != nil {
+		log.Printf("Cannot invalidate the old reset tokens of %+v: %+v", user.ID, err)
+	}
+
+	now := time.Now()
+
+	_, err = models.AddPasswordReset(&models.PasswordReset{
+		User:      user.ID,
+		TokenHash: utils.HashToken(resetToken),
+		Used:      false,
+		ExpiresAt: now.Add(models.PasswordResetLifetime),
+		CreatedAt: now,
+	})
+
+	if err != nil {
+		return false, err
+	}
+
+	if err := models.SendingPasswordResetEmail(user, resetToken); err != nil {
+		log.Printf("Cannot send the reset email to %+v: %+v", user.ID, err)
+		return false, nil
+	}
+
+	return true, nil
+}
+
+// ForgotPassword - Sending a reset token to the email
+// The response is the same whether the email exists or not
+func ForgotPassword(c *gin.Context) {
+	var forgotInfo ForgotPasswordInfo
+	err := c.ShouldBindJSON(&forgotInfo)
+
+	if err != nil {
+		errStr := fmt.Sprintf("Cannot bind the given ForgotPasswordInfo: %+v", err)
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"err": errStr,
+			"msg": "Cannot bind the given ForgotPasswordInfo",
+		})
+		return
+	}
+
+	responseMsg := "If the email is registered, a reset token has been sent to " + forgotInfo.Email
+
+	user, err := models.FindUserByEmail(forgotInfo.Email)
+
+	if err != nil || user == nil {
+		c.JSON(http.StatusOK, gin.H{
+			"msg": responseMsg,
+		})
+		return
+	}
+
+	// Whether the email is sent is not told, like whether the email exists
+	if _, err := sendPasswordReset(user); err != nil {
+		errStr := fmt.Sprintf("Cannot create the reset token: %+v", err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"err": errStr,
+			"msg": "Cannot create the reset token",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"msg": responseMsg,
+	})
+}
+
+// ResetPassword - Set a new password with the reset token from the email
+// Every session of the user will be revoked
+func ResetPassword(c *gin.Context) {
+	var resetInfo ResetPasswordInfo
+	err := c.ShouldBindJSON(&resetInfo)
+
+	if err != nil {
+		errStr := fmt.Sprintf("Cannot bind the given ResetPasswordInfo: %+v", err)
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"err": errStr,
+			"msg": "Cannot bind the given ResetPasswordInfo",
+		})
+		return
+	}
+
+	if len(resetInfo.NewPassword) < passwordMinLength {
+		errStr := fmt.Sprintf("The new password must have at least %d characters", passwordMinLength)
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"err": errStr,
+			"msg": errStr,
+		})
+		return
+	}
+
+	reset, err := models.UsePasswordResetByHash(utils.HashToken(resetInfo.Token))
+
+	if err != nil {
+		errStr := fmt.Sprintf("Cannot check the reset token: %+v", err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"err": errStr,
+			"msg": "Cannot check the reset token",
+		})
+		return
+	}
+
+	if reset == nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"err": "The reset token is not valid or has expired",
+			"msg": "The reset token is not valid or has expired",
+		})
+		return
+	}
+
+	_, err = models.UpdatePasswordByOID(reset.User, resetInfo.NewPassword)
+
+	if err != nil {
+		errStr := fmt.Sprintf("Cannot update the password: %+v", err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"err": errStr,
+			"msg": "Cannot update the password",
+		})
+		return
+	}
+
+	// Whoever can reset the password can unlock the account as well
+	if _, err := models.ResetFailedLogins(reset.User); err != nil {
+		log.Printf("Cannot reset the failed logins of %+v: %+v", reset.User, err)
+	}
+
+	_, err = models.RevokeSessionsForUser(reset.User, nil)
+
+	if err != nil {
+		errStr := fmt.Sprintf("Cannot revoke the sessions: %+v", err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"err": errStr,
+			"msg": "Cannot revoke the sessions",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"msg": "The password has been reset, please login again",
+	})
+}
+
+// Logout - Revoke the session of the current token
+func Logout(c *gin.Context) {
+	session := utils.GetSessionFromContext(c)
+
+	if session == nil {
+		return
+	}
+
+	_, err := models.RevokeSessionByOID(session.ID)
+
+	if err != nil {
+		errStr := fmt.Sprintf("Cannot revoke the session: %+v", err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"err": errStr,
+			"msg": "Cannot revoke the session",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"sid": session.ID,
+	})
+}
+
+// LogoutAll - Revoke every session of the user, including the current one
+func LogoutAll(c *gin.Context) {
+	user := utils.GetUserFromContext(c)
+
+	if user == nil {
+		return
+	}
+
+	result, err := models.RevokeSessionsForUser(user.ID, nil)
+
+	if err != nil {
+		errStr := fmt.Sprintf("Cannot revoke the sessions: %+v", err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"err": errStr,
+			"msg": "Cannot revoke the sessions",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"result": result,
+	})
+}
+
+// FindUserSessions - List the devices which are logged in
+func FindUserSessions(c *gin.Context) {
+	user := utils.GetUserFromContext(c)
+
+	if user == nil {
+		return
+	}
+
+	session := utils.GetSessionFromContext(c)
+
+	if session == nil {
+		return
+	}
+
+	sessions, err := models.FindActiveSessionsForUser(user.ID)
+
+	if err != nil {
+		errStr := fmt.Sprintf("Cannot find the sessions: %+v", err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"err": errStr,
+			"msg": "Cannot find the sessions",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"sessions": sessions,
+		"current":  session.ID,
+	})
+}
+
 /// the one only about user
 func ToggleFunc(field string) gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -444,8 +1114,6 @@ func SubscribeUser(c *gin.Context) {
 
 	ws, err := upGrader.Upgrade(c.Writer, c.Request, nil)
 
-	defer ws.Close()
-
 	if err != nil {
 		errStr := fmt.Sprintf("The websocket is not working due to the error: %+v \n", err)
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -454,24 +1122,31 @@ func SubscribeUser(c *gin.Context) {
 		return
 	}
 
-	for {
-		ok := stream.Next(context.TODO())
-		if ok {
-			next := stream.Current
+	defer ws.Close()
+
+	ctx, release := trackPresence(ws, user)
+	defer release()
 
-			var m map[string]interface{}
+	for stream.Next(ctx) {
+		next := stream.Current
 
-			err := bson.Unmarshal(next, &m)
-			if err != nil {
-				log.Print(err)
-				break
-			}
+		// Decoded to the User, so only the fields it shows are sent and the secrets never leave the server
+		var change struct {
+			FullDocument models.User `bson:"fullDocument"`
+		}
 
-			err = ws.WriteJSON(m["fullDocument"].(map[string]interface{}))
-			if err != nil {
-				log.Print(err)
-				break
-			}
+		err := bson.Unmarshal(next, &change)
+		if err != nil {
+			log.Print(err)
+			break
+		}
+
+		change.FullDocument.Password = ""
+
+		err = ws.WriteJSON(change.FullDocument)
+		if err != nil {
+			log.Print(err)
+			break
 		}
 	}
 }
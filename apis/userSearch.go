@@ -0,0 +1,122 @@
+package apis
+
+import (
+	"fmt"
+	"net/http"
+	"quenc/models"
+	"quenc/utils"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+)
+
+const (
+	userSearchDefaultLimit = 20
+	userSearchMaxLimit     = 50
+)
+
+// userSearchLimit - The given limit within userSearchMaxLimit
+func userSearchLimit(limit int) int {
+	if limit <= 0 {
+		return userSearchDefaultLimit
+	}
+	if limit > userSearchMaxLimit {
+		return userSearchMaxLimit
+	}
+	return limit
+}
+
+// SearchUsers - Find the users by ?name= prefix, ?major=, ?domain= and ?gender=, paginated with ?skip= and ?limit=
+func SearchUsers(c *gin.Context) {
+	filter := models.UserSearchFilter{
+		NamePrefix: c.Query("name"),
+		Major:      strings.TrimSpace(c.Query("major")),
+		Domain:     strings.TrimSpace(c.Query("domain")),
+	}
+
+	if genderStr := strings.TrimSpace(c.Query("gender")); genderStr != "" {
+		gender, err := strconv.Atoi(genderStr)
+
+		if err != nil {
+			errStr := fmt.Sprintf("Cannot convert the given gender: %+v", err)
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"err": errStr,
+				"msg": "Cannot convert the given gender",
+			})
+			return
+		}
+
+		filter.Gender = gender
+		filter.HasGender = true
+	}
+
+	if strings.TrimSpace(filter.NamePrefix) == "" && filter.Major == "" && filter.Domain == "" && !filter.HasGender {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"err": "At least one of name, major, domain and gender is required",
+			"msg": "At least one of name, major, domain and gender is required",
+		})
+		return
+	}
+
+	skip, limit, _, err := utils.GetSkipLimitSortFromContext(c)
+	if err != nil {
+		return
+	}
+
+	user := utils.GetUserFromContext(c)
+	if user == nil {
+		return
+	}
+
+	excluded, ok := findExcludedAuthors(c)
+	if !ok {
+		return
+	}
+
+	users, err := models.SearchUsers(user, &filter, excluded, *skip, userSearchLimit(*limit))
+
+	if err != nil {
+		errStr := fmt.Sprintf("Cannot search the users: %+v", err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"err": errStr,
+			"msg": "Cannot search the users",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"users": users,
+	})
+}
+
+// FindUserSuggestions - The people you may know, by the mutual friends and the shared major
+func FindUserSuggestions(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.Query("limit"))
+
+	user := utils.GetUserFromContext(c)
+	if user == nil {
+		return
+	}
+
+	excluded, ok := findExcludedAuthors(c)
+	if !ok {
+		return
+	}
+
+	suggestions, err := models.FindUserSuggestions(user, excluded, userSearchLimit(limit))
+
+	if err != nil {
+		errStr := fmt.Sprintf("Cannot find the suggestions: %+v", err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"err": errStr,
+			"msg": "Cannot find the suggestions",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"suggestions": suggestions,
+	})
+}
@@ -14,13 +14,25 @@ import (
 // DB - MongoDB database
 
 var (
-	DB                     *mongo.Database
-	PostCategoryCollection *mongo.Collection
-	CommentCollection      *mongo.Collection
-	PostCollection         *mongo.Collection
-	ReportCollection       *mongo.Collection
-	UserCollection         *mongo.Collection
-	ChatRoomCollection     *mongo.Collection
+	DB                      *mongo.Database
+	PostCategoryCollection  *mongo.Collection
+	CommentCollection       *mongo.Collection
+	PostCollection          *mongo.Collection
+	ReportCollection        *mongo.Collection
+	UserCollection          *mongo.Collection
+	ChatRoomCollection      *mongo.Collection
+	RefreshTokenCollection  *mongo.Collection
+	SessionCollection       *mongo.Collection
+	PasswordResetCollection *mongo.Collection
+	UniversityCollection    *mongo.Collection
+	LoginAuditCollection    *mongo.Collection
+
+	ModerationActionCollection *mongo.Collection
+	FriendRequestCollection    *mongo.Collection
+	MediaCollection            *mongo.Collection
+	AdminActionCollection      *mongo.Collection
+	SeenPostCollection         *mongo.Collection
+	PostRevisionCollection     *mongo.Collection
 )
 
 // InitDB - Initialise the database for MongoDB
@@ -51,5 +63,16 @@ func InitDB() {
 	ReportCollection = DB.Collection("report")
 	UserCollection = DB.Collection("user")
 	ChatRoomCollection = DB.Collection("chatRoom")
+	RefreshTokenCollection = DB.Collection("refreshToken")
+	SessionCollection = DB.Collection("session")
+	PasswordResetCollection = DB.Collection("passwordReset")
+	UniversityCollection = DB.Collection("university")
+	LoginAuditCollection = DB.Collection("loginAudit")
+	ModerationActionCollection = DB.Collection("moderationAction")
+	FriendRequestCollection = DB.Collection("friendRequest")
+	MediaCollection = DB.Collection("media")
+	AdminActionCollection = DB.Collection("adminAction")
+	SeenPostCollection = DB.Collection("seenPost")
+	PostRevisionCollection = DB.Collection("postRevision")
 
 }
@@ -0,0 +1,154 @@
+package mailer
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+/*
+	SMTP
+*/
+
+// SMTPMailer - Sending the emails through a SMTP server
+type SMTPMailer struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+// NewSMTPMailerFromEnv - Setting up the SMTPMailer, Gmail is used when SMTP_HOST is not given
+func NewSMTPMailerFromEnv() *SMTPMailer {
+	m := &SMTPMailer{
+		Host:     os.Getenv("SMTP_HOST"),
+		Port:     os.Getenv("SMTP_PORT"),
+		Username: os.Getenv("EMAIL_SENDING_USERNAME"),
+		Password: os.Getenv("EMAIL_SENDING_PASSWORD"),
+		From:     os.Getenv("MAIL_FROM"),
+	}
+
+	if strings.TrimSpace(m.Host) == "" {
+		m.Host = "smtp.gmail.com"
+	}
+
+	if strings.TrimSpace(m.Port) == "" {
+		m.Port = "587"
+	}
+
+	if strings.TrimSpace(m.From) == "" {
+		m.From = m.Username
+	}
+
+	return m
+}
+
+// Send - Send the Message to the SMTP server
+func (m *SMTPMailer) Send(msg *Message) error {
+	body, err := msg.Bytes(m.From)
+
+	if err != nil {
+		return err
+	}
+
+	plainAuth := smtp.PlainAuth("", m.Username, m.Password, m.Host)
+
+	// The envelope sender matches the From header, so the bounces go back to MAIL_FROM
+	return smtp.SendMail(m.Host+":"+m.Port, plainAuth, m.From, msg.To, body)
+}
+
+/*
+	Outbox
+*/
+
+// OutboxMailer - Writing the emails as .eml files to a local directory, for development
+type OutboxMailer struct {
+	Dir string
+}
+
+// NewOutboxMailer - Setting up the OutboxMailer writing to dir
+func NewOutboxMailer(dir string) *OutboxMailer {
+	return &OutboxMailer{Dir: dir}
+}
+
+// Send - Write the Message to the outbox directory
+func (m *OutboxMailer) Send(msg *Message) error {
+	if err := os.MkdirAll(m.Dir, 0755); err != nil {
+		return err
+	}
+
+	body, err := msg.Bytes("no-reply@quenc.local")
+
+	if err != nil {
+		return err
+	}
+
+	fileName := fmt.Sprintf("%s_%s.eml", msg.SentAt.Format("20060102T150405.000000000"), strings.Join(msg.To, "_"))
+
+	return ioutil.WriteFile(filepath.Join(m.Dir, fileName), body, 0644)
+}
+
+/*
+	Memory
+*/
+
+// MemoryMailer - Keeping the emails in memory so tests can assert on them
+type MemoryMailer struct {
+	mu       sync.Mutex
+	messages []Message
+}
+
+// NewMemoryMailer - Setting up an empty MemoryMailer
+func NewMemoryMailer() *MemoryMailer {
+	return &MemoryMailer{}
+}
+
+// Send - Capture the Message
+func (m *MemoryMailer) Send(msg *Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.messages = append(m.messages, *msg)
+
+	return nil
+}
+
+// Messages - Return a copy of every captured Message
+func (m *MemoryMailer) Messages() []Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	messages := make([]Message, len(m.messages))
+	copy(messages, m.messages)
+
+	return messages
+}
+
+// MessagesTo - Return the captured Messages sent to the address
+func (m *MemoryMailer) MessagesTo(address string) []Message {
+	var messages []Message
+
+	for _, msg := range m.Messages() {
+		for _, to := range msg.To {
+			if to == address {
+				messages = append(messages, msg)
+				break
+			}
+		}
+	}
+
+	return messages
+}
+
+// Reset - Remove every captured Message
+func (m *MemoryMailer) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.messages = nil
+}
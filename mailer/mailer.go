@@ -0,0 +1,122 @@
+package mailer
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/textproto"
+	"os"
+	"strings"
+	"time"
+)
+
+// Message - An email with both text and HTML bodies
+type Message struct {
+	To       []string  `json:"to"`
+	Subject  string    `json:"subject"`
+	TextBody string    `json:"textBody"`
+	HTMLBody string    `json:"htmlBody"`
+	SentAt   time.Time `json:"sentAt"`
+}
+
+// Mailer - Anything which can deliver a Message
+type Mailer interface {
+	Send(msg *Message) error
+}
+
+// DefaultMailer - The Mailer used by Send, set by InitMailer
+var DefaultMailer Mailer
+
+// InitMailer - Initialise the DefaultMailer from the environment variables
+// MAIL_BACKEND can be smtp (default), outbox or memory
+func InitMailer() {
+	switch strings.ToLower(strings.TrimSpace(os.Getenv("MAIL_BACKEND"))) {
+	case "outbox":
+		dir := os.Getenv("MAIL_OUTBOX_DIR")
+		if strings.TrimSpace(dir) == "" {
+			dir = "outbox"
+		}
+		DefaultMailer = NewOutboxMailer(dir)
+	case "memory":
+		DefaultMailer = NewMemoryMailer()
+	default:
+		DefaultMailer = NewSMTPMailerFromEnv()
+	}
+
+	fmt.Printf("Mailer initialised with %T\n", DefaultMailer)
+}
+
+// UseMemoryMailer - Replace the DefaultMailer with a MemoryMailer and return it, used in tests
+func UseMemoryMailer() *MemoryMailer {
+	m := NewMemoryMailer()
+	DefaultMailer = m
+	return m
+}
+
+// Send - Send the Message with the DefaultMailer
+func Send(msg *Message) error {
+	if DefaultMailer == nil {
+		return errors.New("the mailer is not initialised")
+	}
+
+	if len(msg.To) == 0 {
+		return errors.New("the message has no recipient")
+	}
+
+	msg.SentAt = time.Now()
+
+	return DefaultMailer.Send(msg)
+}
+
+// Bytes - Build the MIME (multipart/alternative) representation of the Message
+func (m *Message) Bytes(from string) ([]byte, error) {
+	var buf bytes.Buffer
+	writer := multipart.NewWriter(&buf)
+
+	fmt.Fprintf(&buf, "From: %s\r\n", from)
+	fmt.Fprintf(&buf, "To: %s\r\n", strings.Join(m.To, ", "))
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("UTF-8", m.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", m.SentAt.Format(time.RFC1123Z))
+	fmt.Fprintf(&buf, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&buf, "Content-Type: multipart/alternative; boundary=%s\r\n\r\n", writer.Boundary())
+
+	parts := []struct {
+		contentType string
+		body        string
+	}{
+		{"text/plain; charset=UTF-8", m.TextBody},
+		{"text/html; charset=UTF-8", m.HTMLBody},
+	}
+
+	for _, p := range parts {
+		if p.body == "" {
+			continue
+		}
+
+		header := textproto.MIMEHeader{}
+		header.Set("Content-Type", p.contentType)
+		header.Set("Content-Transfer-Encoding", "quoted-printable")
+
+		partWriter, err := writer.CreatePart(header)
+		if err != nil {
+			return nil, err
+		}
+
+		qp := quotedprintable.NewWriter(partWriter)
+		if _, err := qp.Write([]byte(p.body)); err != nil {
+			return nil, err
+		}
+		if err := qp.Close(); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
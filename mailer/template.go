@@ -0,0 +1,52 @@
+package mailer
+
+import (
+	"bytes"
+	htmlTemplate "html/template"
+	"os"
+	"path/filepath"
+	"strings"
+	textTemplate "text/template"
+)
+
+// templateDir - Where the email templates are, set by MAIL_TEMPLATE_DIR
+func templateDir() string {
+	if dir := strings.TrimSpace(os.Getenv("MAIL_TEMPLATE_DIR")); dir != "" {
+		return dir
+	}
+	return filepath.Join("templates", "email")
+}
+
+// Render - Render the email called name to a Message
+// <name>.txt.tmpl has to define a "subject" template, <name>.html.tmpl is the HTML body
+func Render(name string, data interface{}) (*Message, error) {
+	var subject, textBody, htmlBody bytes.Buffer
+
+	textTmpl, err := textTemplate.ParseFiles(filepath.Join(templateDir(), name+".txt.tmpl"))
+	if err != nil {
+		return nil, err
+	}
+
+	if err := textTmpl.ExecuteTemplate(&subject, "subject", data); err != nil {
+		return nil, err
+	}
+
+	if err := textTmpl.Execute(&textBody, data); err != nil {
+		return nil, err
+	}
+
+	htmlTmpl, err := htmlTemplate.ParseFiles(filepath.Join(templateDir(), name+".html.tmpl"))
+	if err != nil {
+		return nil, err
+	}
+
+	if err := htmlTmpl.Execute(&htmlBody, data); err != nil {
+		return nil, err
+	}
+
+	return &Message{
+		Subject:  strings.TrimSpace(subject.String()),
+		TextBody: strings.TrimSpace(textBody.String()) + "\r\n",
+		HTMLBody: htmlBody.String(),
+	}, nil
+}
@@ -1,8 +1,13 @@
 package main
 
 import (
+	"log"
 	"quenc/database"
+	"quenc/mailer"
+	"quenc/models"
 	"quenc/router"
+	"quenc/storage"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	_ "github.com/joho/godotenv/autoload"
@@ -11,6 +16,70 @@ import (
 func main() {
 
 	database.InitDB()
+	mailer.InitMailer()
+	storage.InitStorage()
+
+	if err := models.EnsureDefaultUniversities(); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := models.MigrateUserRoles(); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := models.EnsureFriendRequestIndexes(); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := models.EnsureUserIndexes(); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := models.EnsureLoginAuditIndexes(); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := models.MigrateUserSearchNames(); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := models.EnsureSearchIndexes(); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := models.MigrateSearchGrams(); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := models.EnsurePostScoreIndexes(); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := models.MigratePostScores(); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := models.EnsureFeedIndexes(); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := models.EnsureModerationIndexes(); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := models.EnsurePostRevisionIndexes(); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := models.MigratePostRevisionCounts(); err != nil {
+		log.Fatal(err)
+	}
+
+	// The accounts are deleted after the grace period
+	go models.RunAccountDeletions(time.Hour)
+	go models.RunPresenceSweeps(time.Minute)
+	go models.RunPostScoreUpdates(10 * time.Minute)
+
 	gin.ForceConsoleColor()
 	r := router.InitRouter()
 	r.Run()
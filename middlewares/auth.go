@@ -2,10 +2,12 @@ package middlewares
 
 import (
 	"fmt"
+	"log"
 	"net/http"
 	"os"
 	"quenc/models"
 	"strings"
+	"time"
 
 	"github.com/dgrijalva/jwt-go"
 	"github.com/gin-gonic/gin"
@@ -13,164 +15,326 @@ import (
 
 )
 
-func UserAuth() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		tokenStr := c.GetHeader("Authorization")
+// Error codes for the client to know how to react to a rejected token
+const (
+	ErrCodeTokenMissing      = "TOKEN_MISSING"
+	ErrCodeTokenExpired      = "TOKEN_EXPIRED" // the client should use the refresh token
+	ErrCodeTokenInvalid      = "TOKEN_INVALID"
+	ErrCodeSessionRevoked    = "SESSION_REVOKED"
+	ErrCodeUserNotFound      = "USER_NOT_FOUND"
+	ErrCodeUnauthorised      = "UNAUTHORISED"
+	ErrCodeAccountBanned     = "ACCOUNT_BANNED"
+	ErrCodeAccountSuspended  = "ACCOUNT_SUSPENDED"  // suspended accounts can only read
+	ErrCodeProfileIncomplete = "PROFILE_INCOMPLETE" // see /user/onboarding
+	// An admin has asked the user to reset the password, see /user/forgot-password
+	ErrCodePasswordResetRequired = "PASSWORD_RESET_REQUIRED"
+	// The moderator has to enrol or pass the two-factor authentication
+	ErrCodeTwoFactorRequired          = "TWO_FACTOR_REQUIRED"
+	ErrCodeTwoFactorEnrolmentRequired = "TWO_FACTOR_ENROLMENT_REQUIRED"
+)
 
-		if tokenStr == "" {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
-				"err":      "Token is not provided",
-				"msg":      "Token is not provided",
-				"tokenStr": tokenStr,
-			})
-			return
+// How often the lastUsedAt of a session is written
+const sessionTouchInterval = time.Minute
+
+// authenticate - Parse the token and find its user and session, the request is aborted when nil is returned
+// The bool tells whether both the token and the session have passed the two-factor authentication
+func authenticate(c *gin.Context) (*models.User, *models.Session, bool) {
+	return authenticateWith(c, c.AbortWithStatusJSON)
+}
+
+// authenticateWith - authenticate, with reject called instead of aborting when nil is returned
+func authenticateWith(c *gin.Context, reject func(code int, jsonObj interface{})) (*models.User, *models.Session, bool) {
+	tokenStr := c.GetHeader("Authorization")
+
+	if tokenStr == "" {
+		reject(http.StatusUnauthorized, gin.H{
+			"err":  "Token is not provided",
+			"msg":  "Token is not provided",
+			"code": ErrCodeTokenMissing,
+		})
+		return nil, nil, false
+	}
+
+	if s := strings.Split(tokenStr, " "); len(s) == 2 {
+		tokenStr = s[1]
+	}
+
+	token, err := jwt.Parse(tokenStr, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("Invalid Token")
 		}
 
-		if s := strings.Split(tokenStr, " "); len(s) == 2 {
-			tokenStr = s[1]
+		return []byte(os.Getenv("JWT_SECRET")), nil
+	})
+
+	if err != nil {
+		// Only report expired when the signature is fine
+		if vErr, ok := err.(*jwt.ValidationError); ok && vErr.Errors == jwt.ValidationErrorExpired {
+			reject(http.StatusUnauthorized, gin.H{
+				"err":  "The token is expired",
+				"msg":  "The token is expired",
+				"code": ErrCodeTokenExpired,
+			})
+			return nil, nil, false
 		}
 
-		token, _ := jwt.Parse(tokenStr, func(token *jwt.Token) (interface{}, error) {
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
-					"err":      "Invalid Token",
-					"msg":      "Cannot parse the given token",
-					"token":    token,
-					"tokenStr": tokenStr,
-				})
-				return nil, fmt.Errorf("Invalid Token")
-			}
+		errStr := fmt.Sprintf("The token is not valid: %+v", err)
+		reject(http.StatusUnauthorized, gin.H{
+			"err":  errStr,
+			"msg":  "The token is not valid",
+			"code": ErrCodeTokenInvalid,
+		})
+		return nil, nil, false
+	}
 
-			return []byte(os.Getenv("JWT_SECRET")), nil
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		reject(http.StatusUnauthorized, gin.H{
+			"err":  "The token is not valid",
+			"msg":  "The token is not valid",
+			"code": ErrCodeTokenInvalid,
 		})
+		return nil, nil, false
+	}
 
-		claims := token.Claims.(jwt.MapClaims)
+	inputClaim_userID, _ := claims["_id"].(string)
 
-		inputClaim_userID := claims["_id"].(string)
+	oid, err := primitive.ObjectIDFromHex(inputClaim_userID)
 
-		oid, err := primitive.ObjectIDFromHex(inputClaim_userID)
+	if err != nil {
+		errStr := fmt.Sprintf("Cannot get the ObejctId: %+v", err)
+		reject(http.StatusUnauthorized, gin.H{
+			"err":  errStr,
+			"id":   inputClaim_userID,
+			"code": ErrCodeTokenInvalid,
+		})
+		return nil, nil, false
+	}
 
-		if err != nil {
-			errStr := fmt.Sprintf("Cannot get the ObejctId: %+v", err)
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
-				"err": errStr,
-				"id":  inputClaim_userID,
-			})
+	inputClaim_sessionID, _ := claims["jti"].(string)
+
+	sOID, err := primitive.ObjectIDFromHex(inputClaim_sessionID)
+
+	if err != nil {
+		errStr := fmt.Sprintf("Cannot get the session ObejctId: %+v", err)
+		reject(http.StatusUnauthorized, gin.H{
+			"err":  errStr,
+			"jti":  inputClaim_sessionID,
+			"code": ErrCodeTokenInvalid,
+		})
+		return nil, nil, false
+	}
+
+	session, err := models.FindSessionByOID(sOID)
+
+	if err != nil || session.Revoked || session.User != oid {
+		reject(http.StatusUnauthorized, gin.H{
+			"err":  "The session has been revoked",
+			"msg":  "The session has been revoked",
+			"code": ErrCodeSessionRevoked,
+		})
+		return nil, nil, false
+	}
+
+	user, err := models.FindUserByOID(oid)
+
+	if err != nil {
+		errStr := fmt.Sprintf("Cannot find the user during authroization checking: %+v", err)
+		reject(http.StatusUnauthorized, gin.H{
+			"err":  errStr,
+			"msg":  "Cannot find the user during authroization checking",
+			"code": ErrCodeUserNotFound,
+		})
+		return nil, nil, false
+	}
+
+	// Not writing on every request
+	if time.Since(session.LastUsedAt) > sessionTouchInterval {
+		if _, err := models.TouchSession(session.ID); err != nil {
+			log.Printf("Cannot update the last used time of session %+v: %+v", session.ID, err)
 		}
+	}
 
-		user, err := models.FindUserByOID(oid)
+	// The requests keep the user online, the lastSeen is throttled the same way
+	if user.NeedsPresenceTouch() {
+		if _, err := models.TouchPresence(user.ID); err != nil {
+			log.Printf("Cannot update the presence of %+v: %+v", user.ID, err)
+		}
+	}
 
-		if err != nil {
-			errStr := fmt.Sprintf("Cannot find the user during authroization checking: %+v", err)
+	twoFactor, _ := claims["mfa"].(bool)
 
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
-				"err":      errStr,
-				"msg":      "Cannot find the user during authroization checking",
-				"token":    token,
-				"tokenStr": tokenStr,
-			})
+	return user, session, twoFactor && session.TwoFactor
+}
+
+// The requests a suspended user can still make besides reading
+var suspendedAllowedPaths = map[string]bool{
+	"/user/logout":     true,
+	"/user/logout-all": true,
+}
+
+// enforceRestriction - Reject banned users, and the writes of suspended users
+// false is returned when the request has been aborted
+func enforceRestriction(c *gin.Context, user *models.User) bool {
+	if user.IsBanned() {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+			"err":         "The account has been banned",
+			"msg":         "The account has been banned",
+			"restriction": user.Restriction,
+			"code":        ErrCodeAccountBanned,
+		})
+		return false
+	}
+
+	if !user.IsSuspended() {
+		return true
+	}
+
+	switch c.Request.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+
+	if suspendedAllowedPaths[c.FullPath()] {
+		return true
+	}
+
+	c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+		"err":         "The account has been suspended, it can only read",
+		"msg":         "The account has been suspended, it can only read",
+		"restriction": user.Restriction,
+		"code":        ErrCodeAccountSuspended,
+	})
+	return false
+}
+
+func UserAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, session, twoFactor := authenticate(c)
+
+		if user == nil || !enforceRestriction(c, user) {
 			return
 		}
 
 		c.Set("user", user)
+		c.Set("session", session)
+		c.Set("twoFactor", twoFactor)
+
+		c.Next()
 
-		if !token.Valid {
-			c.AbortWithStatusJSON(
-				http.StatusUnauthorized,
-				gin.H{
-					"token":    token,
-					"tokenStr": tokenStr,
-					"err":      "The token is not valid",
-					"msg":      "The token is not valid",
-				},
-			)
+	}
+
+}
+
+// OptionalUserAuth - The guests can pass, the users are authenticated like UserAuth
+// A missing, invalid or expired token is taken as a guest, so a stale token never locks the client out of the public pages
+func OptionalUserAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetHeader("Authorization") == "" {
+			c.Next()
 			return
 		}
 
-		c.Next()
+		user, session, twoFactor := authenticateWith(c, func(int, interface{}) {})
+
+		if user == nil {
+			c.Next()
+			return
+		}
+
+		if !enforceRestriction(c, user) {
+			return
+		}
+
+		c.Set("user", user)
+		c.Set("session", session)
+		c.Set("twoFactor", twoFactor)
 
+		c.Next()
 	}
 
 }
 
-func AdminAuth() gin.HandlerFunc {
+// RequirePermission - Only the users with all the permissions can pass
+// Category moderators pass with their scoped permissions, the handler has to check the category of the content
+// The moderation permissions also require the two-factor authentication
+func RequirePermission(permissions ...string) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		tokenStr := c.GetHeader("Authorization")
+		user, session, twoFactor := authenticate(c)
 
-		if tokenStr == "" {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
-				"err":      "Token is not provided",
-				"msg":      "Token is not provided",
-				"tokenStr": tokenStr,
-			})
+		if user == nil || !enforceRestriction(c, user) {
 			return
 		}
 
-		if s := strings.Split(tokenStr, " "); len(s) == 2 {
-			tokenStr = s[1]
-		}
+		needTwoFactor := false
 
-		token, _ := jwt.Parse(tokenStr, func(token *jwt.Token) (interface{}, error) {
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+		for _, permission := range permissions {
+			if !user.HasPermissionInAnyCategory(permission) {
+				errStr := fmt.Sprintf("Unauthorised, %s is required", permission)
 				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
-					"err":      "Invalid Token",
-					"msg":      "Cannot parse the given token",
-					"token":    token,
-					"tokenStr": tokenStr,
+					"err":        errStr,
+					"permission": permission,
+					"code":       ErrCodeUnauthorised,
 				})
-				return nil, fmt.Errorf("Invalid Token")
+				return
 			}
 
-			return []byte(os.Getenv("JWT_SECRET")), nil
-		})
-
-		claims := token.Claims.(jwt.MapClaims)
-
-		inputClaim_userID := claims["_id"].(string)
-
-		oid, err := primitive.ObjectIDFromHex(inputClaim_userID)
+			if models.IsModerationPermission(permission) {
+				needTwoFactor = true
+			}
+		}
 
-		if err != nil {
-			errStr := fmt.Sprintf("Cannot get the ObejctId: %+v", err)
+		if needTwoFactor && !user.TwoFactorEnabled {
 			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
-				"err": errStr,
-				"id":  inputClaim_userID,
+				"err":  "Please enable the two-factor authentication first",
+				"msg":  "Please enable the two-factor authentication first",
+				"code": ErrCodeTwoFactorEnrolmentRequired,
 			})
+			return
 		}
 
-		user, err := models.FindUserByOID(oid)
-
-		if err != nil {
+		if needTwoFactor && !twoFactor {
 			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
-				"err":      err,
-				"msg":      "Cannot find the user during authroization checking",
-				"token":    token,
-				"tokenStr": tokenStr,
+				"err":  "Please login with the two-factor authentication",
+				"msg":  "Please login with the two-factor authentication",
+				"code": ErrCodeTwoFactorRequired,
 			})
 			return
 		}
 
-		if !user.IsAmin() {
-			errStr := fmt.Sprintf("Unauthorised")
+		c.Set("user", user)
+		c.Set("session", session)
+		c.Set("twoFactor", twoFactor)
+
+		c.Next()
+
+	}
+
+}
+
+// RequireCompleteProfile - Only the users who have filled in the required profile fields can pass
+// It has to come after UserAuth or RequirePermission
+func RequireCompleteProfile() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		value, _ := c.Get("user")
+		user, ok := value.(*models.User)
+
+		if !ok {
 			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
-				"err":  errStr,
-				"user": user,
+				"err":  "Cannot find the user",
+				"msg":  "Cannot find the user",
+				"code": ErrCodeUserNotFound,
 			})
 			return
 		}
 
-		c.Set("user", user)
-
-		if !token.Valid {
-			c.AbortWithStatusJSON(
-				http.StatusUnauthorized,
-				gin.H{
-					"token":    token,
-					"tokenStr": tokenStr,
-					"err":      "The token is not valid",
-					"msg":      "The token is not valid",
-				},
-			)
+		if missing := user.MissingProfileFields(); len(missing) > 0 {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"err":     "Please complete the profile first",
+				"msg":     "Please complete the profile first",
+				"missing": missing,
+				"code":    ErrCodeProfileIncomplete,
+			})
 			return
 		}
 
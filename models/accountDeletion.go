@@ -0,0 +1,338 @@
+package models
+
+import (
+	"context"
+	"log"
+	"quenc/database"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+)
+
+// AccountDeletionGracePeriod - How long the User can cancel the deletion
+const AccountDeletionGracePeriod = 14 * 24 * time.Hour
+
+// What happens to each type of content when the account is deleted
+const (
+	DeletionAnonymise = "anonymise" // kept, but no longer linked to the User
+	DeletionDelete    = "delete"
+)
+
+// DeletedUserOID - The author of the anonymised content, no User has this OID
+var DeletedUserOID = primitive.NilObjectID
+
+// AccountDeletion - The deletion requested by the User, stored in the User
+type AccountDeletion struct {
+	Posts       string    `json:"posts" bson:"posts"`
+	Comments    string    `json:"comments" bson:"comments"`
+	Messages    string    `json:"messages" bson:"messages"`
+	RequestedAt time.Time `json:"requestedAt" bson:"requestedAt"`
+	ScheduledAt time.Time `json:"scheduledAt" bson:"scheduledAt"` // the end of the grace period
+}
+
+// IsValidDeletionChoice - Whether the choice is anonymise or delete
+func IsValidDeletionChoice(choice string) bool {
+	return choice == DeletionAnonymise || choice == DeletionDelete
+}
+
+// ScheduleAccountDeletion - Start the grace period, replacing the earlier request
+func ScheduleAccountDeletion(uOID primitive.ObjectID, deletion *AccountDeletion) (*mongo.UpdateResult, error) {
+	return database.UserCollection.UpdateOne(
+		context.TODO(),
+		bson.M{"_id": uOID},
+		bson.M{"$set": bson.M{"deletion": deletion}},
+	)
+}
+
+// CancelAccountDeletion - Keep the account, only works in the grace period
+func CancelAccountDeletion(uOID primitive.ObjectID) (*mongo.UpdateResult, error) {
+	return database.UserCollection.UpdateOne(
+		context.TODO(),
+		bson.M{"_id": uOID, "deletion": bson.M{"$exists": true}},
+		bson.M{"$unset": bson.M{"deletion": ""}},
+	)
+}
+
+// DeleteDueAccounts - Delete every account whose grace period has ended
+func DeleteDueAccounts() error {
+	users, err := FindUsers(bson.M{"deletion.scheduledAt": bson.M{"$lte": time.Now()}})
+
+	if err != nil {
+		return err
+	}
+
+	for _, user := range users {
+		if err := DeleteAccount(user, user.Deletion); err != nil {
+			log.Printf("Cannot delete the account %+v: %+v", user.ID, err)
+		}
+	}
+
+	return nil
+}
+
+// RunAccountDeletions - Delete the due accounts every interval, it never returns
+func RunAccountDeletions(interval time.Duration) {
+	for {
+		if err := DeleteDueAccounts(); err != nil {
+			log.Printf("Cannot delete the due accounts: %+v", err)
+		}
+		time.Sleep(interval)
+	}
+}
+
+// DeleteAccount - Delete the User, and anonymise or delete the content as chosen
+// Everything else linking to the User is removed, the User document goes last so a failure can be retried
+func DeleteAccount(user *User, deletion *AccountDeletion) error {
+	uOID := user.ID
+
+	if deletion == nil {
+		deletion = &AccountDeletion{Posts: DeletionAnonymise, Comments: DeletionAnonymise, Messages: DeletionAnonymise}
+	}
+
+	if err := deleteAccountPosts(uOID, deletion.Posts); err != nil {
+		return err
+	}
+
+	if err := deleteAccountComments(uOID, deletion.Comments); err != nil {
+		return err
+	}
+
+	if err := deleteAccountMessages(uOID, deletion.Messages); err != nil {
+		return err
+	}
+
+	// The reports are kept for the moderators, without the reporter
+	if _, err := database.ReportCollection.UpdateMany(
+		context.TODO(),
+		bson.M{"author": uOID},
+		bson.M{"$set": bson.M{"author": DeletedUserOID}},
+	); err != nil {
+		return err
+	}
+
+	// The edits are kept in the revisions, without the editor
+	if _, err := database.PostRevisionCollection.UpdateMany(
+		context.TODO(),
+		bson.M{"editor": uOID},
+		bson.M{"$set": bson.M{"editor": DeletedUserOID}},
+	); err != nil {
+		return err
+	}
+
+	// The moderation history is kept without the User, so a ban still holds if the email signs up again
+	if _, err := AnonymiseModerationActions(uOID, user.Email); err != nil {
+		return err
+	}
+
+	if err := AnonymiseAdminActions(uOID); err != nil {
+		return err
+	}
+
+	if _, err := database.PostCollection.UpdateMany(context.TODO(), bson.M{"likers": uOID}, bson.M{"$pull": bson.M{"likers": uOID}}); err != nil {
+		return err
+	}
+
+	if _, err := database.CommentCollection.UpdateMany(context.TODO(), bson.M{"likers": uOID}, bson.M{"$pull": bson.M{"likers": uOID}}); err != nil {
+		return err
+	}
+
+	if _, err := database.UserCollection.UpdateMany(context.TODO(), bson.M{"friends": uOID}, bson.M{"$pull": bson.M{"friends": uOID}}); err != nil {
+		return err
+	}
+
+	if _, err := database.UserCollection.UpdateMany(context.TODO(), bson.M{"blockedUsers": uOID}, bson.M{"$pull": bson.M{"blockedUsers": uOID}}); err != nil {
+		return err
+	}
+
+	if _, err := database.UserCollection.UpdateMany(context.TODO(), bson.M{"followedAuthors": uOID}, bson.M{"$pull": bson.M{"followedAuthors": uOID}}); err != nil {
+		return err
+	}
+
+	if _, err := database.FriendRequestCollection.DeleteMany(context.TODO(), bson.M{"$or": bson.A{bson.M{"from": uOID}, bson.M{"to": uOID}}}); err != nil {
+		return err
+	}
+
+	if err := DeleteMediaOfOwner(uOID); err != nil {
+		return err
+	}
+
+	for _, collection := range []*mongo.Collection{
+		database.SessionCollection,
+		database.RefreshTokenCollection,
+		database.PasswordResetCollection,
+		database.SeenPostCollection,
+	} {
+		if _, err := collection.DeleteMany(context.TODO(), bson.M{"user": uOID}); err != nil {
+			return err
+		}
+	}
+
+	// The failed attempts with the email have no User, they are recorded with the normalised email
+	if _, err := database.LoginAuditCollection.DeleteMany(context.TODO(), bson.M{"$or": bson.A{
+		bson.M{"user": uOID},
+		bson.M{"email": strings.ToLower(strings.TrimSpace(user.Email))},
+	}}); err != nil {
+		return err
+	}
+
+	return DeleteUserByOID(uOID)
+}
+
+func deleteAccountPosts(uOID primitive.ObjectID, choice string) error {
+	if choice != DeletionDelete {
+		_, err := database.PostCollection.UpdateMany(
+			context.TODO(),
+			bson.M{"author": uOID},
+			bson.M{"$set": bson.M{"author": DeletedUserOID, "anonymous": true}},
+		)
+		return err
+	}
+
+	posts, err := FindPosts(bson.M{"author": uOID}, options.Find().SetProjection(bson.M{"_id": 1}))
+
+	if err != nil {
+		return err
+	}
+
+	pOIDs := []primitive.ObjectID{}
+	for _, post := range posts {
+		pOIDs = append(pOIDs, post.ID)
+	}
+
+	if len(pOIDs) == 0 {
+		return nil
+	}
+
+	comments, err := FindComments(bson.M{"belongPost": bson.M{"$in": pOIDs}}, options.Find().SetProjection(bson.M{"_id": 1}))
+
+	if err != nil {
+		return err
+	}
+
+	// The reports of the deleted posts and of their comments have nothing left to point to
+	reported := pOIDs
+	for _, comment := range comments {
+		reported = append(reported, comment.ID)
+	}
+
+	if _, err := database.ReportCollection.DeleteMany(context.TODO(), bson.M{"reportId": bson.M{"$in": reported}}); err != nil {
+		return err
+	}
+
+	if _, err := database.CommentCollection.DeleteMany(context.TODO(), bson.M{"belongPost": bson.M{"$in": pOIDs}}); err != nil {
+		return err
+	}
+
+	if err := DeletePostRevisions(pOIDs); err != nil {
+		return err
+	}
+
+	// Nobody can open the deleted posts again, from their saved posts or from the feed
+	if _, err := database.UserCollection.UpdateMany(
+		context.TODO(),
+		bson.M{"savedPosts": bson.M{"$in": pOIDs}},
+		bson.M{"$pull": bson.M{"savedPosts": bson.M{"$in": pOIDs}}},
+	); err != nil {
+		return err
+	}
+
+	if _, err := database.SeenPostCollection.DeleteMany(context.TODO(), bson.M{"post": bson.M{"$in": pOIDs}}); err != nil {
+		return err
+	}
+
+	_, err = database.PostCollection.DeleteMany(context.TODO(), bson.M{"_id": bson.M{"$in": pOIDs}})
+	return err
+}
+
+func deleteAccountComments(uOID primitive.ObjectID, choice string) error {
+	if choice != DeletionDelete {
+		_, err := database.CommentCollection.UpdateMany(
+			context.TODO(),
+			bson.M{"author": uOID},
+			bson.M{"$set": bson.M{"author": DeletedUserOID}},
+		)
+		return err
+	}
+
+	comments, err := FindComments(bson.M{"author": uOID}, options.Find().SetProjection(bson.M{"_id": 1, "belongPost": 1}))
+
+	if err != nil {
+		return err
+	}
+
+	cOIDs := []primitive.ObjectID{}
+	commentsOfPosts := map[primitive.ObjectID]int{}
+	for _, comment := range comments {
+		cOIDs = append(cOIDs, comment.ID)
+		commentsOfPosts[comment.BelongPost]++
+	}
+
+	if len(cOIDs) == 0 {
+		return nil
+	}
+
+	if _, err := database.ReportCollection.DeleteMany(context.TODO(), bson.M{"reportId": bson.M{"$in": cOIDs}}); err != nil {
+		return err
+	}
+
+	if _, err := database.CommentCollection.DeleteMany(context.TODO(), bson.M{"_id": bson.M{"$in": cOIDs}}); err != nil {
+		return err
+	}
+
+	// The comment counts are only recounted by the migration, so they are lowered like DeleteCommentByOID does
+	for pOID, count := range commentsOfPosts {
+		if err := addPostEngagement(pOID, "commentCount", -count, PostScoreCommentWeight); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// deleteAccountMessages - Handle the messages, then leave every chat room and remove the empty ones
+func deleteAccountMessages(uOID primitive.ObjectID, choice string) error {
+	var err error
+
+	if choice == DeletionDelete {
+		_, err = database.ChatRoomCollection.UpdateMany(
+			context.TODO(),
+			bson.M{"messages.author": uOID},
+			bson.M{"$pull": bson.M{"messages": bson.M{"author": uOID}}},
+		)
+	} else {
+		_, err = database.ChatRoomCollection.UpdateMany(
+			context.TODO(),
+			bson.M{"messages.author": uOID},
+			bson.M{"$set": bson.M{"messages.$[m].author": DeletedUserOID}},
+			options.Update().SetArrayFilters(options.ArrayFilters{Filters: []interface{}{bson.M{"m.author": uOID}}}),
+		)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if _, err := database.ChatRoomCollection.UpdateMany(
+		context.TODO(),
+		bson.M{"$or": bson.A{bson.M{"messages.likeBy": uOID}, bson.M{"messages.readBy": uOID}}},
+		bson.M{"$pull": bson.M{"messages.$[].likeBy": uOID, "messages.$[].readBy": uOID}},
+	); err != nil {
+		return err
+	}
+
+	if _, err := database.ChatRoomCollection.UpdateMany(
+		context.TODO(),
+		bson.M{"members": uOID},
+		bson.M{"$pull": bson.M{"members": uOID}},
+	); err != nil {
+		return err
+	}
+
+	_, err = database.ChatRoomCollection.DeleteMany(context.TODO(), bson.M{"members": bson.M{"$size": 0}})
+	return err
+}
@@ -0,0 +1,25 @@
+package models
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSendingAccountDeletionEmail(t *testing.T) {
+	m := useTestMailer(t)
+	user := &User{Email: "student@example.edu"}
+	scheduledAt := time.Date(2020, time.March, 4, 5, 6, 0, 0, time.UTC)
+
+	if err := SendingAccountDeletionEmail(user, scheduledAt); err != nil {
+		t.Fatalf("SendingAccountDeletionEmail: %+v", err)
+	}
+
+	msg := onlyMessageTo(t, m, user.Email)
+
+	if !strings.Contains(msg.Subject, "Your QuenC account will be deleted") {
+		t.Errorf("Unexpected subject %q", msg.Subject)
+	}
+
+	assertBodiesContain(t, msg, user.Email, "2020-03-04 05:06 UTC")
+}
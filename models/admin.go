@@ -0,0 +1,204 @@
+package models
+
+import (
+	"context"
+	"quenc/database"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+)
+
+// Actions of the AdminActions
+const (
+	AdminActionVerifyEmail   = "user.verifyEmail"
+	AdminActionSetRoles      = "user.setRoles"
+	AdminActionPasswordReset = "user.passwordReset"
+	AdminActionGrantRole     = "role.grant"
+	AdminActionRevokeRole    = "role.revoke"
+	AdminActionSuspend       = "moderation.suspend"
+	AdminActionBan           = "moderation.ban"
+	AdminActionLift          = "moderation.lift"
+	AdminActionRestorePost   = "post.restoreRevision"
+)
+
+// The AdminActions of the ModerationActions
+var moderationAdminActions = map[string]string{
+	ModerationSuspend: AdminActionSuspend,
+	ModerationBan:     AdminActionBan,
+	ModerationLift:    AdminActionLift,
+}
+
+// AdminAction - AdminAction Schema, the audit trail of what the admins have done
+type AdminAction struct {
+	ID        primitive.ObjectID     `json:"_id" bson:"_id,omitempty"`
+	Admin     primitive.ObjectID     `json:"admin" bson:"admin"`
+	Target    *primitive.ObjectID    `json:"target" bson:"target"` // the User the action is done to, the author for the posts
+	Action    string                 `json:"action" bson:"action"`
+	Detail    map[string]interface{} `json:"detail" bson:"detail,omitempty"` // the values before and after the change
+	IP        string                 `json:"ip" bson:"ip"`
+	Failed    bool                   `json:"failed" bson:"failed,omitempty"` // recorded before it was done, then it failed
+	CreatedAt time.Time              `json:"createdAt" bson:"createdAt"`
+}
+
+// UserContentCounts - How much the User has created, for the user detail of admin
+type UserContentCounts struct {
+	Posts             int64 `json:"posts"`
+	Comments          int64 `json:"comments"`
+	Reports           int64 `json:"reports"`
+	Friends           int64 `json:"friends"`
+	ChatRooms         int64 `json:"chatRooms"`
+	ModerationActions int64 `json:"moderationActions"`
+}
+
+// AdminActionOfModeration - The action of the audit trail for the type of ModerationAction
+func AdminActionOfModeration(moderationType string) string {
+	return moderationAdminActions[moderationType]
+}
+
+// AddAdminAction - Adding AdminAction to MongoDB
+func AddAdminAction(inputAction *AdminAction) (interface{}, error) {
+
+	result, err := database.AdminActionCollection.InsertOne(context.TODO(), inputAction)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return result.InsertedID, nil
+}
+
+// AnonymiseAdminActions - Keep the audit trail of a deleted User under DeletedUserOID, as the admin or as the target
+// The email recorded in the detail of the actions done to the User goes too
+func AnonymiseAdminActions(uOID primitive.ObjectID) error {
+	if _, err := database.AdminActionCollection.UpdateMany(
+		context.TODO(),
+		bson.M{"admin": uOID},
+		bson.M{"$set": bson.M{"admin": DeletedUserOID}},
+	); err != nil {
+		return err
+	}
+
+	_, err := database.AdminActionCollection.UpdateMany(
+		context.TODO(),
+		bson.M{"target": uOID},
+		bson.M{"$set": bson.M{"target": DeletedUserOID}, "$unset": bson.M{"detail.email": ""}},
+	)
+	return err
+}
+
+// MarkAdminActionFailed - The recorded action has not been done
+func MarkAdminActionFailed(oid primitive.ObjectID) (*mongo.UpdateResult, error) {
+	return database.AdminActionCollection.UpdateOne(context.TODO(), bson.M{"_id": oid}, bson.M{"$set": bson.M{"failed": true}})
+}
+
+// FindAdminActions - Find Multiple AdminActions by filterDetail
+func FindAdminActions(filterDetail bson.M, findOptions *options.FindOptions) ([]*AdminAction, error) {
+	var actions []*AdminAction
+	result, err := database.AdminActionCollection.Find(context.TODO(), filterDetail, findOptions)
+	if result != nil {
+		defer result.Close(context.TODO())
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	for result.Next(context.TODO()) {
+		var elem AdminAction
+		err := result.Decode(&elem)
+		if err != nil {
+			return nil, err
+		}
+		actions = append(actions, &elem)
+	}
+
+	return actions, nil
+}
+
+// FindUsersWithOptions - Find Multiple Users by filterDetail with the paging and sorting of findOptions
+func FindUsersWithOptions(filterDetail bson.M, findOptions *options.FindOptions) ([]*User, error) {
+	var users []*User
+	result, err := database.UserCollection.Find(context.TODO(), filterDetail,
+		findOptions.SetProjection(projectionForRemovingPassword))
+	if result != nil {
+		defer result.Close(context.TODO())
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	for result.Next(context.TODO()) {
+		var elem User
+		err := result.Decode(&elem)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, &elem)
+	}
+
+	return users, nil
+}
+
+// CountUsers - How many Users match the filterDetail
+func CountUsers(filterDetail bson.M) (int64, error) {
+	return database.UserCollection.CountDocuments(context.TODO(), filterDetail)
+}
+
+// BannedFilter - Match the Users who are banned, or the ones who are not
+func BannedFilter(banned bool) bson.M {
+	if banned {
+		return bson.M{"restriction.type": ModerationBan}
+	}
+	return bson.M{"restriction.type": bson.M{"$ne": ModerationBan}}
+}
+
+// CountUserContent - Count the content of the User
+func CountUserContent(user *User) (*UserContentCounts, error) {
+	counts := UserContentCounts{
+		Friends:   int64(len(user.Friends)),
+		ChatRooms: int64(len(user.ChatRooms)),
+	}
+
+	for _, count := range []struct {
+		collection *mongo.Collection
+		filter     bson.M
+		to         *int64
+	}{
+		{database.PostCollection, bson.M{"author": user.ID}, &counts.Posts},
+		{database.CommentCollection, bson.M{"author": user.ID}, &counts.Comments},
+		{database.ReportCollection, bson.M{"author": user.ID}, &counts.Reports},
+		{database.ModerationActionCollection, bson.M{"user": user.ID}, &counts.ModerationActions},
+	} {
+		n, err := count.collection.CountDocuments(context.TODO(), count.filter)
+
+		if err != nil {
+			return nil, err
+		}
+
+		*count.to = n
+	}
+
+	return &counts, nil
+}
+
+// VerifyUserEmailByOID - Verify the email without the token, the pending token can't be used anymore
+func VerifyUserEmailByOID(uOID primitive.ObjectID) (*mongo.UpdateResult, error) {
+	return database.UserCollection.UpdateOne(
+		context.TODO(),
+		bson.M{"_id": uOID},
+		bson.M{
+			"$set":   bson.M{"emailVerified": true},
+			"$unset": bson.M{"emailVerificationTokenHash": "", "emailVerificationExpiresAt": ""},
+		},
+	)
+}
+
+// RequirePasswordReset - Refuse the login of the User until the password is reset, see UpdatePasswordByOID
+func RequirePasswordReset(uOID primitive.ObjectID) (*mongo.UpdateResult, error) {
+	return UpdateUserByOID(uOID, bson.M{"passwordResetRequired": true})
+}
@@ -0,0 +1,135 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"quenc/database"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+)
+
+// ErrBlockedUser - One of the two Users has blocked the other
+var ErrBlockedUser = errors.New("the user has blocked or been blocked by the other user")
+
+// What the blocked-users list shows of each User
+var projectionForBlockedUser = bson.M{"_id": 1, "name": 1, "photoURL": 1}
+
+// HasBlocked - Whether the User has blocked the other User
+func (u *User) HasBlocked(oid primitive.ObjectID) bool {
+	for _, blocked := range u.BlockedUsers {
+		if blocked == oid {
+			return true
+		}
+	}
+	return false
+}
+
+// BlockUser - Add the other User to the blocked users
+func BlockUser(uOID primitive.ObjectID, blockedOID primitive.ObjectID) (*mongo.UpdateResult, error) {
+	return database.UserCollection.UpdateOne(
+		context.TODO(),
+		bson.M{"_id": uOID},
+		bson.M{"$addToSet": bson.M{"blockedUsers": blockedOID}},
+	)
+}
+
+// UnblockUser - Remove the other User from the blocked users
+func UnblockUser(uOID primitive.ObjectID, blockedOID primitive.ObjectID) (*mongo.UpdateResult, error) {
+	return database.UserCollection.UpdateOne(
+		context.TODO(),
+		bson.M{"_id": uOID},
+		bson.M{"$pull": bson.M{"blockedUsers": blockedOID}},
+	)
+}
+
+// FindBlockedUsers - The Users blocked by the User, only with the name and photo
+func FindBlockedUsers(user *User) ([]*User, error) {
+	var users []*User
+
+	if len(user.BlockedUsers) == 0 {
+		return []*User{}, nil
+	}
+
+	result, err := database.UserCollection.Find(
+		context.TODO(),
+		bson.M{"_id": bson.M{"$in": user.BlockedUsers}},
+		options.Find().SetProjection(projectionForBlockedUser),
+	)
+	if result != nil {
+		defer result.Close(context.TODO())
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = result.All(context.TODO(), &users)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
+
+// FindBlockRelatedUsers - The Users the User has blocked or been blocked by, their content is hidden from the User
+func FindBlockRelatedUsers(user *User) ([]primitive.ObjectID, error) {
+	related := append([]primitive.ObjectID{}, user.BlockedUsers...)
+
+	result, err := database.UserCollection.Find(
+		context.TODO(),
+		bson.M{"blockedUsers": user.ID},
+		options.Find().SetProjection(bson.M{"_id": 1}),
+	)
+	if result != nil {
+		defer result.Close(context.TODO())
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	for result.Next(context.TODO()) {
+		var elem User
+		err := result.Decode(&elem)
+		if err != nil {
+			return nil, err
+		}
+		if !user.HasBlocked(elem.ID) {
+			related = append(related, elem.ID)
+		}
+	}
+
+	return related, nil
+}
+
+// IsBlockedBetween - Whether the User has blocked or been blocked by any of the others
+func IsBlockedBetween(uOID primitive.ObjectID, others []primitive.ObjectID) (bool, error) {
+	count, err := database.UserCollection.CountDocuments(context.TODO(), bson.M{
+		"$or": bson.A{
+			bson.M{"_id": uOID, "blockedUsers": bson.M{"$in": others}},
+			bson.M{"_id": bson.M{"$in": others}, "blockedUsers": uOID},
+		},
+	})
+
+	if err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
+}
+
+// excludeAuthorsStage - The stage filtering out the content of the authors, nil if there is none
+func excludeAuthorsStage(excludedAuthors []primitive.ObjectID) []bson.M {
+	if len(excludedAuthors) == 0 {
+		return nil
+	}
+
+	return []bson.M{
+		bson.M{"$match": bson.M{"author": bson.M{"$nin": excludedAuthors}}},
+	}
+}
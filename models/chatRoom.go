@@ -26,6 +26,9 @@ type ChatRoomAdding struct {
 	Midx          int                  `json:"midx" bson:"midx"`
 }
 
+// ChatRoomSortLatestMessage - The order of the chat room listings, the room with the latest message first
+var ChatRoomSortLatestMessage = CursorSort{Field: "lastMessageAt", Order: -1}
+
 // After Populating
 type ChatRoomDetail struct {
 	ID            primitive.ObjectID `json:"_id" bson:"_id,omitempty"`
@@ -35,6 +38,7 @@ type ChatRoomDetail struct {
 	IsGroup       bool               `json:"isGroup" bson:"isGroup"`
 	GroupName     string             `json:"groupName" bson:"groupName"`
 	GroupPhotoUrl string             `json:"groupPhotoUrl" bson:"groupPhotoUrl"`
+	LastMessageAt time.Time          `json:"lastMessageAt" bson:"lastMessageAt"` // the createdAt when there is no message
 }
 
 // GroupChatRoom will generate a ID and the normal chatRoom will use the members' id
@@ -107,8 +111,11 @@ func FindChatRoomByOID(oid primitive.ObjectID) (*ChatRoomAdding, error) {
 
 // Find the chatroom without messages
 // showing what's in the chatroom to customer
-func FindChatRoomDetailWithLastMessage(matchingCond *[]bson.M, skip int, limit int) ([]*ChatRoomDetail, error) { // will populate members
-	var chatRooms []*ChatRoomDetail
+
+// FindChatRoomDetailWithLastMessage - The chat rooms with the members populated, the latest message first
+// The page continues after its cursor
+func FindChatRoomDetailWithLastMessage(matchingCond *[]bson.M, page *PageQuery) ([]*ChatRoomDetail, *PageInfo, error) { // will populate members
+	chatRooms := []*ChatRoomDetail{}
 
 	var pipeline = []bson.M{}
 
@@ -117,13 +124,23 @@ func FindChatRoomDetailWithLastMessage(matchingCond *[]bson.M, skip int, limit i
 		pipeline = append(pipeline, *matchingCond...)
 	}
 
-	pipeline = append(pipeline, []bson.M{
-
-		bson.M{
-			"$sort": bson.M{
-				"messages.createdAt": -1,
-			},
+	// The rooms without messages are ordered by their creation
+	pipeline = append(pipeline, bson.M{
+		"$addFields": bson.M{
+			"lastMessageAt": bson.M{"$ifNull": bson.A{bson.M{"$max": "$messages.createdAt"}, "$createdAt"}},
 		},
+	})
+
+	// Sorting and paging before populating, the order is restored after the group
+	pageStages, err := ChatRoomSortLatestMessage.Stages(page)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	pipeline = append(pipeline, pageStages...)
+
+	pipeline = append(pipeline, []bson.M{
 
 		// 	// unwind the members
 		bson.M{"$unwind": bson.M{"path": "$members"}},
@@ -135,7 +152,7 @@ func FindChatRoomDetailWithLastMessage(matchingCond *[]bson.M, skip int, limit i
 				"let":  bson.M{"member": "$members"},
 				"pipeline": bson.A{
 					bson.M{"$match": bson.M{"$expr": bson.M{"$eq": bson.A{"$_id", "$$member"}}}},
-					bson.M{"$project": bson.M{"_id": 1, "gender": 1, "domain": 1, "major": 1, "photoURL": 1, "role": 1, "email": 1}},
+					bson.M{"$project": bson.M{"_id": 1, "gender": publicGenderProjection(), "domain": 1, "major": publicMajorProjection(), "photoURL": 1, "roles": 1, "email": 1}},
 				},
 				"as": "member",
 			},
@@ -151,6 +168,7 @@ func FindChatRoomDetailWithLastMessage(matchingCond *[]bson.M, skip int, limit i
 				"createdAt":     1,
 				"groupName":     1,
 				"groupPhotoUrl": 1,
+				"lastMessageAt": 1,
 			},
 		},
 
@@ -165,6 +183,7 @@ func FindChatRoomDetailWithLastMessage(matchingCond *[]bson.M, skip int, limit i
 					"groupName":     "$groupName",
 					"messages":      "$messages",
 					"groupPhotoUrl": "$groupPhotoUrl",
+					"lastMessageAt": "$lastMessageAt",
 				},
 				"members": bson.M{"$push": bson.M{
 					"_id":      "$member._id",
@@ -172,7 +191,7 @@ func FindChatRoomDetailWithLastMessage(matchingCond *[]bson.M, skip int, limit i
 					"email":    "$member.email",
 					"photoURL": "$member.photoURL",
 					"major":    "$member.major",
-					"role":     "$member.role",
+					"roles":    "$member.roles",
 					"gender":   "$member.gender",
 				}},
 			},
@@ -188,10 +207,15 @@ func FindChatRoomDetailWithLastMessage(matchingCond *[]bson.M, skip int, limit i
 				"isGroup":       "$_id.isGroup",
 				"groupName":     "$_id.groupName",
 				"groupPhotoUrl": "$_id.groupPhotoUrl",
+				"lastMessageAt": "$_id.lastMessageAt",
 				"members":       1,
 			},
 		},
 
+		bson.M{
+			"$sort": bson.D{{Key: "lastMessageAt", Value: -1}, {Key: "_id", Value: -1}},
+		},
+
 		// 	// extract the last message and populate the author here
 
 		// success point till here
@@ -212,7 +236,7 @@ func FindChatRoomDetailWithLastMessage(matchingCond *[]bson.M, skip int, limit i
 		// 		"let":  bson.M{"messages": "$messages"},
 		// 		"pipeline": bson.A{
 		// 			bson.M{"$match": bson.M{"$expr": bson.M{"$eq": bson.A{"$_id", "$$messages.author"}}}},
-		// 			bson.M{"$project": bson.M{"_id": 1., "gender": 1, "domain": 1, " major": 1, "photoURL": 1, "role": 1, "email": 1}},
+		// 			bson.M{"$project": bson.M{"_id": 1., "gender": 1, "domain": 1, " major": 1, "photoURL": 1, "roles": 1, "email": 1}},
 		// 		},
 		// 		"as": "messages.author",
 		// 	},
@@ -248,18 +272,6 @@ func FindChatRoomDetailWithLastMessage(matchingCond *[]bson.M, skip int, limit i
 	}...,
 	)
 
-	if skip > 0 {
-		pipeline = append(pipeline, bson.M{
-			"$skip": skip,
-		})
-	}
-
-	if limit > 0 {
-		pipeline = append(pipeline, bson.M{
-			"$limit": limit,
-		})
-	}
-
 	result, err := database.ChatRoomCollection.Aggregate(context.TODO(), pipeline)
 
 	if result != nil {
@@ -267,16 +279,22 @@ func FindChatRoomDetailWithLastMessage(matchingCond *[]bson.M, skip int, limit i
 	}
 
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	err = result.All(context.TODO(), &chatRooms)
 
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	return chatRooms, nil
+	pageInfo, kept, err := ChatRoomSortLatestMessage.newPageInfo(page, chatRooms)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return chatRooms[:kept], pageInfo, nil
 }
 
 // WE don't need this right now
@@ -509,7 +527,29 @@ func WatchChatRooms(chatRooms []primitive.ObjectID) (*mongo.ChangeStream, error)
 	Message
 */
 
+// AddMessageToChatRoom - ErrBlockedUser is returned for the 1:1 chat rooms of blocked Users
 func AddMessageToChatRoom(rOID primitive.ObjectID, inputMessage Message) (interface{}, error) {
+	var chatRoom ChatRoomAdding
+
+	err := database.ChatRoomCollection.FindOne(context.TODO(), bson.M{"_id": rOID},
+		options.FindOne().SetProjection(bson.M{"members": 1, "isGroup": 1})).Decode(&chatRoom)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !chatRoom.IsGroup {
+		blocked, err := IsBlockedBetween(inputMessage.Author, chatRoom.Members)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if blocked {
+			return nil, ErrBlockedUser
+		}
+	}
+
 	result, err := database.ChatRoomCollection.UpdateOne(context.TODO(), bson.M{"_id": rOID}, bson.M{
 		"$push": bson.M{"messages": inputMessage},
 	})
@@ -521,9 +561,17 @@ func AddMessageToChatRoom(rOID primitive.ObjectID, inputMessage Message) (interf
 	return result, nil
 }
 
-func FindUsersWithoutRandomChat(uOID primitive.ObjectID) (*User, error) {
+func FindUsersWithoutRandomChat(user *User) (*User, error) {
 
 	var users []*User
+	uOID := user.ID
+
+	// Only users of the enabled universities can be matched
+	domains, err := FindEnabledUniversityDomains()
+
+	if err != nil {
+		return nil, err
+	}
 
 	pipeline := []bson.M{
 		bson.M{
@@ -532,6 +580,9 @@ func FindUsersWithoutRandomChat(uOID primitive.ObjectID) (*User, error) {
 					bson.M{
 						"randomChatRoom": nil,
 					},
+					bson.M{
+						"domain": bson.M{"$in": domains},
+					},
 					bson.M{
 						"$expr": bson.M{"$ne": bson.A{
 							"$_id", uOID,
@@ -540,12 +591,34 @@ func FindUsersWithoutRandomChat(uOID primitive.ObjectID) (*User, error) {
 					bson.M{
 						"emailVerified": true,
 					},
+					// Banned and suspended users can't be matched
+					notRestrictedFilter(),
+					// Nor the blocked users, in either direction
+					bson.M{
+						"_id":          bson.M{"$nin": append([]primitive.ObjectID{}, user.BlockedUsers...)},
+						"blockedUsers": bson.M{"$ne": uOID},
+					},
+					// Neither can the ones leaving
+					bson.M{
+						"deletion": bson.M{"$exists": false},
+					},
+					// Nor the ones who can't chat yet
+					completeProfileFilter(),
 				},
 			},
 		},
 
-		bson.M{"$sort": bson.M{
-			"lastSeen": -1,
+		// The online users first, the ones marked online but not seen for a while are not
+		bson.M{"$addFields": bson.M{
+			"isOnline": bson.M{"$and": bson.A{
+				bson.M{"$eq": bson.A{"$presence", PresenceOnline}},
+				bson.M{"$gte": bson.A{"$lastSeen", time.Now().Add(-PresenceTimeout)}},
+			}},
+		}},
+
+		bson.M{"$sort": bson.D{
+			{Key: "isOnline", Value: -1},
+			{Key: "lastSeen", Value: -1},
 		}},
 
 		bson.M{"$limit": 1},
@@ -659,3 +732,61 @@ func DeleteChatRoomWithNoneMembers(rOID primitive.ObjectID) (*mongo.DeleteResult
 
 	return result, err
 }
+
+// FindDirectChatRoom - Find the 1:1 chat room with the other User among the chat rooms, nil if there is none
+func FindDirectChatRoom(chatRooms []primitive.ObjectID, otherOID primitive.ObjectID) (*ChatRoomAdding, error) {
+	var chatRoom ChatRoomAdding
+
+	err := database.ChatRoomCollection.FindOne(context.TODO(), bson.M{
+		"_id":     bson.M{"$in": chatRooms},
+		"isGroup": false,
+		"members": otherOID,
+	}, options.FindOne().SetProjection(bson.M{"messages": 0})).Decode(&chatRoom)
+
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &chatRoom, nil
+}
+
+// FindMessagesByAuthor - Every message the User has sent, with the chat room it belongs to
+func FindMessagesByAuthor(uOID primitive.ObjectID) ([]bson.M, error) {
+	var messages []bson.M
+
+	pipeline := []bson.M{
+		bson.M{"$match": bson.M{"messages.author": uOID}},
+		bson.M{"$unwind": "$messages"},
+		bson.M{"$match": bson.M{"messages.author": uOID}},
+		bson.M{"$project": bson.M{
+			"_id":         "$messages._id",
+			"chatRoom":    "$_id",
+			"messageType": "$messages.messageType",
+			"content":     "$messages.content",
+			"createdAt":   "$messages.createdAt",
+		}},
+		bson.M{"$sort": bson.M{"createdAt": 1}},
+	}
+
+	result, err := database.ChatRoomCollection.Aggregate(context.TODO(), pipeline)
+
+	if result != nil {
+		defer result.Close(context.TODO())
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = result.All(context.TODO(), &messages)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return messages, nil
+}
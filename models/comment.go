@@ -2,6 +2,7 @@ package models
 
 import (
 	"context"
+	"log"
 	"quenc/database"
 	"time"
 
@@ -11,14 +12,21 @@ import (
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
+// The orders of the comments of a post
+var (
+	CommentSortOldest    = CursorSort{Field: "createdAt", Order: 1}
+	CommentSortLikeCount = CursorSort{Field: "likeCount", Order: -1}
+)
+
 type CommentAdding struct {
-	ID         primitive.ObjectID   `json:"_id" bson:"_id,omitempty"`
-	BelongPost primitive.ObjectID   `json:"belongPost" bson:"belongPost"`
-	Author     primitive.ObjectID   `json:"author" bson:"author"`
-	Content    string               `json:"content" bson:"content"`
-	Likers     []primitive.ObjectID `json:"likers" bson:"likers"`
-	UpdatedAt  time.Time            `json:"updatedAt" bson:"updatedAt"`
-	CreatedAt  time.Time            `json:"createdAt" bson:"createdAt"`
+	ID           primitive.ObjectID   `json:"_id" bson:"_id,omitempty"`
+	BelongPost   primitive.ObjectID   `json:"belongPost" bson:"belongPost"`
+	Author       primitive.ObjectID   `json:"author" bson:"author"`
+	Content      string               `json:"content" bson:"content"`
+	Likers       []primitive.ObjectID `json:"likers" bson:"likers"`
+	UpdatedAt    time.Time            `json:"updatedAt" bson:"updatedAt"`
+	CreatedAt    time.Time            `json:"createdAt" bson:"createdAt"`
+	ContentGrams string               `json:"-" bson:"contentGrams"` // for the search of the CJK text, see SetSearchGrams
 }
 
 type CommentDetail struct {
@@ -33,10 +41,19 @@ type CommentDetail struct {
 
 // AddComment - Adding Comment to MongoDB
 func AddComment(inputComment *CommentAdding) (interface{}, error) {
+	inputComment.SetSearchGrams()
 
 	result, err := database.CommentCollection.InsertOne(context.TODO(), inputComment)
 
-	return result.InsertedID, err
+	if err != nil {
+		return nil, err
+	}
+
+	if err := addPostEngagement(inputComment.BelongPost, "commentCount", 1, PostScoreCommentWeight); err != nil {
+		log.Printf("Cannot update the scores of the post %+v: %+v", inputComment.BelongPost, err)
+	}
+
+	return result.InsertedID, nil
 }
 
 // UpdateComments - Update Comment in MongoDB
@@ -56,9 +73,25 @@ func UpdateCommentByOID(oid primitive.ObjectID, updateDetail bson.M) (*mongo.Upd
 }
 
 // DeleteCommentByOID - Delete Comment by its OID
+// The comment count of its Post is decreased as well
 func DeleteCommentByOID(oid primitive.ObjectID) error {
-	_, err := database.CommentCollection.DeleteOne(context.TODO(), bson.M{"_id": oid})
-	return err
+	var comment CommentAdding
+
+	err := database.CommentCollection.FindOneAndDelete(context.TODO(), bson.M{"_id": oid}).Decode(&comment)
+
+	if err == mongo.ErrNoDocuments {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if err := addPostEngagement(comment.BelongPost, "commentCount", -1, PostScoreCommentWeight); err != nil {
+		log.Printf("Cannot update the scores of the post %+v: %+v", comment.BelongPost, err)
+	}
+
+	return nil
 }
 
 // FindCommentByOID - Find Comment by its OID
@@ -143,13 +176,19 @@ func ToggleLikerForComment(cOID primitive.ObjectID, uOID primitive.ObjectID, lik
 	return result, err
 }
 
-func FindCommentsWithDetailForPost(pOID primitive.ObjectID, skip int, limit int, sortByLikeCount bool) ([]*CommentDetail, error) {
-	var comments []*CommentDetail
+// FindCommentsWithDetailForPost - The comments of the excludedAuthors are left out, see FindBlockRelatedUsers
+// The page continues after its cursor in the order of the sort
+func FindCommentsWithDetailForPost(pOID primitive.ObjectID, sort CursorSort, page *PageQuery, excludedAuthors []primitive.ObjectID) ([]*CommentDetail, *PageInfo, error) {
+	comments := []*CommentDetail{}
 	pipeline := []bson.M{
 		bson.M{"$match": bson.M{
 			"belongPost": pOID,
 		}},
+	}
+
+	pipeline = append(pipeline, excludeAuthorsStage(excludedAuthors)...)
 
+	pipeline = append(pipeline, []bson.M{
 		// Populate Author
 		bson.M{
 			"$lookup": bson.M{
@@ -157,7 +196,7 @@ func FindCommentsWithDetailForPost(pOID primitive.ObjectID, skip int, limit int,
 				"let":  bson.M{"author": "$author"},
 				"pipeline": bson.A{
 					bson.M{"$match": bson.M{"$expr": bson.M{"$eq": bson.A{"$_id", "$$author"}}}},
-					bson.M{"$project": bson.M{"_id": 1, "gender": 1, "domain": 1}},
+					bson.M{"$project": bson.M{"_id": 1, "gender": publicGenderProjection(), "domain": 1}},
 				},
 				"as": "author",
 			},
@@ -177,32 +216,16 @@ func FindCommentsWithDetailForPost(pOID primitive.ObjectID, skip int, limit int,
 				"updatedAt": 1,
 			},
 		},
+	}...)
 
-		// Sort by created at
-		bson.M{
-			"$sort": bson.M{"createdAt": 1},
-		},
-	}
-
-	if sortByLikeCount {
-		pipeline = append(pipeline, bson.M{
-			"$sort": bson.M{
-				"likeCount": -1,
-			},
-		})
-	}
+	// Sorting and paging
+	pageStages, err := sort.Stages(page)
 
-	if skip > 0 {
-		pipeline = append(pipeline, bson.M{
-			"$skip": skip,
-		})
+	if err != nil {
+		return nil, nil, err
 	}
 
-	if limit > 0 {
-		pipeline = append(pipeline, bson.M{
-			"$limit": limit,
-		})
-	}
+	pipeline = append(pipeline, pageStages...)
 
 	result, err := database.CommentCollection.Aggregate(context.TODO(), pipeline)
 
@@ -211,16 +234,22 @@ func FindCommentsWithDetailForPost(pOID primitive.ObjectID, skip int, limit int,
 	}
 
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	err = result.All(context.TODO(), &comments)
 
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	return comments, nil
+	pageInfo, kept, err := sort.newPageInfo(page, comments)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return comments[:kept], pageInfo, nil
 
 }
 
@@ -238,7 +267,7 @@ func GetSingleCommentWithDetail(cOID primitive.ObjectID) (*CommentDetail, error)
 				"let":  bson.M{"author": "$author"},
 				"pipeline": bson.A{
 					bson.M{"$match": bson.M{"$expr": bson.M{"$eq": bson.A{"$_id", "$$author"}}}},
-					bson.M{"$project": bson.M{"_id": 1, "gender": 1, "domain": 1}},
+					bson.M{"$project": bson.M{"_id": 1, "gender": publicGenderProjection(), "domain": 1}},
 				},
 				"as": "author",
 			},
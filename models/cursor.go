@@ -0,0 +1,135 @@
+package models
+
+import (
+	"encoding/base64"
+	"errors"
+	"reflect"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+)
+
+// ErrInvalidCursor - The cursor is not one given by the listing with the same sort
+var ErrInvalidCursor = errors.New("the cursor is not valid")
+
+// Cursor - Where the previous page ended, by the sort key of its last item and the _id for the ties
+type Cursor struct {
+	Sort string             `bson:"s"` // the field of the CursorSort, so a cursor of another sort is rejected
+	Key  interface{}        `bson:"k"`
+	ID   primitive.ObjectID `bson:"i"`
+}
+
+// PageQuery - Which page of a listing to find, the skip is only for the clients without the cursors
+// The limit is ignored when it's not positive
+type PageQuery struct {
+	Cursor *Cursor
+	Skip   int
+	Limit  int
+}
+
+// PageInfo - Given along with a page, the nextCursor is empty on the last page
+type PageInfo struct {
+	NextCursor string `json:"nextCursor"`
+	HasMore    bool   `json:"hasMore"`
+}
+
+// CursorSort - The order of a listing, the _id breaks the ties in the same direction so the order is stable
+type CursorSort struct {
+	Field string
+	Order int // 1 or -1
+}
+
+// EncodeCursor - The opaque token of the cursor
+func EncodeCursor(cursor *Cursor) string {
+	data, err := bson.Marshal(cursor)
+
+	if err != nil {
+		return ""
+	}
+
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// DecodeCursor - The cursor of the token given by EncodeCursor
+func DecodeCursor(token string) (*Cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(token)
+
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	var cursor Cursor
+	if err := bson.Unmarshal(data, &cursor); err != nil || cursor.Sort == "" || cursor.ID.IsZero() {
+		return nil, ErrInvalidCursor
+	}
+
+	return &cursor, nil
+}
+
+// Stages - Continue after the cursor in the order of the sort, then skip and limit
+// One more than the limit is found, so newPageInfo can tell whether there are more
+func (s CursorSort) Stages(page *PageQuery) ([]bson.M, error) {
+	stages := []bson.M{}
+
+	if page != nil && page.Cursor != nil {
+		if page.Cursor.Sort != s.Field {
+			return nil, ErrInvalidCursor
+		}
+
+		after := "$gt"
+		if s.Order < 0 {
+			after = "$lt"
+		}
+
+		stages = append(stages, bson.M{"$match": bson.M{"$or": bson.A{
+			bson.M{s.Field: bson.M{after: page.Cursor.Key}},
+			bson.M{s.Field: page.Cursor.Key, "_id": bson.M{after: page.Cursor.ID}},
+		}}})
+	}
+
+	stages = append(stages, bson.M{"$sort": bson.D{{Key: s.Field, Value: s.Order}, {Key: "_id", Value: s.Order}}})
+
+	if page != nil && page.Skip > 0 {
+		stages = append(stages, bson.M{"$skip": page.Skip})
+	}
+
+	if page != nil && page.Limit > 0 {
+		stages = append(stages, bson.M{"$limit": page.Limit + 1})
+	}
+
+	return stages, nil
+}
+
+// newPageInfo - Whether more than the limit has been found in the slice of the items, the cursor is of the last item kept
+// The number of the items to keep is returned with it, the sort field and _id are read from the bson of the item
+func (s CursorSort) newPageInfo(page *PageQuery, items interface{}) (*PageInfo, int, error) {
+	found := reflect.ValueOf(items).Len()
+
+	if page == nil || page.Limit <= 0 || found <= page.Limit {
+		return &PageInfo{}, found, nil
+	}
+
+	last, err := bson.Marshal(reflect.ValueOf(items).Index(page.Limit - 1).Interface())
+
+	if err != nil {
+		return nil, 0, err
+	}
+
+	key, err := bson.Raw(last).LookupErr(s.Field)
+
+	if err != nil {
+		return nil, 0, err
+	}
+
+	id, ok := bson.Raw(last).Lookup("_id").ObjectIDOK()
+
+	if !ok {
+		return nil, 0, ErrInvalidCursor
+	}
+
+	return &PageInfo{
+		NextCursor: EncodeCursor(&Cursor{Sort: s.Field, Key: key, ID: id}),
+		HasMore:    true,
+	}, page.Limit, nil
+}
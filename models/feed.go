@@ -0,0 +1,241 @@
+package models
+
+import (
+	"context"
+	"quenc/database"
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+)
+
+const (
+	// FeedMaxAge - Only the posts younger than it are in the home feed
+	FeedMaxAge = 14 * 24 * time.Hour
+	// FeedSeenLifetime - How long the seen posts are remembered, longer than FeedMaxAge so they never come back
+	FeedSeenLifetime = 30 * 24 * time.Hour
+	// FeedTrendingMinHotScore - The hot score for a post of the domain to be trending, about a like a day ago
+	FeedTrendingMinHotScore = 0.01
+	// FeedFollowedBonus - The engagement added to the followed posts, so they can rank above the trending ones
+	FeedFollowedBonus = 10.0
+	// FeedScoreTimeScale - Within a page, a post newer by it ranks like an older one with ten times the engagement
+	FeedScoreTimeScale = 12 * time.Hour
+)
+
+// Why a post is in the home feed
+const (
+	FeedReasonCategory = "category" // of a followed PostCategory
+	FeedReasonAuthor   = "author"   // by a followed author
+	FeedReasonTrending = "trending" // hot in the domain of the User
+)
+
+// SeenPost - SeenPost Schema, a post the User has seen, removed after FeedSeenLifetime
+type SeenPost struct {
+	ID       primitive.ObjectID `json:"_id" bson:"_id,omitempty"`
+	User     primitive.ObjectID `json:"user" bson:"user"`
+	Post     primitive.ObjectID `json:"post" bson:"post"`
+	SeenAt   time.Time          `json:"seenAt" bson:"seenAt"`
+	ViewedAt *time.Time         `json:"viewedAt" bson:"viewedAt,omitempty"` // when the view was last counted, see RecordPostView
+}
+
+// FeedPost - A post of the home feed with why it's there
+type FeedPost struct {
+	PostPreview `bson:",inline"`
+	Reason      string  `json:"reason" bson:"reason"`
+	FeedScore   float64 `json:"-" bson:"feedScore"`
+}
+
+// EnsureFeedIndexes - A post is seen once by each User, and forgotten after FeedSeenLifetime
+func EnsureFeedIndexes() error {
+	_, err := database.SeenPostCollection.Indexes().CreateMany(context.TODO(), []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "user", Value: 1}, {Key: "post", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys:    bson.M{"seenAt": 1},
+			Options: options.Index().SetExpireAfterSeconds(int32(FeedSeenLifetime.Seconds())),
+		},
+	})
+	return err
+}
+
+// MarkPostsSeen - Remember the posts as seen by the User, seeing one again renews it
+func MarkPostsSeen(uOID primitive.ObjectID, pOIDs []primitive.ObjectID) error {
+	if len(pOIDs) == 0 {
+		return nil
+	}
+
+	now := time.Now()
+
+	writes := []mongo.WriteModel{}
+	for _, pOID := range pOIDs {
+		writes = append(writes, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"user": uOID, "post": pOID}).
+			SetUpdate(bson.M{"$set": bson.M{"seenAt": now}}).
+			SetUpsert(true))
+	}
+
+	// Unordered, so one failed post doesn't stop the others
+	_, err := database.SeenPostCollection.BulkWrite(context.TODO(), writes, options.BulkWrite().SetOrdered(false))
+	return err
+}
+
+// FindSeenPostOIDs - The posts seen by the User since the time
+func FindSeenPostOIDs(uOID primitive.ObjectID, since time.Time) ([]primitive.ObjectID, error) {
+	pOIDs := []primitive.ObjectID{}
+
+	result, err := database.SeenPostCollection.Find(
+		context.TODO(),
+		bson.M{"user": uOID, "seenAt": bson.M{"$gte": since}},
+		options.Find().SetProjection(bson.M{"post": 1}),
+	)
+	if result != nil {
+		defer result.Close(context.TODO())
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	for result.Next(context.TODO()) {
+		var elem SeenPost
+		if err := result.Decode(&elem); err != nil {
+			return nil, err
+		}
+		pOIDs = append(pOIDs, elem.Post)
+	}
+
+	return pOIDs, nil
+}
+
+// nonNilOIDs - The OIDs as an empty array rather than null, for $in in the expressions
+func nonNilOIDs(oids []primitive.ObjectID) []primitive.ObjectID {
+	if oids == nil {
+		return []primitive.ObjectID{}
+	}
+	return oids
+}
+
+// FindHomeFeed - The posts of the followed categories and authors, merged with the trending posts of the domain of the User
+// The posts of the User, the seen and hidden ones, and the ones of the excludedAuthors are left out
+// The pages go from the newest, so the cursors keep their place while the engagement changes
+// Each page is ranked by the log of the engagement, the followed ones with FeedFollowedBonus, plus the recency in FeedScoreTimeScale
+// The ranking is only within the page: a post is never moved to an earlier page for its engagement
+func FindHomeFeed(user *User, excludedAuthors []primitive.ObjectID, page *PageQuery) ([]*FeedPost, *PageInfo, error) {
+	posts := []*FeedPost{}
+	now := time.Now()
+
+	seen, err := FindSeenPostOIDs(user.ID, now.Add(-FeedMaxAge))
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	followedCategories := nonNilOIDs(user.FollowedCategories)
+	followedAuthors := nonNilOIDs(user.FollowedAuthors)
+
+	candidates := bson.A{
+		bson.M{"category": bson.M{"$in": followedCategories}},
+		bson.M{"author": bson.M{"$in": followedAuthors}, "anonymous": false},
+	}
+
+	// The domain of the anonymous authors is blanked by the lookup, so they are never trending by it
+	trending := bson.M{"$and": bson.A{
+		bson.M{"$eq": bson.A{bson.M{"$arrayElemAt": bson.A{"$author.domain", 0}}, user.Domain}},
+		bson.M{"$gte": bson.A{"$hotScore", FeedTrendingMinHotScore}},
+	}}
+
+	// Only the authors of the domain, so the hot posts of the other domains are not even looked up
+	if user.Domain != "" {
+		domainAuthors, err := database.UserCollection.Distinct(context.TODO(), "_id", bson.M{"domain": user.Domain})
+
+		if err != nil {
+			return nil, nil, err
+		}
+
+		candidates = append(candidates, bson.M{
+			"author":    bson.M{"$in": domainAuthors},
+			"hotScore":  bson.M{"$gte": FeedTrendingMinHotScore},
+			"anonymous": false,
+		})
+	}
+
+	pipeline := []bson.M{
+		bson.M{"$match": bson.M{
+			"createdAt": bson.M{"$gte": now.Add(-FeedMaxAge)},
+			"_id":       bson.M{"$nin": append(append([]primitive.ObjectID{}, seen...), user.HiddenPosts...)},
+			"author":    bson.M{"$nin": append(append([]primitive.ObjectID{}, excludedAuthors...), user.ID)},
+			"$or":       candidates,
+		}},
+		postAuthorLookupStage(),
+		bson.M{"$addFields": bson.M{
+			"reason": bson.M{"$switch": bson.M{
+				"branches": bson.A{
+					bson.M{"case": bson.M{"$in": bson.A{"$category", followedCategories}}, "then": FeedReasonCategory},
+					bson.M{"case": bson.M{"$and": bson.A{
+						bson.M{"$in": bson.A{bson.M{"$arrayElemAt": bson.A{"$author._id", 0}}, followedAuthors}},
+						bson.M{"$eq": bson.A{"$anonymous", false}},
+					}}, "then": FeedReasonAuthor},
+					bson.M{"case": trending, "then": FeedReasonTrending},
+				},
+				"default": "",
+			}},
+		}},
+		bson.M{"$match": bson.M{"reason": bson.M{"$ne": ""}}},
+		bson.M{"$addFields": bson.M{
+			"feedScore": bson.M{"$add": bson.A{
+				bson.M{"$log10": bson.M{"$max": bson.A{1, bson.M{"$add": bson.A{
+					bson.M{"$multiply": bson.A{bson.M{"$size": "$likers"}, PostScoreLikeWeight}},
+					bson.M{"$multiply": bson.A{bson.M{"$ifNull": bson.A{"$commentCount", 0}}, PostScoreCommentWeight}},
+					bson.M{"$multiply": bson.A{bson.M{"$ifNull": bson.A{"$viewCount", 0}}, PostScoreViewWeight}},
+					bson.M{"$cond": bson.A{bson.M{"$eq": bson.A{"$reason", FeedReasonTrending}}, 0, FeedFollowedBonus}},
+				}}}}},
+				bson.M{"$divide": bson.A{
+					bson.M{"$subtract": bson.A{"$createdAt", time.Unix(0, 0)}},
+					FeedScoreTimeScale.Milliseconds(),
+				}},
+			}},
+		}},
+		postCategoryLookupStage(),
+		bson.M{"$project": postPreviewProjection(bson.M{"reason": 1, "feedScore": 1})},
+	}
+
+	pageStages, err := PostSortLatest.Stages(page)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	pipeline = append(pipeline, pageStages...)
+
+	result, err := database.PostCollection.Aggregate(context.TODO(), pipeline)
+	if result != nil {
+		defer result.Close(context.TODO())
+	}
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := result.All(context.TODO(), &posts); err != nil {
+		return nil, nil, err
+	}
+
+	pageInfo, kept, err := PostSortLatest.newPageInfo(page, posts)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	posts = posts[:kept]
+	sort.SliceStable(posts, func(i, j int) bool {
+		return posts[i].FeedScore > posts[j].FeedScore
+	})
+
+	return posts, pageInfo, nil
+}
@@ -0,0 +1,96 @@
+package models
+
+import (
+	"context"
+	"quenc/database"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+)
+
+// What the following list shows of each author
+var projectionForFollowedUser = bson.M{"_id": 1, "name": 1, "photoURL": 1}
+
+// FollowAuthor - Add the author to the followed authors of the User
+func FollowAuthor(uOID primitive.ObjectID, authorOID primitive.ObjectID) (*mongo.UpdateResult, error) {
+	return database.UserCollection.UpdateOne(
+		context.TODO(),
+		bson.M{"_id": uOID},
+		bson.M{"$addToSet": bson.M{"followedAuthors": authorOID}},
+	)
+}
+
+// UnfollowAuthor - Remove the author from the followed authors of the User
+func UnfollowAuthor(uOID primitive.ObjectID, authorOID primitive.ObjectID) (*mongo.UpdateResult, error) {
+	return database.UserCollection.UpdateOne(
+		context.TODO(),
+		bson.M{"_id": uOID},
+		bson.M{"$pull": bson.M{"followedAuthors": authorOID}},
+	)
+}
+
+// FollowPostCategory - Add the PostCategory to the followed categories of the User
+func FollowPostCategory(uOID primitive.ObjectID, cOID primitive.ObjectID) (*mongo.UpdateResult, error) {
+	return database.UserCollection.UpdateOne(
+		context.TODO(),
+		bson.M{"_id": uOID},
+		bson.M{"$addToSet": bson.M{"followedCategories": cOID}},
+	)
+}
+
+// UnfollowPostCategory - Remove the PostCategory from the followed categories of the User
+func UnfollowPostCategory(uOID primitive.ObjectID, cOID primitive.ObjectID) (*mongo.UpdateResult, error) {
+	return database.UserCollection.UpdateOne(
+		context.TODO(),
+		bson.M{"_id": uOID},
+		bson.M{"$pull": bson.M{"followedCategories": cOID}},
+	)
+}
+
+// FindFollowedAuthors - The authors followed by the User, only with the name and photo
+func FindFollowedAuthors(user *User) ([]*User, error) {
+	var users []*User
+
+	if len(user.FollowedAuthors) == 0 {
+		return []*User{}, nil
+	}
+
+	result, err := database.UserCollection.Find(
+		context.TODO(),
+		bson.M{"_id": bson.M{"$in": user.FollowedAuthors}},
+		options.Find().SetProjection(projectionForFollowedUser),
+	)
+	if result != nil {
+		defer result.Close(context.TODO())
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = result.All(context.TODO(), &users)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
+
+// FindFollowedPostCategories - The PostCategories followed by the User
+func FindFollowedPostCategories(user *User) ([]*PostCategory, error) {
+	if len(user.FollowedCategories) == 0 {
+		return []*PostCategory{}, nil
+	}
+
+	categories, err := FindPostCategorys(bson.M{"_id": bson.M{"$in": user.FollowedCategories}}, nil)
+
+	if categories == nil {
+		categories = []*PostCategory{}
+	}
+
+	return categories, err
+}
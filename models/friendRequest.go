@@ -0,0 +1,199 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"log"
+	"quenc/database"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+)
+
+// Status of FriendRequest
+const (
+	FriendRequestPending   = "pending"
+	FriendRequestAccepted  = "accepted"
+	FriendRequestDeclined  = "declined"
+	FriendRequestCancelled = "cancelled" // by the sender
+)
+
+// ErrFriendRequestPending - The two Users already have a pending request
+var ErrFriendRequestPending = errors.New("there is already a pending friend request between the users")
+
+// FriendRequest - FriendRequest Schema
+// The friendship itself is stored in the friends of both Users once the request is accepted
+type FriendRequest struct {
+	ID          primitive.ObjectID `json:"_id" bson:"_id,omitempty"`
+	From        primitive.ObjectID `json:"from" bson:"from"`
+	To          primitive.ObjectID `json:"to" bson:"to"`
+	Pair        string             `json:"-" bson:"pair"` // the same for both directions, only one pending request per pair
+	Status      string             `json:"status" bson:"status"`
+	RespondedAt *time.Time         `json:"respondedAt" bson:"respondedAt"`
+	CreatedAt   time.Time          `json:"createdAt" bson:"createdAt"`
+}
+
+// FriendRequestPair - The key of the two Users in either order
+func FriendRequestPair(aOID primitive.ObjectID, bOID primitive.ObjectID) string {
+	if aOID.Hex() > bOID.Hex() {
+		aOID, bOID = bOID, aOID
+	}
+	return aOID.Hex() + "-" + bOID.Hex()
+}
+
+// EnsureFriendRequestIndexes - A pair can't have two pending requests, even when both send at the same time
+func EnsureFriendRequestIndexes() error {
+	_, err := database.FriendRequestCollection.Indexes().CreateOne(context.TODO(), mongo.IndexModel{
+		Keys: bson.M{"pair": 1},
+		Options: options.Index().
+			SetUnique(true).
+			SetPartialFilterExpression(bson.M{"status": FriendRequestPending}),
+	})
+	return err
+}
+
+// AddFriendRequest - Adding FriendRequest to MongoDB
+func AddFriendRequest(inputRequest *FriendRequest) (interface{}, error) {
+
+	result, err := database.FriendRequestCollection.InsertOne(context.TODO(), inputRequest)
+
+	if writeErr, ok := err.(mongo.WriteException); ok {
+		for _, e := range writeErr.WriteErrors {
+			if e.Code == 11000 {
+				return nil, ErrFriendRequestPending
+			}
+		}
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return result.InsertedID, nil
+}
+
+// FindFriendRequestByOID - Find FriendRequest by its OID
+func FindFriendRequestByOID(oid primitive.ObjectID) (*FriendRequest, error) {
+	var request FriendRequest
+
+	err := database.FriendRequestCollection.FindOne(context.TODO(), bson.M{"_id": oid}).Decode(&request)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &request, nil
+}
+
+// FindPendingFriendRequestBetween - Find the pending request of the two Users, sent by either of them
+func FindPendingFriendRequestBetween(aOID primitive.ObjectID, bOID primitive.ObjectID) (*FriendRequest, error) {
+	var request FriendRequest
+
+	err := database.FriendRequestCollection.FindOne(context.TODO(), bson.M{
+		"pair":   FriendRequestPair(aOID, bOID),
+		"status": FriendRequestPending,
+	}).Decode(&request)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &request, nil
+}
+
+// FindFriendRequests - Find Multiple FriendRequests by filterDetail
+func FindFriendRequests(filterDetail bson.M, findOptions *options.FindOptions) ([]*FriendRequest, error) {
+	var requests []*FriendRequest
+	result, err := database.FriendRequestCollection.Find(context.TODO(), filterDetail, findOptions)
+	if result != nil {
+		defer result.Close(context.TODO())
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	for result.Next(context.TODO()) {
+		var elem FriendRequest
+		err := result.Decode(&elem)
+		if err != nil {
+			return nil, err
+		}
+		requests = append(requests, &elem)
+	}
+
+	return requests, nil
+}
+
+// RespondToFriendRequest - Change the status of the pending request, false if it's no longer pending
+func RespondToFriendRequest(oid primitive.ObjectID, status string) (bool, error) {
+	result, err := database.FriendRequestCollection.UpdateOne(
+		context.TODO(),
+		bson.M{"_id": oid, "status": FriendRequestPending},
+		bson.M{"$set": bson.M{"status": status, "respondedAt": time.Now()}},
+	)
+
+	if err != nil {
+		return false, err
+	}
+
+	return result.ModifiedCount == 1, nil
+}
+
+// ReopenFriendRequest - Put the responded request back to pending, when the response cannot be carried out
+func ReopenFriendRequest(oid primitive.ObjectID) (*mongo.UpdateResult, error) {
+	return database.FriendRequestCollection.UpdateOne(
+		context.TODO(),
+		bson.M{"_id": oid},
+		bson.M{"$set": bson.M{"status": FriendRequestPending}, "$unset": bson.M{"respondedAt": ""}},
+	)
+}
+
+// AddFriendship - Make the two Users friends of each other
+// The first User is taken out again when the second cannot be added, so neither is left a friend of the other alone
+func AddFriendship(aOID primitive.ObjectID, bOID primitive.ObjectID) error {
+	if _, err := database.UserCollection.UpdateOne(context.TODO(), bson.M{"_id": aOID}, bson.M{"$addToSet": bson.M{"friends": bOID}}); err != nil {
+		return err
+	}
+
+	_, err := database.UserCollection.UpdateOne(context.TODO(), bson.M{"_id": bOID}, bson.M{"$addToSet": bson.M{"friends": aOID}})
+
+	if err != nil {
+		if _, undoErr := database.UserCollection.UpdateOne(context.TODO(), bson.M{"_id": aOID}, bson.M{"$pull": bson.M{"friends": bOID}}); undoErr != nil {
+			log.Printf("Cannot take %+v out of the friends of %+v: %+v", bOID, aOID, undoErr)
+		}
+	}
+
+	return err
+}
+
+// RemoveFriendship - Remove the two Users from the friends of each other, and their accepted requests
+func RemoveFriendship(aOID primitive.ObjectID, bOID primitive.ObjectID) error {
+	if _, err := database.UserCollection.UpdateOne(context.TODO(), bson.M{"_id": aOID}, bson.M{"$pull": bson.M{"friends": bOID}}); err != nil {
+		return err
+	}
+
+	if _, err := database.UserCollection.UpdateOne(context.TODO(), bson.M{"_id": bOID}, bson.M{"$pull": bson.M{"friends": aOID}}); err != nil {
+		return err
+	}
+
+	_, err := database.FriendRequestCollection.DeleteMany(context.TODO(), bson.M{
+		"pair":   FriendRequestPair(aOID, bOID),
+		"status": FriendRequestAccepted,
+	})
+	return err
+}
+
+// IsFriendOf - Whether the User has the other User as a friend
+func (u *User) IsFriendOf(oid primitive.ObjectID) bool {
+	for _, friend := range u.Friends {
+		if friend == oid {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,192 @@
+package models
+
+import (
+	"context"
+	"quenc/database"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Kinds of LoginAttempt
+const (
+	LoginAttemptLogin     = "login"
+	LoginAttemptSignup    = "signup"
+	LoginAttemptTwoFactor = "twoFactor"
+	// LoginAttemptAccountDeletion - The password and the code confirming the deletion of the account
+	LoginAttemptAccountDeletion = "accountDeletion"
+)
+
+const (
+	// LoginAttemptWindow - Only the failures in this window count for the backoff
+	LoginAttemptWindow = 15 * time.Minute
+	// LoginBackoffBase - The wait after the first failure over the free attempts, doubled for every further failure
+	LoginBackoffBase = time.Second
+	// LoginBackoffMax - The longest wait between attempts
+	LoginBackoffMax = 15 * time.Minute
+	// LoginFreeAttemptsPerEmail - Failures allowed for an email before backing off
+	LoginFreeAttemptsPerEmail = 3
+	// LoginFreeAttemptsPerIP - Failures allowed for an IP before backing off
+	LoginFreeAttemptsPerIP = 10
+	// LoginLockThreshold - Consecutive failures before locking the account
+	LoginLockThreshold = 5
+	// LoginLockDuration - How long an account is locked
+	LoginLockDuration = 30 * time.Minute
+)
+
+// LoginAttempt - LoginAttempt Schema, the login audit of every login and signup
+type LoginAttempt struct {
+	ID        primitive.ObjectID  `json:"_id" bson:"_id,omitempty"`
+	Kind      string              `json:"kind" bson:"kind"`
+	Email     string              `json:"email" bson:"email"`
+	User      *primitive.ObjectID `json:"user" bson:"user"`
+	IP        string              `json:"ip" bson:"ip"`
+	UserAgent string              `json:"userAgent" bson:"userAgent"`
+	Success   bool                `json:"success" bson:"success"`
+	Reason    string              `json:"reason" bson:"reason"` // why the attempt failed, never shown to the client
+	CreatedAt time.Time           `json:"createdAt" bson:"createdAt"`
+}
+
+// EnsureLoginAuditIndexes - The indexes for the backoff, which counts the attempts of the email or the IP since a time
+func EnsureLoginAuditIndexes() error {
+	_, err := database.LoginAuditCollection.Indexes().CreateMany(context.TODO(), []mongo.IndexModel{
+		{Keys: bson.D{{Key: "kind", Value: 1}, {Key: "email", Value: 1}, {Key: "success", Value: 1}, {Key: "createdAt", Value: -1}}},
+		{Keys: bson.D{{Key: "kind", Value: 1}, {Key: "ip", Value: 1}, {Key: "success", Value: 1}, {Key: "createdAt", Value: -1}}},
+	})
+	return err
+}
+
+// AddLoginAttempt - Adding LoginAttempt to MongoDB
+func AddLoginAttempt(inputAttempt *LoginAttempt) (interface{}, error) {
+
+	result, err := database.LoginAuditCollection.InsertOne(context.TODO(), inputAttempt)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return result.InsertedID, nil
+}
+
+// FindLoginAttempts - Find Multiple LoginAttempts by filterDetail
+func FindLoginAttempts(filterDetail bson.M, findOptions *options.FindOptions) ([]*LoginAttempt, error) {
+	var attempts []*LoginAttempt
+	result, err := database.LoginAuditCollection.Find(context.TODO(), filterDetail, findOptions)
+	if result != nil {
+		defer result.Close(context.TODO())
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	for result.Next(context.TODO()) {
+		var elem LoginAttempt
+		err := result.Decode(&elem)
+		if err != nil {
+			return nil, err
+		}
+		attempts = append(attempts, &elem)
+	}
+
+	return attempts, nil
+}
+
+// findLatestLoginAttempt - Find the latest attempt matching the filter, nil if there is none
+func findLatestLoginAttempt(filterDetail bson.M) (*LoginAttempt, error) {
+	var attempt LoginAttempt
+
+	err := database.LoginAuditCollection.FindOne(
+		context.TODO(),
+		filterDetail,
+		options.FindOne().SetSort(bson.M{"createdAt": -1}),
+	).Decode(&attempt)
+
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &attempt, nil
+}
+
+// loginBackoff - How long to wait before the next attempt matching the key
+// The failures since the latest success in the window are counted, the wait doubles for each one over freeAttempts
+func loginBackoff(key bson.M, freeAttempts int) (time.Duration, error) {
+	now := time.Now()
+	since := now.Add(-LoginAttemptWindow)
+
+	successFilter := bson.M{"success": true, "createdAt": bson.M{"$gt": since}}
+	for k, v := range key {
+		successFilter[k] = v
+	}
+
+	lastSuccess, err := findLatestLoginAttempt(successFilter)
+
+	if err != nil {
+		return 0, err
+	}
+
+	if lastSuccess != nil {
+		since = lastSuccess.CreatedAt
+	}
+
+	failureFilter := bson.M{"success": false, "createdAt": bson.M{"$gt": since}}
+	for k, v := range key {
+		failureFilter[k] = v
+	}
+
+	failures, err := database.LoginAuditCollection.CountDocuments(context.TODO(), failureFilter)
+
+	if err != nil {
+		return 0, err
+	}
+
+	if int(failures) < freeAttempts {
+		return 0, nil
+	}
+
+	lastFailure, err := findLatestLoginAttempt(failureFilter)
+
+	if err != nil || lastFailure == nil {
+		return 0, err
+	}
+
+	backoff := LoginBackoffMax
+	if shift := uint(int(failures) - freeAttempts); shift < 20 && LoginBackoffBase<<shift < LoginBackoffMax {
+		backoff = LoginBackoffBase << shift
+	}
+
+	if wait := lastFailure.CreatedAt.Add(backoff).Sub(now); wait > 0 {
+		return wait, nil
+	}
+
+	return 0, nil
+}
+
+// CheckLoginBackoff - How long the client has to wait before trying the email from the IP again
+func CheckLoginBackoff(kind string, email string, ip string) (time.Duration, error) {
+	emailWait, err := loginBackoff(bson.M{"kind": kind, "email": email}, LoginFreeAttemptsPerEmail)
+
+	if err != nil {
+		return 0, err
+	}
+
+	ipWait, err := loginBackoff(bson.M{"kind": kind, "ip": ip}, LoginFreeAttemptsPerIP)
+
+	if err != nil {
+		return 0, err
+	}
+
+	if ipWait > emailWait {
+		return ipWait, nil
+	}
+
+	return emailWait, nil
+}
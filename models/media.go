@@ -0,0 +1,189 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"quenc/database"
+	"quenc/storage"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+)
+
+// MaxMediaSize - The largest file which can be uploaded
+const MaxMediaSize = 10 << 20
+
+// The names of the variants
+const (
+	MediaVariantLarge     = "large" // the original with the metadata stripped, limited to a sane size
+	MediaVariantMedium    = "medium"
+	MediaVariantThumbnail = "thumbnail"
+)
+
+// MediaVariantSizes - The variants every upload is stored in, by the longest side
+var MediaVariantSizes = []struct {
+	Name    string
+	MaxSide int
+}{
+	{MediaVariantLarge, 2048},
+	{MediaVariantMedium, 800},
+	{MediaVariantThumbnail, 200},
+}
+
+// ErrMediaNotFound - The media ID was not issued by this service
+var ErrMediaNotFound = errors.New("the media is not uploaded to this service")
+
+// ErrMediaNotOwned - The media was uploaded by another User
+var ErrMediaNotOwned = errors.New("the media is uploaded by another user")
+
+// Media - Media Schema
+// PhotoURL, PreviewPhoto and GroupPhotoUrl hold the hex ID of a Media
+type Media struct {
+	ID          primitive.ObjectID `json:"_id" bson:"_id,omitempty"`
+	Owner       primitive.ObjectID `json:"owner" bson:"owner"`
+	ContentType string             `json:"contentType" bson:"contentType"` // of the uploaded file
+	Size        int64              `json:"size" bson:"size"`
+	Variants    []MediaVariant     `json:"variants" bson:"variants"`
+	CreatedAt   time.Time          `json:"createdAt" bson:"createdAt"`
+}
+
+// MediaVariant - A resized copy of the Media in the storage
+type MediaVariant struct {
+	Name        string `json:"name" bson:"name"`
+	Key         string `json:"-" bson:"key"`
+	URL         string `json:"url" bson:"-"` // filled in by ResolveURLs, so the storage can move
+	ContentType string `json:"contentType" bson:"contentType"`
+	Width       int    `json:"width" bson:"width"`
+	Height      int    `json:"height" bson:"height"`
+	Size        int    `json:"size" bson:"size"`
+}
+
+// MediaKey - The storage key of a variant
+func MediaKey(mOID primitive.ObjectID, variant string, contentType string) string {
+	extension := ".png"
+	if contentType == "image/jpeg" {
+		extension = ".jpg"
+	}
+	return "media/" + mOID.Hex() + "/" + variant + extension
+}
+
+// ResolveURLs - Fill in the URLs of the variants from the storage
+func (m *Media) ResolveURLs() *Media {
+	for i := range m.Variants {
+		m.Variants[i].URL = storage.URL(m.Variants[i].Key)
+	}
+	return m
+}
+
+// Variant - The variant with the name, nil if there is none
+func (m *Media) Variant(name string) *MediaVariant {
+	for i := range m.Variants {
+		if m.Variants[i].Name == name {
+			return &m.Variants[i]
+		}
+	}
+	return nil
+}
+
+// AddMedia - Adding Media to MongoDB, the variants have to be stored already
+func AddMedia(inputMedia *Media) (interface{}, error) {
+
+	result, err := database.MediaCollection.InsertOne(context.TODO(), inputMedia)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return result.InsertedID, nil
+}
+
+// FindMediaByOID - Find Media by its OID
+func FindMediaByOID(oid primitive.ObjectID) (*Media, error) {
+	var media Media
+
+	err := database.MediaCollection.FindOne(context.TODO(), bson.M{"_id": oid}).Decode(&media)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &media, nil
+}
+
+// CheckMediaID - Whether the ID is of a Media uploaded by the User, the empty one is allowed for removing
+func CheckMediaID(id string, owner primitive.ObjectID) error {
+	if id == "" {
+		return nil
+	}
+
+	mOID, err := primitive.ObjectIDFromHex(id)
+
+	if err != nil {
+		return ErrMediaNotFound
+	}
+
+	media, err := FindMediaByOID(mOID)
+
+	if err == mongo.ErrNoDocuments {
+		return ErrMediaNotFound
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if media.Owner != owner {
+		return ErrMediaNotOwned
+	}
+
+	return nil
+}
+
+// FindMediaOfOwner - The Media uploaded by the User, the oldest first
+func FindMediaOfOwner(owner primitive.ObjectID) ([]*Media, error) {
+	media := []*Media{}
+
+	result, err := database.MediaCollection.Find(
+		context.TODO(),
+		bson.M{"owner": owner},
+		options.Find().SetSort(bson.M{"createdAt": 1}),
+	)
+	if result != nil {
+		defer result.Close(context.TODO())
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := result.All(context.TODO(), &media); err != nil {
+		return nil, err
+	}
+
+	return media, nil
+}
+
+// DeleteMediaOfOwner - Remove the variants of the Media uploaded by the User from the storage, then the Media
+// The documents go last, so a failure can be retried
+func DeleteMediaOfOwner(owner primitive.ObjectID) error {
+	media, err := FindMediaOfOwner(owner)
+
+	if err != nil {
+		return err
+	}
+
+	for _, m := range media {
+		for _, variant := range m.Variants {
+			if err := storage.Delete(variant.Key); err != nil {
+				return err
+			}
+		}
+	}
+
+	_, err = database.MediaCollection.DeleteMany(context.TODO(), bson.M{"owner": owner})
+	return err
+}
@@ -0,0 +1,172 @@
+package models
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"quenc/database"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Types of ModerationAction
+const (
+	ModerationSuspend = "suspend" // read-only until ExpiresAt
+	ModerationBan     = "ban"     // no access at all, permanent
+	ModerationLift    = "lift"    // ends the current suspension or ban
+)
+
+// Restriction - The suspension or ban in effect, stored in the User
+type Restriction struct {
+	Type      string             `json:"type" bson:"type"`
+	Reason    string             `json:"reason" bson:"reason"`
+	Moderator primitive.ObjectID `json:"moderator" bson:"moderator"`
+	ExpiresAt *time.Time         `json:"expiresAt" bson:"expiresAt"` // nil for bans
+	CreatedAt time.Time          `json:"createdAt" bson:"createdAt"`
+}
+
+// ModerationAction - ModerationAction Schema, the moderation history of the Users
+type ModerationAction struct {
+	ID        primitive.ObjectID `json:"_id" bson:"_id,omitempty"`
+	User      primitive.ObjectID `json:"user" bson:"user"`
+	Moderator primitive.ObjectID `json:"moderator" bson:"moderator"`
+	Type      string             `json:"type" bson:"type"`
+	Reason    string             `json:"reason" bson:"reason"`
+	ExpiresAt *time.Time         `json:"expiresAt" bson:"expiresAt"`
+	EmailHash string             `json:"-" bson:"emailHash,omitempty"` // set once the User is deleted, so a ban still holds for the email
+	CreatedAt time.Time          `json:"createdAt" bson:"createdAt"`
+}
+
+// IsBanned - Whether the User is banned
+func (u *User) IsBanned() bool {
+	return u.Restriction != nil && u.Restriction.Type == ModerationBan
+}
+
+// IsSuspended - Whether the User is suspended now, the suspensions end by themselves
+// The suspended role is the same suspension without an end, until the role is revoked
+func (u *User) IsSuspended() bool {
+	if u.HasRole(RoleSuspended) {
+		return true
+	}
+
+	return u.Restriction != nil &&
+		u.Restriction.Type == ModerationSuspend &&
+		u.Restriction.ExpiresAt != nil &&
+		time.Now().Before(*u.Restriction.ExpiresAt)
+}
+
+// notRestrictedFilter - Match the Users who are neither banned nor suspended now
+func notRestrictedFilter() bson.M {
+	return bson.M{
+		"roles": bson.M{"$ne": RoleSuspended},
+		"$or": bson.A{
+			bson.M{"restriction": bson.M{"$exists": false}},
+			bson.M{"restriction": nil},
+			bson.M{"restriction.type": ModerationSuspend, "restriction.expiresAt": bson.M{"$lte": time.Now()}},
+		},
+	}
+}
+
+// AddModerationAction - Adding ModerationAction to MongoDB
+func AddModerationAction(inputAction *ModerationAction) (interface{}, error) {
+
+	result, err := database.ModerationActionCollection.InsertOne(context.TODO(), inputAction)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return result.InsertedID, nil
+}
+
+// FindModerationActions - Find Multiple ModerationActions by filterDetail
+func FindModerationActions(filterDetail bson.M, findOptions *options.FindOptions) ([]*ModerationAction, error) {
+	var actions []*ModerationAction
+	result, err := database.ModerationActionCollection.Find(context.TODO(), filterDetail, findOptions)
+	if result != nil {
+		defer result.Close(context.TODO())
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	for result.Next(context.TODO()) {
+		var elem ModerationAction
+		err := result.Decode(&elem)
+		if err != nil {
+			return nil, err
+		}
+		actions = append(actions, &elem)
+	}
+
+	return actions, nil
+}
+
+// SetUserRestriction - Put the suspension or ban in effect, replacing the current one
+func SetUserRestriction(uOID primitive.ObjectID, restriction *Restriction) (*mongo.UpdateResult, error) {
+	return database.UserCollection.UpdateOne(
+		context.TODO(),
+		bson.M{"_id": uOID},
+		bson.M{"$set": bson.M{"restriction": restriction}},
+	)
+}
+
+// LiftUserRestriction - End the current suspension or ban
+func LiftUserRestriction(uOID primitive.ObjectID) (*mongo.UpdateResult, error) {
+	return database.UserCollection.UpdateOne(
+		context.TODO(),
+		bson.M{"_id": uOID},
+		bson.M{"$unset": bson.M{"restriction": ""}},
+	)
+}
+
+// moderationEmailHash - The hash of the email kept in the moderation history of a deleted User
+func moderationEmailHash(email string) string {
+	sum := sha256.Sum256([]byte(strings.ToLower(strings.TrimSpace(email))))
+	return hex.EncodeToString(sum[:])
+}
+
+// AnonymiseModerationActions - Keep the moderation history of a deleted User under DeletedUserOID, with the hash of the email
+func AnonymiseModerationActions(uOID primitive.ObjectID, email string) (*mongo.UpdateResult, error) {
+	return database.ModerationActionCollection.UpdateMany(
+		context.TODO(),
+		bson.M{"user": uOID},
+		bson.M{"$set": bson.M{"user": DeletedUserOID, "emailHash": moderationEmailHash(email)}},
+	)
+}
+
+// IsEmailBanned - Whether a deleted User of the email is still banned, the latest ban or lift in its history decides
+func IsEmailBanned(email string) (bool, error) {
+	var action ModerationAction
+
+	err := database.ModerationActionCollection.FindOne(
+		context.TODO(),
+		bson.M{"emailHash": moderationEmailHash(email), "type": bson.M{"$in": bson.A{ModerationBan, ModerationLift}}},
+		options.FindOne().SetSort(bson.M{"createdAt": -1}),
+	).Decode(&action)
+
+	if err == mongo.ErrNoDocuments {
+		return false, nil
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	return action.Type == ModerationBan, nil
+}
+
+// EnsureModerationIndexes - The index for IsEmailBanned
+func EnsureModerationIndexes() error {
+	_, err := database.ModerationActionCollection.Indexes().CreateOne(context.TODO(), mongo.IndexModel{
+		Keys:    bson.D{{Key: "emailHash", Value: 1}, {Key: "createdAt", Value: -1}},
+		Options: options.Index().SetSparse(true),
+	})
+	return err
+}
@@ -0,0 +1,178 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"go.mongodb.org/mongo-driver/bson"
+
+)
+
+// The genders a User can choose, GenderUnknown is the one before the onboarding
+const (
+	GenderMale   = 0
+	GenderFemale = 1
+	GenderOther  = 2
+)
+
+const (
+	// MinimumAge - The youngest a User can be
+	MinimumAge = 16
+	// MaxNameLength - The longest name in characters
+	MaxNameLength = 30
+	// DobLayout - How the dob is stored
+	DobLayout = "2006-01-02 15:04:05.000Z"
+)
+
+// The fields a User has to fill in before posting or chatting
+const (
+	ProfileFieldName   = "name"
+	ProfileFieldGender = "gender"
+	ProfileFieldMajor  = "major"
+	ProfileFieldDob    = "dob"
+)
+
+// The layouts of the dob accepted from the clients, the first one is DobLayout
+var dobLayouts = []string{DobLayout, time.RFC3339, "2006-01-02"}
+
+// OnboardingStatus - What the User still has to fill in, and the choices for it
+type OnboardingStatus struct {
+	Complete   bool     `json:"complete"`
+	Missing    []string `json:"missing"`
+	Majors     []string `json:"majors"` // of the User's University, any major can be given when it's empty
+	Genders    []int    `json:"genders"`
+	MinimumAge int      `json:"minimumAge"`
+}
+
+// IsValidGender - Whether the gender is one the User can choose
+func IsValidGender(gender int) bool {
+	return gender == GenderMale || gender == GenderFemale || gender == GenderOther
+}
+
+// NormaliseName - Trim the name and check its length
+func NormaliseName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+
+	if name == "" {
+		return "", errors.New("the name can't be empty")
+	}
+
+	if utf8.RuneCountInString(name) > MaxNameLength {
+		return "", fmt.Errorf("the name can't be longer than %d characters", MaxNameLength)
+	}
+
+	return name, nil
+}
+
+// ParseDob - Parse the dob in any of the accepted layouts, and check the minimum age at now
+// The dob is returned in DobLayout
+func ParseDob(dob string, now time.Time) (string, error) {
+	var parsed time.Time
+	var err error
+
+	for _, layout := range dobLayouts {
+		if parsed, err = time.Parse(layout, strings.TrimSpace(dob)); err == nil {
+			break
+		}
+	}
+
+	if err != nil {
+		return "", fmt.Errorf("%q is not a valid date", dob)
+	}
+
+	if parsed.After(now) {
+		return "", errors.New("the dob can't be in the future")
+	}
+
+	if AgeAt(parsed, now) < MinimumAge {
+		return "", fmt.Errorf("the user has to be at least %d years old", MinimumAge)
+	}
+
+	return parsed.UTC().Format(DobLayout), nil
+}
+
+// AgeAt - The age in full years at the time
+func AgeAt(dob time.Time, at time.Time) int {
+	age := at.Year() - dob.Year()
+	if at.Month() < dob.Month() || (at.Month() == dob.Month() && at.Day() < dob.Day()) {
+		age--
+	}
+	return age
+}
+
+// MissingProfileFields - The required fields the User hasn't filled in
+func (u *User) MissingProfileFields() []string {
+	missing := []string{}
+
+	if strings.TrimSpace(u.Name) == "" {
+		missing = append(missing, ProfileFieldName)
+	}
+	if !IsValidGender(u.Gender) {
+		missing = append(missing, ProfileFieldGender)
+	}
+	if strings.TrimSpace(u.Major) == "" {
+		missing = append(missing, ProfileFieldMajor)
+	}
+	if strings.TrimSpace(u.Dob) == "" {
+		missing = append(missing, ProfileFieldDob)
+	}
+
+	return missing
+}
+
+// OnboardingStatus - The OnboardingStatus of the User, with the majors of the University
+func (u *User) OnboardingStatus() (*OnboardingStatus, error) {
+	university, err := FindUniversityByDomain(u.Domain)
+
+	if err != nil {
+		return nil, err
+	}
+
+	majors := []string{}
+	if university != nil {
+		majors = append(majors, university.Majors...)
+	}
+
+	missing := u.MissingProfileFields()
+
+	return &OnboardingStatus{
+		Complete:   len(missing) == 0,
+		Missing:    missing,
+		Majors:     majors,
+		Genders:    []int{GenderMale, GenderFemale, GenderOther},
+		MinimumAge: MinimumAge,
+	}, nil
+}
+
+// completeProfileFilter - Match the Users who have filled in the required profile fields
+func completeProfileFilter() bson.M {
+	return bson.M{
+		"name":   bson.M{"$nin": bson.A{"", nil}},
+		"gender": bson.M{"$in": bson.A{GenderMale, GenderFemale, GenderOther}},
+		"major":  bson.M{"$nin": bson.A{"", nil}},
+		"dob":    bson.M{"$nin": bson.A{"", nil}},
+	}
+}
+
+// HasMajor - Whether the major can be chosen by the Users of the University, any major can when there is no list
+// None can without a University, so a user of an unknown domain can't set one
+func (u *University) HasMajor(major string) bool {
+	if u == nil {
+		return false
+	}
+
+	if len(u.Majors) == 0 {
+		return true
+	}
+
+	for _, m := range u.Majors {
+		if m == major {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,71 @@
+package models
+
+import (
+	"context"
+	"quenc/database"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// PasswordResetLifetime - How long a reset token can be used
+const PasswordResetLifetime = 30 * time.Minute
+
+// PasswordReset - PasswordReset Schema
+// Only the hash of the token is stored, a token can only be used once
+type PasswordReset struct {
+	ID        primitive.ObjectID `json:"_id" bson:"_id,omitempty"`
+	User      primitive.ObjectID `json:"user" bson:"user"`
+	TokenHash string             `json:"-" bson:"tokenHash"`
+	Used      bool               `json:"used" bson:"used"`
+	ExpiresAt time.Time          `json:"expiresAt" bson:"expiresAt"`
+	CreatedAt time.Time          `json:"createdAt" bson:"createdAt"`
+}
+
+// AddPasswordReset - Adding PasswordReset to MongoDB
+func AddPasswordReset(inputReset *PasswordReset) (interface{}, error) {
+
+	result, err := database.PasswordResetCollection.InsertOne(context.TODO(), inputReset)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return result.InsertedID, nil
+}
+
+// UsePasswordResetByHash - Mark the reset token as used and return it
+// nil is returned when the token does not exist, is expired or has been used
+func UsePasswordResetByHash(tokenHash string) (*PasswordReset, error) {
+	var reset PasswordReset
+
+	err := database.PasswordResetCollection.FindOneAndUpdate(
+		context.TODO(),
+		bson.M{"tokenHash": tokenHash, "used": false, "expiresAt": bson.M{"$gt": time.Now()}},
+		bson.M{"$set": bson.M{"used": true}},
+	).Decode(&reset)
+
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &reset, nil
+}
+
+// InvalidatePasswordResetsForUser - Mark all the unused reset tokens of the user as used
+func InvalidatePasswordResetsForUser(uOID primitive.ObjectID) (*mongo.UpdateResult, error) {
+
+	result, err := database.PasswordResetCollection.UpdateMany(
+		context.TODO(),
+		bson.M{"user": uOID, "used": false},
+		bson.M{"$set": bson.M{"used": true}},
+	)
+
+	return result, err
+}
@@ -2,6 +2,7 @@ package models
 
 import (
 	"context"
+	"log"
 	"quenc/database"
 	"time"
 
@@ -12,19 +13,36 @@ import (
 
 )
 
+// The orders of the post listings
+var (
+	PostSortLatest    = CursorSort{Field: "createdAt", Order: -1}
+	PostSortLikeCount = CursorSort{Field: "likeCount", Order: -1}
+	// The scores change while a listing is paged, so a post can be seen twice or missed across the pages
+	PostSortHot    = CursorSort{Field: "hotScore", Order: -1}
+	PostSortRising = CursorSort{Field: "risingScore", Order: -1}
+)
+
 // PostAdding -PostAdding Schema
 type PostAdding struct {
-	ID           primitive.ObjectID   `json:"_id" bson:"_id,omitempty"`
-	Anonymous    bool                 `json:"anonymous" bson:"anonymous"`
-	Title        string               `json:"title" bson:"title"`
-	Author       primitive.ObjectID   `json:"author" bson:"author"`
-	Content      string               `json:"content" bson:"content"`
-	PreviewText  string               `json:"previewText" bson:"previewText"`
-	PreviewPhoto string               `json:"previewPhoto" bson:"previewPhoto"`
-	Category     primitive.ObjectID   `json:"category" bson:"category"`
-	Likers       []primitive.ObjectID `json:"likers" bson:"likers"`
-	UpdatedAt    time.Time            `json:"updatedAt" bson:"updatedAt"`
-	CreatedAt    time.Time            `json:"createdAt" bson:"createdAt"`
+	ID            primitive.ObjectID   `json:"_id" bson:"_id,omitempty"`
+	Anonymous     bool                 `json:"anonymous" bson:"anonymous"`
+	Title         string               `json:"title" bson:"title"`
+	Author        primitive.ObjectID   `json:"author" bson:"author"`
+	Content       string               `json:"content" bson:"content"`
+	PreviewText   string               `json:"previewText" bson:"previewText"`
+	PreviewPhoto  string               `json:"previewPhoto" bson:"previewPhoto"`
+	Category      primitive.ObjectID   `json:"category" bson:"category"`
+	Likers        []primitive.ObjectID `json:"likers" bson:"likers"`
+	UpdatedAt     time.Time            `json:"updatedAt" bson:"updatedAt"`
+	CreatedAt     time.Time            `json:"createdAt" bson:"createdAt"`
+	TitleGrams    string               `json:"-" bson:"titleGrams"` // for the search of the CJK text, see SetSearchGrams
+	BodyGrams     string               `json:"-" bson:"bodyGrams"`
+	CommentCount  int                  `json:"-" bson:"commentCount"` // the counters and scores are kept by addPostEngagement and RunPostScoreUpdates
+	ViewCount     int                  `json:"-" bson:"viewCount"`
+	HotScore      float64              `json:"-" bson:"hotScore"`
+	RisingScore   float64              `json:"-" bson:"risingScore"`
+	Edited        bool                 `json:"-" bson:"edited"`                  // the revisions are in PostRevision
+	RevisionCount int                  `json:"-" bson:"revisionCount,omitempty"` // the number of the last PostRevision
 }
 
 type PostPreview struct {
@@ -40,6 +58,11 @@ type PostPreview struct {
 	UpdatedAt    time.Time    `json:"updatedAt" bson:"updatedAt"`
 	CreatedAt    time.Time    `json:"createdAt" bson:"createdAt"`
 	LikeCount    int          `json:"likeCount" bson:"likeCount"`
+	CommentCount int          `json:"commentCount" bson:"commentCount"`
+	ViewCount    int          `json:"viewCount" bson:"viewCount"`
+	Edited       bool         `json:"edited" bson:"edited"`
+	HotScore     float64      `json:"-" bson:"hotScore"` // for the cursors of the sorts
+	RisingScore  float64      `json:"-" bson:"risingScore"`
 }
 
 type PostDetail struct {
@@ -52,12 +75,16 @@ type PostDetail struct {
 	UpdatedAt    time.Time          `json:"updatedAt" bson:"updatedAt"`
 	CreatedAt    time.Time          `json:"createdAt" bson:"createdAt"`
 	LikeCount    int                `json:"likeCount" bson:"likeCount"`
+	CommentCount int                `json:"commentCount" bson:"commentCount"`
+	ViewCount    int                `json:"viewCount" bson:"viewCount"`
+	Edited       bool               `json:"edited" bson:"edited"`
 	PreviewText  string             `json:"previewText" bson:"previewText"`
 	PreviewPhoto string             `json:"previewPhoto" bson:"previewPhoto"`
 }
 
 // AddPost - Adding Post to MongoDB
 func AddPost(inputPost *PostAdding) (interface{}, error) {
+	inputPost.SetSearchGrams()
 
 	result, err := database.PostCollection.InsertOne(context.TODO(), inputPost)
 
@@ -160,6 +187,16 @@ func ToggleLikerForPost(pOID primitive.ObjectID, uOID primitive.ObjectID, like b
 		return nil, err
 	}
 
+	if result.ModifiedCount > 0 {
+		delta := 1
+		if !like {
+			delta = -1
+		}
+		if err := addPostEngagement(pOID, "", delta, PostScoreLikeWeight); err != nil {
+			log.Printf("Cannot update the scores of the post %+v: %+v", pOID, err)
+		}
+	}
+
 	return result, err
 }
 
@@ -210,20 +247,83 @@ func FindPostByAuthor(uOID primitive.ObjectID, findOptions *options.FindOptions)
 	return posts, err
 }
 
-func FindAllCategoryPostsWithPreview(cOID *primitive.ObjectID, skip int, limit int, sortByLikeCount bool) ([]*PostPreview, error) {
-	cond := []bson.M{}
+// FindAllCategoryPostsWithPreview - The posts of the category, or of all the categories when cOID is nil
+// The posts created before since are left out, unless it's zero
+func FindAllCategoryPostsWithPreview(cOID *primitive.ObjectID, since time.Time, sort CursorSort, page *PageQuery, excludedAuthors []primitive.ObjectID) ([]*PostPreview, *PageInfo, error) {
+	match := bson.M{}
 	if cOID != nil {
-		cond = append(cond, bson.M{"$match": bson.M{"category": cOID}})
-	} else {
-		cond = nil
+		match["category"] = cOID
+	}
+	if !since.IsZero() {
+		match["createdAt"] = bson.M{"$gte": since}
 	}
 
-	posts, err := FindPostsWithPreview(&cond, skip, limit, sortByLikeCount)
-	return posts, err
+	cond := []bson.M{bson.M{"$match": match}}
+
+	return FindPostsWithPreview(&cond, sort, page, excludedAuthors)
 }
 
-func FindPostsWithPreview(matchingCond *[]bson.M, skip int, limit int, sortByLikeCount bool) ([]*PostPreview, error) {
-	var posts []*PostPreview
+// postAuthorLookupStage - Populate the author as an array, the domain and university are hidden for the anonymous posts
+func postAuthorLookupStage() bson.M {
+	return bson.M{
+		"$lookup": bson.M{
+			"from": "user",
+			"let":  bson.M{"author": "$author", "anonymous": "$anonymous"},
+			"pipeline": bson.A{
+				bson.M{"$match": bson.M{"$expr": bson.M{"$eq": bson.A{"$_id", "$$author"}}}},
+				universityLookupStage,
+				bson.M{"$project": bson.M{"_id": 1, "gender": publicGenderProjection(), "domain": bson.M{"$cond": bson.M{"if": bson.M{"$eq": bson.A{"$$anonymous", true}}, "then": "", "else": "$domain"}}, "university": universityProjection("$$anonymous")}},
+			},
+			"as": "author",
+		},
+	}
+}
+
+// postCategoryLookupStage - Populate the category as an array
+func postCategoryLookupStage() bson.M {
+	return bson.M{
+		"$lookup": bson.M{
+			"from": "postCategory",
+			"let":  bson.M{"category": "$category"},
+			"pipeline": bson.A{
+				bson.M{"$match": bson.M{"$expr": bson.M{"$eq": bson.A{"$_id", "$$category"}}}},
+				bson.M{"$project": bson.M{"categoryName": 1, "_id": 1}},
+			},
+			"as": "category",
+		},
+	}
+}
+
+// postPreviewProjection - The fields of the PostPreview after the lookups of the author and category, with the extra ones
+func postPreviewProjection(extra bson.M) bson.M {
+	projection := bson.M{
+		"_id":          1,
+		"likeCount":    bson.M{"$size": "$likers"},
+		"author":       bson.M{"$arrayElemAt": bson.A{"$author", 0}},
+		"category":     bson.M{"$arrayElemAt": bson.A{"$category", 0}},
+		"title":        1,
+		"previewText":  1,
+		"previewPhoto": 1,
+		"createdAt":    1,
+		"anonymous":    1,
+		"commentCount": 1,
+		"viewCount":    1,
+		"edited":       1,
+		"hotScore":     1,
+		"risingScore":  1,
+	}
+
+	for field, value := range extra {
+		projection[field] = value
+	}
+
+	return projection
+}
+
+// FindPostsWithPreview - The posts of the excludedAuthors are left out, see FindBlockRelatedUsers
+// The page continues after its cursor in the order of the sort
+func FindPostsWithPreview(matchingCond *[]bson.M, sort CursorSort, page *PageQuery, excludedAuthors []primitive.ObjectID) ([]*PostPreview, *PageInfo, error) {
+	posts := []*PostPreview{}
 
 	var pipeline = []bson.M{}
 
@@ -232,86 +332,47 @@ func FindPostsWithPreview(matchingCond *[]bson.M, skip int, limit int, sortByLik
 		pipeline = append(pipeline, *matchingCond...)
 	}
 
+	pipeline = append(pipeline, excludeAuthorsStage(excludedAuthors)...)
+
 	pipeline = append(pipeline, []bson.M{
 		// Populate Author
-		bson.M{
-			"$lookup": bson.M{
-				"from": "user",
-				"let":  bson.M{"author": "$author", "anonymous": "$anonymous"},
-				"pipeline": bson.A{
-					bson.M{"$match": bson.M{"$expr": bson.M{"$eq": bson.A{"$_id", "$$author"}}}},
-					bson.M{"$project": bson.M{"_id": 1, "gender": 1, "domain": bson.M{"$cond": bson.M{"if": bson.M{"$eq": bson.A{"$$anonymous", true}}, "then": "", "else": "$domain"}}}},
-				},
-				"as": "author",
-			},
-		},
+		postAuthorLookupStage(),
 		// Populate Category
-		bson.M{
-			"$lookup": bson.M{
-				"from": "postCategory",
-				"let":  bson.M{"category": "$category"},
-				"pipeline": bson.A{
-					bson.M{"$match": bson.M{"$expr": bson.M{"$eq": bson.A{"$_id", "$$category"}}}},
-					bson.M{"$project": bson.M{"categoryName": 1, "_id": 1}},
-				},
-				"as": "category",
-			},
-		},
+		postCategoryLookupStage(),
 		// Project
-		bson.M{
-			"$project": bson.M{
-				"_id":          1,
-				"likeCount":    bson.M{"$size": "$likers"},
-				"author":       bson.M{"$arrayElemAt": bson.A{"$author", 0}},
-				"category":     bson.M{"$arrayElemAt": bson.A{"$category", 0}},
-				"title":        1,
-				"previewText":  1,
-				"previewPhoto": 1,
-				"createdAt":    1,
-				"anonymous":    1,
-			},
-		},
-		// Sorting
-		bson.M{
-			"$sort": bson.M{"createdAt": -1},
-		},
+		bson.M{"$project": postPreviewProjection(nil)},
 	}...)
 
-	if sortByLikeCount {
-		pipeline = append(pipeline, bson.M{
-			"$sort": bson.M{
-				"likeCount": -1,
-			},
-		})
-	}
+	// Sorting and paging
+	pageStages, err := sort.Stages(page)
 
-	if skip > 0 {
-		pipeline = append(pipeline, bson.M{
-			"$skip": skip,
-		})
+	if err != nil {
+		return nil, nil, err
 	}
 
-	if limit > 0 {
-		pipeline = append(pipeline, bson.M{
-			"$limit": limit,
-		})
-	}
+	pipeline = append(pipeline, pageStages...)
 
 	result, err := database.PostCollection.Aggregate(context.TODO(), pipeline)
 	if result != nil {
 		defer result.Close(context.TODO())
 	}
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	err = result.All(context.TODO(), &posts)
 
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	return posts, nil
+	pageInfo, kept, err := sort.newPageInfo(page, posts)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return posts[:kept], pageInfo, nil
 
 }
 
@@ -339,29 +400,9 @@ func FindPostWithDetail(matchingCond *[]bson.M) ([]*PostDetail, error) {
 	pipeline = append(pipeline, []bson.M{
 
 		// Populate Author
-		bson.M{
-			"$lookup": bson.M{
-				"from": "user",
-				"let":  bson.M{"author": "$author", "anonymous": "$anonymous"},
-				"pipeline": bson.A{
-					bson.M{"$match": bson.M{"$expr": bson.M{"$eq": bson.A{"$_id", "$$author"}}}},
-					bson.M{"$project": bson.M{"_id": 1, "gender": 1, "domain": bson.M{"$cond": bson.M{"if": bson.M{"$eq": bson.A{"$$anonymous", true}}, "then": "", "else": "$domain"}}}},
-				},
-				"as": "author",
-			},
-		},
+		postAuthorLookupStage(),
 		// Populate Category
-		bson.M{
-			"$lookup": bson.M{
-				"from": "postCategory",
-				"let":  bson.M{"category": "$category"},
-				"pipeline": bson.A{
-					bson.M{"$match": bson.M{"$expr": bson.M{"$eq": bson.A{"$_id", "$$category"}}}},
-					bson.M{"$project": bson.M{"categoryName": 1, "_id": 1}},
-				},
-				"as": "category",
-			},
-		},
+		postCategoryLookupStage(),
 		// Project
 		bson.M{
 			"$project": bson.M{
@@ -376,6 +417,9 @@ func FindPostWithDetail(matchingCond *[]bson.M) ([]*PostDetail, error) {
 				"anonymous":    1,
 				"previewText":  1,
 				"previewPhoto": 1,
+				"commentCount": 1,
+				"viewCount":    1,
+				"edited":       1,
 			},
 		},
 		// Sorting
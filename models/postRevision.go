@@ -0,0 +1,193 @@
+package models
+
+import (
+	"context"
+	"quenc/database"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+)
+
+// PostRevision - PostRevision Schema, the content of a Post after an edit
+// The first revision is the content before the first edit, numbered 1
+type PostRevision struct {
+	ID           primitive.ObjectID  `json:"_id" bson:"_id,omitempty"`
+	Post         primitive.ObjectID  `json:"post" bson:"post"`
+	Number       int                 `json:"number" bson:"number"`
+	Editor       *primitive.ObjectID `json:"editor" bson:"editor"` // hidden from the others when the author of an anonymous post is the editor
+	Title        string              `json:"title" bson:"title"`
+	Content      string              `json:"content" bson:"content"`
+	PreviewText  string              `json:"previewText" bson:"previewText"`
+	PreviewPhoto string              `json:"previewPhoto" bson:"previewPhoto"`
+	Category     primitive.ObjectID  `json:"category" bson:"category"`
+	RestoredFrom int                 `json:"restoredFrom,omitempty" bson:"restoredFrom,omitempty"` // the number of the revision restored by an admin
+	CreatedAt    time.Time           `json:"createdAt" bson:"createdAt"`
+}
+
+// NewPostRevision - The revision of the current content of the Post
+func NewPostRevision(post *PostAdding, editor primitive.ObjectID, createdAt time.Time) *PostRevision {
+	return &PostRevision{
+		Post:         post.ID,
+		Editor:       &editor,
+		Title:        post.Title,
+		Content:      post.Content,
+		PreviewText:  post.PreviewText,
+		PreviewPhoto: post.PreviewPhoto,
+		Category:     post.Category,
+		CreatedAt:    createdAt,
+	}
+}
+
+// Apply - Set the content of the revision to the Post
+func (r *PostRevision) Apply(post *PostAdding) {
+	post.Title = r.Title
+	post.Content = r.Content
+	post.PreviewText = r.PreviewText
+	post.PreviewPhoto = r.PreviewPhoto
+	post.Category = r.Category
+}
+
+// EnsurePostRevisionIndexes - A number is used once for each Post
+func EnsurePostRevisionIndexes() error {
+	_, err := database.PostRevisionCollection.Indexes().CreateOne(context.TODO(), mongo.IndexModel{
+		Keys:    bson.D{{Key: "post", Value: 1}, {Key: "number", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	return err
+}
+
+// nextPostRevisionNumber - Take the next number for a revision of the Post, two edits never get the same one
+func nextPostRevisionNumber(pOID primitive.ObjectID) (int, error) {
+	var post PostAdding
+
+	err := database.PostCollection.FindOneAndUpdate(
+		context.TODO(),
+		bson.M{"_id": pOID},
+		bson.M{"$inc": bson.M{"revisionCount": 1}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After).SetProjection(bson.M{"revisionCount": 1}),
+	).Decode(&post)
+
+	return post.RevisionCount, err
+}
+
+// AddPostRevision - Adding PostRevision to MongoDB, numbered after the last revision of the Post
+func AddPostRevision(inputRevision *PostRevision) (interface{}, error) {
+	number, err := nextPostRevisionNumber(inputRevision.Post)
+
+	if err != nil {
+		return nil, err
+	}
+
+	inputRevision.Number = number
+
+	result, err := database.PostRevisionCollection.InsertOne(context.TODO(), inputRevision)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return result.InsertedID, nil
+}
+
+// EnsureBasePostRevision - Keep the content of the Post as its first revision, if it has none yet
+// The posts created before the revisions existed get it before their next edit, only the first of concurrent edits adds it
+func EnsureBasePostRevision(post *PostAdding) error {
+	result, err := database.PostCollection.UpdateOne(
+		context.TODO(),
+		bson.M{"_id": post.ID, "revisionCount": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"revisionCount": 1}},
+	)
+
+	if err != nil || result.ModifiedCount == 0 {
+		return err
+	}
+
+	createdAt := post.UpdatedAt
+	if createdAt.IsZero() {
+		createdAt = post.CreatedAt
+	}
+
+	base := NewPostRevision(post, post.Author, createdAt)
+	base.Number = 1
+
+	_, err = database.PostRevisionCollection.InsertOne(context.TODO(), base)
+
+	return err
+}
+
+// MigratePostRevisionCounts - Set the revision counters of the posts revised before the counters existed
+func MigratePostRevisionCounts() error {
+	result, err := database.PostRevisionCollection.Aggregate(context.TODO(), []bson.M{
+		bson.M{"$group": bson.M{"_id": "$post", "count": bson.M{"$max": "$number"}}},
+	})
+	if result != nil {
+		defer result.Close(context.TODO())
+	}
+
+	if err != nil {
+		return err
+	}
+
+	for result.Next(context.TODO()) {
+		var elem struct {
+			ID    primitive.ObjectID `bson:"_id"`
+			Count int                `bson:"count"`
+		}
+		if err := result.Decode(&elem); err != nil {
+			return err
+		}
+
+		if _, err := database.PostCollection.UpdateOne(
+			context.TODO(),
+			bson.M{"_id": elem.ID, "revisionCount": bson.M{"$exists": false}},
+			bson.M{"$set": bson.M{"revisionCount": elem.Count}},
+		); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// FindPostRevisions - The revisions of the Post, the oldest first
+func FindPostRevisions(pOID primitive.ObjectID) ([]*PostRevision, error) {
+	revisions := []*PostRevision{}
+
+	result, err := database.PostRevisionCollection.Find(
+		context.TODO(),
+		bson.M{"post": pOID},
+		options.Find().SetSort(bson.M{"number": 1}),
+	)
+	if result != nil {
+		defer result.Close(context.TODO())
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := result.All(context.TODO(), &revisions); err != nil {
+		return nil, err
+	}
+
+	return revisions, nil
+}
+
+// FindPostRevision - Find the revision of the Post by its number
+func FindPostRevision(pOID primitive.ObjectID, number int) (*PostRevision, error) {
+	var revision PostRevision
+
+	err := database.PostRevisionCollection.FindOne(context.TODO(), bson.M{"post": pOID, "number": number}).Decode(&revision)
+
+	return &revision, err
+}
+
+// DeletePostRevisions - Delete the revisions of the Posts
+func DeletePostRevisions(pOIDs []primitive.ObjectID) error {
+	_, err := database.PostRevisionCollection.DeleteMany(context.TODO(), bson.M{"post": bson.M{"$in": pOIDs}})
+	return err
+}
@@ -0,0 +1,271 @@
+package models
+
+import (
+	"context"
+	"log"
+	"math"
+	"quenc/database"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+)
+
+const (
+	// The engagement of a post is the weighted sum of its likes, comments and views
+	PostScoreLikeWeight    = 1.0
+	PostScoreCommentWeight = 2.0
+	PostScoreViewWeight    = 0.1
+
+	// PostHotGravity - How fast the hot score decays, it's divided by (age in hours + 2) ^ gravity
+	PostHotGravity = 1.5
+	// PostHotMaxAge - The posts older than it are not hot anymore, their hot score is kept at 0
+	PostHotMaxAge = 30 * 24 * time.Hour
+
+	// PostRisingHalfLife - How long it takes for the engagement counted in the rising score to halve
+	PostRisingHalfLife = 6 * time.Hour
+	// PostRisingMaxAge - Only the posts younger than it are rising
+	PostRisingMaxAge = 3 * 24 * time.Hour
+	// PostViewWindow - A User's views of a post are counted once in it
+	PostViewWindow = 24 * time.Hour
+
+	// postRisingMinScore - The rising scores below it are cleared, so the decay only goes through the active posts
+	postRisingMinScore = 0.01
+)
+
+// PostTopWindows - The windows of the top sort, the posts created within it are ranked by the likes
+var PostTopWindows = map[string]time.Duration{
+	"day":   24 * time.Hour,
+	"week":  7 * 24 * time.Hour,
+	"month": 30 * 24 * time.Hour,
+}
+
+// postHotDecay - What the engagement of a post of the age is divided by for the hot score
+func postHotDecay(age time.Duration) float64 {
+	return math.Pow(math.Max(0, age.Hours())+2, PostHotGravity)
+}
+
+// PostHotScore - The time-decayed engagement of a post of the age
+func PostHotScore(likes int, comments int, views int, age time.Duration) float64 {
+	if age > PostHotMaxAge {
+		return 0
+	}
+
+	engagement := float64(likes)*PostScoreLikeWeight + float64(comments)*PostScoreCommentWeight + float64(views)*PostScoreViewWeight
+
+	return engagement / postHotDecay(age)
+}
+
+// addPostEngagement - Add to the counter of the post, and the weighted change to its hot and rising scores
+// The age is taken from the OID, the decay of the rest of the hot score is caught up by RecomputePostScores
+func addPostEngagement(pOID primitive.ObjectID, counter string, delta int, weight float64) error {
+	age := time.Since(pOID.Timestamp())
+	inc := bson.M{}
+
+	if counter != "" {
+		inc[counter] = delta
+	}
+
+	if age <= PostHotMaxAge {
+		inc["hotScore"] = float64(delta) * weight / postHotDecay(age)
+	}
+
+	if age <= PostRisingMaxAge {
+		inc["risingScore"] = float64(delta) * weight
+	}
+
+	if len(inc) == 0 {
+		return nil
+	}
+
+	_, err := database.PostCollection.UpdateOne(context.TODO(), bson.M{"_id": pOID}, bson.M{"$inc": inc})
+
+	return err
+}
+
+// RecordPostView - Mark the post as seen by the User, and count the view once in PostViewWindow
+// The views of the guests are not counted, so refreshing can't push a post up the rankings
+func RecordPostView(pOID primitive.ObjectID, uOID primitive.ObjectID) error {
+	now := time.Now()
+
+	if err := MarkPostsSeen(uOID, []primitive.ObjectID{pOID}); err != nil {
+		return err
+	}
+
+	result, err := database.SeenPostCollection.UpdateOne(
+		context.TODO(),
+		bson.M{"user": uOID, "post": pOID, "$or": bson.A{
+			bson.M{"viewedAt": bson.M{"$exists": false}},
+			bson.M{"viewedAt": bson.M{"$lt": now.Add(-PostViewWindow)}},
+		}},
+		bson.M{"$set": bson.M{"viewedAt": now}},
+	)
+
+	if err != nil || result.ModifiedCount == 0 {
+		return err
+	}
+
+	return addPostEngagement(pOID, "viewCount", 1, PostScoreViewWeight)
+}
+
+// countCommentsOfPosts - The number of the comments of each post
+func countCommentsOfPosts(pOIDs []primitive.ObjectID) (map[primitive.ObjectID]int, error) {
+	counts := map[primitive.ObjectID]int{}
+
+	result, err := database.CommentCollection.Aggregate(context.TODO(), []bson.M{
+		bson.M{"$match": bson.M{"belongPost": bson.M{"$in": pOIDs}}},
+		bson.M{"$group": bson.M{"_id": "$belongPost", "count": bson.M{"$sum": 1}}},
+	})
+	if result != nil {
+		defer result.Close(context.TODO())
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	for result.Next(context.TODO()) {
+		var elem struct {
+			ID    primitive.ObjectID `bson:"_id"`
+			Count int                `bson:"count"`
+		}
+		if err := result.Decode(&elem); err != nil {
+			return nil, err
+		}
+		counts[elem.ID] = elem.Count
+	}
+
+	return counts, nil
+}
+
+// postHotScoreExpression - PostHotScore as an aggregation expression over the fields of the post
+func postHotScoreExpression(now time.Time) bson.M {
+	engagement := bson.M{"$add": bson.A{
+		bson.M{"$multiply": bson.A{bson.M{"$size": bson.M{"$ifNull": bson.A{"$likers", bson.A{}}}}, PostScoreLikeWeight}},
+		bson.M{"$multiply": bson.A{bson.M{"$ifNull": bson.A{"$commentCount", 0}}, PostScoreCommentWeight}},
+		bson.M{"$multiply": bson.A{bson.M{"$ifNull": bson.A{"$viewCount", 0}}, PostScoreViewWeight}},
+	}}
+
+	ageHours := bson.M{"$divide": bson.A{bson.M{"$subtract": bson.A{now, "$createdAt"}}, time.Hour.Milliseconds()}}
+
+	return bson.M{"$divide": bson.A{
+		engagement,
+		bson.M{"$pow": bson.A{bson.M{"$add": bson.A{bson.M{"$max": bson.A{0, ageHours}}, 2}}, PostHotGravity}},
+	}}
+}
+
+// RecomputePostScores - Recompute the hot scores of the posts younger than PostHotMaxAge, the older ones which still have one are cleared
+// The scores are computed by the update from the counters in the posts, so the engagement added meanwhile is not overwritten
+func RecomputePostScores(now time.Time) error {
+	_, err := database.PostCollection.UpdateMany(
+		context.TODO(),
+		bson.M{"createdAt": bson.M{"$gte": now.Add(-PostHotMaxAge)}},
+		bson.A{bson.M{"$set": bson.M{"hotScore": postHotScoreExpression(now)}}},
+	)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = UpdatePosts(
+		bson.M{"createdAt": bson.M{"$lt": now.Add(-PostHotMaxAge)}, "hotScore": bson.M{"$ne": 0}},
+		bson.M{"hotScore": 0},
+	)
+
+	return err
+}
+
+// DecayRisingScores - Halve the rising scores every PostRisingHalfLife of the elapsed time
+// The scores of the posts older than PostRisingMaxAge, and the ones which have decayed away, are cleared
+func DecayRisingScores(now time.Time, elapsed time.Duration) error {
+	_, err := database.PostCollection.UpdateMany(
+		context.TODO(),
+		bson.M{"risingScore": bson.M{"$gt": 0}},
+		bson.M{"$mul": bson.M{"risingScore": math.Pow(0.5, float64(elapsed)/float64(PostRisingHalfLife))}},
+	)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = UpdatePosts(
+		bson.M{"risingScore": bson.M{"$ne": 0}, "$or": bson.A{
+			bson.M{"risingScore": bson.M{"$lt": postRisingMinScore}},
+			bson.M{"createdAt": bson.M{"$lt": now.Add(-PostRisingMaxAge)}},
+		}},
+		bson.M{"risingScore": 0},
+	)
+
+	return err
+}
+
+// RunPostScoreUpdates - Recompute the hot scores and decay the rising scores every interval
+func RunPostScoreUpdates(interval time.Duration) {
+	last := time.Now()
+
+	for {
+		time.Sleep(interval)
+
+		now := time.Now()
+
+		if err := RecomputePostScores(now); err != nil {
+			log.Printf("Cannot recompute the post scores: %+v", err)
+		}
+
+		if err := DecayRisingScores(now, now.Sub(last)); err != nil {
+			log.Printf("Cannot decay the rising scores: %+v", err)
+		}
+
+		last = now
+	}
+}
+
+// EnsurePostScoreIndexes - The index for the posts within the windows of the sorts and RecomputePostScores
+func EnsurePostScoreIndexes() error {
+	_, err := database.PostCollection.Indexes().CreateOne(context.TODO(), mongo.IndexModel{
+		Keys: bson.D{{Key: "createdAt", Value: -1}},
+	})
+
+	return err
+}
+
+// MigratePostScores - Fill in the counters and scores of the posts created before the sorts existed
+func MigratePostScores() error {
+	posts, err := FindPosts(
+		bson.M{"hotScore": bson.M{"$exists": false}},
+		options.Find().SetProjection(bson.M{"_id": 1, "likers": 1, "createdAt": 1}),
+	)
+
+	if err != nil || len(posts) == 0 {
+		return err
+	}
+
+	pOIDs := []primitive.ObjectID{}
+	for _, post := range posts {
+		pOIDs = append(pOIDs, post.ID)
+	}
+
+	comments, err := countCommentsOfPosts(pOIDs)
+
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+
+	for _, post := range posts {
+		if _, err := UpdatePostByOID(post.ID, bson.M{
+			"commentCount": comments[post.ID],
+			"viewCount":    0,
+			"hotScore":     PostHotScore(len(post.Likers), comments[post.ID], 0, now.Sub(post.CreatedAt)),
+			"risingScore":  0,
+		}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,222 @@
+package models
+
+import (
+	"context"
+	"log"
+	"quenc/database"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+)
+
+// The presence of a User
+const (
+	PresenceOnline = "online"
+	PresenceAway   = "away"
+)
+
+const (
+	// PresenceWriteInterval - How often the lastSeen of an active User is written
+	PresenceWriteInterval = time.Minute
+	// PresenceTimeout - A User who hasn't been seen for this long is away, even without a disconnect
+	PresenceTimeout = 3 * time.Minute
+)
+
+// FriendStatus - The online status of a friend, both are hidden when the friend keeps the lastSeen private
+type FriendStatus struct {
+	ID       primitive.ObjectID `json:"_id"`
+	Online   *bool              `json:"online,omitempty"`
+	LastSeen *time.Time         `json:"lastSeen,omitempty"`
+}
+
+// The fields needed for the FriendStatus
+var projectionForFriendStatus = bson.M{
+	"_id":      1,
+	"presence": 1,
+	"lastSeen": 1,
+	"friends":  1,
+	"privacy":  1,
+}
+
+// The open connections of each User in this process
+var presenceConnections = struct {
+	sync.Mutex
+	counts map[primitive.ObjectID]int
+}{counts: map[primitive.ObjectID]int{}}
+
+// IsOnline - Whether the User is online and has been seen recently
+func (u *User) IsOnline() bool {
+	return u.Presence == PresenceOnline && time.Since(u.LastSeen) < PresenceTimeout
+}
+
+// NeedsPresenceTouch - Whether the presence should be written for an activity of the User, not on every request
+func (u *User) NeedsPresenceTouch() bool {
+	return u.Presence != PresenceOnline || time.Since(u.LastSeen) > PresenceWriteInterval
+}
+
+// StatusFor - The status of the User as seen by the viewer, following the lastSeen privacy
+func (u *User) StatusFor(viewer *User) *FriendStatus {
+	status := FriendStatus{ID: u.ID}
+
+	if profile := u.PublicProfileFor(viewer); profile.LastSeen != nil {
+		online := u.IsOnline()
+		status.Online = &online
+		status.LastSeen = profile.LastSeen
+	}
+
+	return &status
+}
+
+// TouchPresence - Mark the User online and seen now
+func TouchPresence(uOID primitive.ObjectID) (*mongo.UpdateResult, error) {
+	return database.UserCollection.UpdateOne(
+		context.TODO(),
+		bson.M{"_id": uOID},
+		bson.M{"$set": bson.M{"presence": PresenceOnline, "lastSeen": time.Now()}},
+	)
+}
+
+// MarkAway - Mark the User away, the lastSeen is the time of leaving
+func MarkAway(uOID primitive.ObjectID) (*mongo.UpdateResult, error) {
+	return database.UserCollection.UpdateOne(
+		context.TODO(),
+		bson.M{"_id": uOID},
+		bson.M{"$set": bson.M{"presence": PresenceAway, "lastSeen": time.Now()}},
+	)
+}
+
+// ConnectPresence - Keep the User online while the connection is open, the returned function is called on disconnect
+// The lastSeen is written every PresenceWriteInterval, and the User is marked away when the last connection closes
+func ConnectPresence(uOID primitive.ObjectID) func() {
+	presenceConnections.Lock()
+	presenceConnections.counts[uOID]++
+	presenceConnections.Unlock()
+
+	if _, err := TouchPresence(uOID); err != nil {
+		log.Printf("Cannot mark %+v online: %+v", uOID, err)
+	}
+
+	done := make(chan struct{})
+
+	go func() {
+		ticker := time.NewTicker(PresenceWriteInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				if _, err := TouchPresence(uOID); err != nil {
+					log.Printf("Cannot update the lastSeen of %+v: %+v", uOID, err)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	var once sync.Once
+
+	return func() {
+		once.Do(func() {
+			close(done)
+
+			presenceConnections.Lock()
+			presenceConnections.counts[uOID]--
+			last := presenceConnections.counts[uOID] <= 0
+			if last {
+				delete(presenceConnections.counts, uOID)
+			}
+			presenceConnections.Unlock()
+
+			if !last {
+				return
+			}
+
+			if _, err := MarkAway(uOID); err != nil {
+				log.Printf("Cannot mark %+v away: %+v", uOID, err)
+			}
+		})
+	}
+}
+
+// MarkIdleUsersAway - Mark the online Users away once they haven't been seen for PresenceTimeout
+// These are the ones only making requests, or whose server stopped before the disconnect
+func MarkIdleUsersAway() (*mongo.UpdateResult, error) {
+	return database.UserCollection.UpdateMany(
+		context.TODO(),
+		bson.M{
+			"presence": PresenceOnline,
+			"lastSeen": bson.M{"$lt": time.Now().Add(-PresenceTimeout)},
+		},
+		bson.M{"$set": bson.M{"presence": PresenceAway}},
+	)
+}
+
+// RunPresenceSweeps - Mark the idle Users away every interval, it never returns
+func RunPresenceSweeps(interval time.Duration) {
+	for {
+		if _, err := MarkIdleUsersAway(); err != nil {
+			log.Printf("Cannot mark the idle users away: %+v", err)
+		}
+		time.Sleep(interval)
+	}
+}
+
+// FindFriendStatuses - The online status of the friends of the User
+func FindFriendStatuses(user *User) ([]*FriendStatus, error) {
+	var friends []*User
+
+	if len(user.Friends) == 0 {
+		return []*FriendStatus{}, nil
+	}
+
+	result, err := database.UserCollection.Find(
+		context.TODO(),
+		bson.M{"_id": bson.M{"$in": user.Friends}},
+		options.Find().SetProjection(projectionForFriendStatus),
+	)
+	if result != nil {
+		defer result.Close(context.TODO())
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = result.All(context.TODO(), &friends)
+
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := []*FriendStatus{}
+	for _, friend := range friends {
+		statuses = append(statuses, friend.StatusFor(user))
+	}
+
+	return statuses, nil
+}
+
+// WatchFriendPresence - Watch the presence, lastSeen and privacy changes of the friends
+func WatchFriendPresence(friends []primitive.ObjectID) (*mongo.ChangeStream, error) {
+	pipeline := []bson.M{
+		bson.M{
+			"$match": bson.M{
+				"operationType":   "update",
+				"documentKey._id": bson.M{"$in": append([]primitive.ObjectID{}, friends...)},
+				"$or": bson.A{
+					bson.M{"updateDescription.updatedFields.presence": bson.M{"$exists": true}},
+					bson.M{"updateDescription.updatedFields.lastSeen": bson.M{"$exists": true}},
+					bson.M{"updateDescription.updatedFields.privacy": bson.M{"$exists": true}},
+				},
+			},
+		},
+	}
+	changeStreamOption := options.ChangeStream().SetFullDocument(options.UpdateLookup)
+	return WatchUser(pipeline, changeStreamOption)
+}
@@ -0,0 +1,161 @@
+package models
+
+import (
+	"context"
+	"quenc/database"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+
+)
+
+// Who can see a field of the profile
+const (
+	PrivacyPublic  = "public"
+	PrivacyFriends = "friends"
+	PrivacyPrivate = "private" // only the User
+)
+
+// GenderUnknown - The gender of the Users who haven't given it, or hide it
+const GenderUnknown = -1
+
+// PrivacySettings - Who can see each field, the empty ones follow DefaultPrivacySettings
+type PrivacySettings struct {
+	Major    string `json:"major" bson:"major,omitempty"`
+	Dob      string `json:"dob" bson:"dob,omitempty"`
+	Gender   string `json:"gender" bson:"gender,omitempty"`
+	LastSeen string `json:"lastSeen" bson:"lastSeen,omitempty"`
+	Friends  string `json:"friends" bson:"friends,omitempty"`
+}
+
+// DefaultPrivacySettings - The major and gender were always shown with the posts, so they stay public
+var DefaultPrivacySettings = PrivacySettings{
+	Major:    PrivacyPublic,
+	Dob:      PrivacyFriends,
+	Gender:   PrivacyPublic,
+	LastSeen: PrivacyFriends,
+	Friends:  PrivacyFriends,
+}
+
+// PublicProfile - The User as seen by another User, the hidden fields are left out
+type PublicProfile struct {
+	ID       primitive.ObjectID   `json:"_id"`
+	Name     string               `json:"name"`
+	PhotoURL string               `json:"photoURL"`
+	Domain   string               `json:"domain"`
+	Major    *string              `json:"major,omitempty"`
+	Dob      *string              `json:"dob,omitempty"`
+	Gender   *int                 `json:"gender,omitempty"`
+	LastSeen *time.Time           `json:"lastSeen,omitempty"`
+	Friends  []primitive.ObjectID `json:"friends,omitempty"`
+	IsFriend bool                 `json:"isFriend"`
+}
+
+// IsValidPrivacy - Whether the setting is public, friends or private
+func IsValidPrivacy(privacy string) bool {
+	return privacy == PrivacyPublic || privacy == PrivacyFriends || privacy == PrivacyPrivate
+}
+
+// PrivacySettings - The settings of the User with the defaults filled in
+func (u *User) PrivacySettings() PrivacySettings {
+	settings := DefaultPrivacySettings
+
+	if u.Privacy == nil {
+		return settings
+	}
+
+	if u.Privacy.Major != "" {
+		settings.Major = u.Privacy.Major
+	}
+	if u.Privacy.Dob != "" {
+		settings.Dob = u.Privacy.Dob
+	}
+	if u.Privacy.Gender != "" {
+		settings.Gender = u.Privacy.Gender
+	}
+	if u.Privacy.LastSeen != "" {
+		settings.LastSeen = u.Privacy.LastSeen
+	}
+	if u.Privacy.Friends != "" {
+		settings.Friends = u.Privacy.Friends
+	}
+
+	return settings
+}
+
+// PublicProfileFor - The profile of the User as seen by the viewer, nil for the guests
+func (u *User) PublicProfileFor(viewer *User) *PublicProfile {
+	isSelf := viewer != nil && viewer.ID == u.ID
+	isFriend := viewer != nil && u.IsFriendOf(viewer.ID)
+
+	canSee := func(privacy string) bool {
+		switch privacy {
+		case PrivacyPublic:
+			return true
+		case PrivacyFriends:
+			return isSelf || isFriend
+		default:
+			return isSelf
+		}
+	}
+
+	settings := u.PrivacySettings()
+	profile := PublicProfile{
+		ID:       u.ID,
+		Name:     u.Name,
+		PhotoURL: u.PhotoURL,
+		Domain:   u.Domain,
+		IsFriend: isFriend,
+	}
+
+	if canSee(settings.Major) {
+		profile.Major = &u.Major
+	}
+	if canSee(settings.Dob) {
+		profile.Dob = &u.Dob
+	}
+	if canSee(settings.Gender) {
+		profile.Gender = &u.Gender
+	}
+	if canSee(settings.LastSeen) {
+		profile.LastSeen = &u.LastSeen
+	}
+	if canSee(settings.Friends) {
+		profile.Friends = append([]primitive.ObjectID{}, u.Friends...)
+	}
+
+	return &profile
+}
+
+// UpdatePrivacySettings - Replace the privacy settings of the User
+func UpdatePrivacySettings(uOID primitive.ObjectID, settings *PrivacySettings) (*mongo.UpdateResult, error) {
+	return database.UserCollection.UpdateOne(
+		context.TODO(),
+		bson.M{"_id": uOID},
+		bson.M{"$set": bson.M{"privacy": settings}},
+	)
+}
+
+// publicFieldProjection - Project the field of the User only if it's public, hidden otherwise
+// The lookups don't know the viewer, so the friends-only fields are hidden as well
+func publicFieldProjection(field string, defaultPrivacy string, hidden interface{}) bson.M {
+	return bson.M{
+		"$cond": bson.M{
+			"if":   bson.M{"$eq": bson.A{bson.M{"$ifNull": bson.A{"$privacy." + field, defaultPrivacy}}, PrivacyPublic}},
+			"then": "$" + field,
+			"else": hidden,
+		},
+	}
+}
+
+// publicGenderProjection - The gender for the lookups, GenderUnknown if it's not public
+func publicGenderProjection() bson.M {
+	return publicFieldProjection("gender", DefaultPrivacySettings.Gender, GenderUnknown)
+}
+
+// publicMajorProjection - The major for the lookups, removed if it's not public
+func publicMajorProjection() bson.M {
+	return publicFieldProjection("major", DefaultPrivacySettings.Major, "$$REMOVE")
+}
@@ -0,0 +1,89 @@
+package models
+
+import (
+	"context"
+	"quenc/database"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// RefreshToken - RefreshToken Schema
+// Only the hash of the token is stored, every token issued from the same login shares a Family
+type RefreshToken struct {
+	ID        primitive.ObjectID `json:"_id" bson:"_id,omitempty"`
+	User      primitive.ObjectID `json:"user" bson:"user"`
+	Family    primitive.ObjectID `json:"family" bson:"family"`
+	TokenHash string             `json:"-" bson:"tokenHash"`
+	Used      bool               `json:"used" bson:"used"`
+	Revoked   bool               `json:"revoked" bson:"revoked"`
+	ExpiresAt time.Time          `json:"expiresAt" bson:"expiresAt"`
+	CreatedAt time.Time          `json:"createdAt" bson:"createdAt"`
+}
+
+// AddRefreshToken - Adding RefreshToken to MongoDB
+func AddRefreshToken(inputToken *RefreshToken) (interface{}, error) {
+
+	result, err := database.RefreshTokenCollection.InsertOne(context.TODO(), inputToken)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return result.InsertedID, nil
+}
+
+// FindRefreshTokenByHash - Find RefreshToken by the hash of the token
+func FindRefreshTokenByHash(tokenHash string) (*RefreshToken, error) {
+	var token RefreshToken
+
+	err := database.RefreshTokenCollection.FindOne(context.TODO(), bson.M{"tokenHash": tokenHash}).Decode(&token)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &token, nil
+}
+
+// MarkRefreshTokenUsed - Mark the token as used, return false if it has been used or revoked already
+func MarkRefreshTokenUsed(oid primitive.ObjectID) (bool, error) {
+
+	result, err := database.RefreshTokenCollection.UpdateOne(
+		context.TODO(),
+		bson.M{"_id": oid, "used": false, "revoked": false},
+		bson.M{"$set": bson.M{"used": true}},
+	)
+
+	if err != nil {
+		return false, err
+	}
+
+	return result.ModifiedCount == 1, nil
+}
+
+// RevokeRefreshTokenFamily - Revoke every token issued in the same family
+func RevokeRefreshTokenFamily(family primitive.ObjectID) (*mongo.UpdateResult, error) {
+
+	result, err := database.RefreshTokenCollection.UpdateMany(
+		context.TODO(),
+		bson.M{"family": family},
+		bson.M{"$set": bson.M{"revoked": true}},
+	)
+
+	return result, err
+}
+
+// RevokeRefreshTokensForUser - Revoke every token belonging to the user
+func RevokeRefreshTokensForUser(uOID primitive.ObjectID) (*mongo.UpdateResult, error) {
+
+	result, err := database.RefreshTokenCollection.UpdateMany(
+		context.TODO(),
+		bson.M{"user": uOID},
+		bson.M{"$set": bson.M{"revoked": true}},
+	)
+
+	return result, err
+}
@@ -11,6 +11,9 @@ import (
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
+// ReportSortOldest - The order of the report listings, the old ones have waited longer
+var ReportSortOldest = CursorSort{Field: "createdAt", Order: 1}
+
 // 回傳Report時, 需要Populate什麼
 // Author
 // ReportID
@@ -24,6 +27,7 @@ type ReportAdding struct {
 	Solve        bool                   `json:"solve" bson:"solve"`
 	Author       primitive.ObjectID     `json:"author" bson:"author"`
 	ReportID     primitive.ObjectID     `json:"reportId" bson:"reportId"`
+	Category     *primitive.ObjectID    `json:"category" bson:"category,omitempty"` // the PostCategory of the reported post or comment
 	CreatedAt    time.Time              `json:"createdAt" bson:"createdAt"`
 	ReportObject map[string]interface{} `json:"c" bson:"reportObject"`
 }
@@ -46,6 +50,7 @@ type ReportDetail struct {
 	Solve        bool                   `json:"solve" bson:"solve"`
 	Author       User                   `json:"author" bson:"author"`
 	ReportID     primitive.ObjectID     `json:"reportId" bson:"reportId"`
+	Category     *primitive.ObjectID    `json:"category" bson:"category,omitempty"`
 	CreatedAt    time.Time              `json:"createdAt" bson:"createdAt"`
 	ReportObject map[string]interface{} `json:"reportObject" bson:"reportObject"`
 }
@@ -112,19 +117,17 @@ func FindReports(filterDetail bson.M, findOptions *options.FindOptions) ([]*Repo
 	return reports, nil
 }
 
-func FindAllReporstWithPreview(skip int, limit int) ([]*ReportPreview, error) {
-	reports, err := FindReportsWithPreview(nil, skip, limit)
-	return reports, err
+func FindAllReporstWithPreview(page *PageQuery) ([]*ReportPreview, *PageInfo, error) {
+	return FindReportsWithPreview(nil, page)
 }
 
-func FindAllReporstWithDetail(skip int, limit int) ([]*ReportDetail, error) {
-	reports, err := FindReportsWithDetail(nil, skip, limit)
-	return reports, err
+func FindAllReporstWithDetail(page *PageQuery) ([]*ReportDetail, *PageInfo, error) {
+	return FindReportsWithDetail(nil, page)
 }
 
-func FindReportsWithPreview(matchingCond *[]bson.M, skip int, limit int) ([]*ReportPreview, error) {
+func FindReportsWithPreview(matchingCond *[]bson.M, page *PageQuery) ([]*ReportPreview, *PageInfo, error) {
 	// This will return the report sort by createdAt
-	var reports []*ReportPreview
+	reports := []*ReportPreview{}
 
 	var pipeline = []bson.M{}
 
@@ -141,7 +144,7 @@ func FindReportsWithPreview(matchingCond *[]bson.M, skip int, limit int) ([]*Rep
 				"let":  bson.M{"author": "$author"},
 				"pipeline": bson.A{
 					bson.M{"$match": bson.M{"$expr": bson.M{"$eq": bson.A{"$_id", "$$author"}}}},
-					bson.M{"$project": bson.M{"_id": 1, "gender": 1, "domain": 1}},
+					bson.M{"$project": bson.M{"_id": 1, "gender": publicGenderProjection(), "domain": 1}},
 				},
 				"as": "author",
 			},
@@ -158,46 +161,45 @@ func FindReportsWithPreview(matchingCond *[]bson.M, skip int, limit int) ([]*Rep
 				"_id":          1,
 			},
 		},
-		// Sort by createdAt
-		// Old one go higher
-		bson.M{
-			"$sort": bson.M{"createdAt": 1},
-		},
 	}...)
 
-	if skip > 0 {
-		pipeline = append(pipeline, bson.M{
-			"$skip": skip,
-		})
-	}
+	// Sort by createdAt
+	// Old one go higher
+	pageStages, err := ReportSortOldest.Stages(page)
 
-	if limit > 0 {
-		pipeline = append(pipeline, bson.M{
-			"$limit": limit,
-		})
+	if err != nil {
+		return nil, nil, err
 	}
 
+	pipeline = append(pipeline, pageStages...)
+
 	result, err := database.ReportCollection.Aggregate(context.TODO(), pipeline)
 	if result != nil {
 		defer result.Close(context.TODO())
 	}
 
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	err = result.All(context.TODO(), &reports)
 
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	return reports, nil
+	pageInfo, kept, err := ReportSortOldest.newPageInfo(page, reports)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return reports[:kept], pageInfo, nil
 }
 
-func FindReportsWithDetail(matchingCond *[]bson.M, skip int, limit int) ([]*ReportDetail, error) {
+func FindReportsWithDetail(matchingCond *[]bson.M, page *PageQuery) ([]*ReportDetail, *PageInfo, error) {
 	// This will return the report sort by createdAt
-	var reports []*ReportDetail
+	reports := []*ReportDetail{}
 
 	var pipeline = []bson.M{}
 
@@ -214,7 +216,7 @@ func FindReportsWithDetail(matchingCond *[]bson.M, skip int, limit int) ([]*Repo
 				"let":  bson.M{"author": "$author"},
 				"pipeline": bson.A{
 					bson.M{"$match": bson.M{"$expr": bson.M{"$eq": bson.A{"$_id", "$$author"}}}},
-					bson.M{"$project": bson.M{"_id": 1, "gender": 1, "domain": 1}},
+					bson.M{"$project": bson.M{"_id": 1, "gender": publicGenderProjection(), "domain": 1}},
 				},
 				"as": "author",
 			},
@@ -232,43 +234,43 @@ func FindReportsWithDetail(matchingCond *[]bson.M, skip int, limit int) ([]*Repo
 				"_id":          1,
 				"content":      1,
 				"reportId":     1,
+				"category":     1,
 			},
 		},
-		// Sort by createdAt
-		// Old one go higher
-		bson.M{
-			"$sort": bson.M{"createdAt": 1},
-		},
 	}...)
 
-	if skip > 0 {
-		pipeline = append(pipeline, bson.M{
-			"$skip": skip,
-		})
-	}
+	// Sort by createdAt
+	// Old one go higher
+	pageStages, err := ReportSortOldest.Stages(page)
 
-	if limit > 0 {
-		pipeline = append(pipeline, bson.M{
-			"$limit": limit,
-		})
+	if err != nil {
+		return nil, nil, err
 	}
 
+	pipeline = append(pipeline, pageStages...)
+
 	result, err := database.ReportCollection.Aggregate(context.TODO(), pipeline)
 	if result != nil {
 		defer result.Close(context.TODO())
 	}
 
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	err = result.All(context.TODO(), &reports)
 
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	return reports, nil
+	pageInfo, kept, err := ReportSortOldest.newPageInfo(page, reports)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return reports[:kept], pageInfo, nil
 }
 
 func FindSingleReportWithDetail(rOID primitive.ObjectID) (*ReportDetail, error) {
@@ -296,7 +298,7 @@ func FindReportWithDetail(matchingCond *[]bson.M) ([]*ReportDetail, error) {
 				"let":  bson.M{"author": "$author"},
 				"pipeline": bson.A{
 					bson.M{"$match": bson.M{"$expr": bson.M{"$eq": bson.A{"$_id", "$$author"}}}},
-					bson.M{"$project": bson.M{"_id": 1, "gender": 1, "domain": 1}},
+					bson.M{"$project": bson.M{"_id": 1, "gender": publicGenderProjection(), "domain": 1}},
 				},
 				"as": "author",
 			},
@@ -314,6 +316,7 @@ func FindReportWithDetail(matchingCond *[]bson.M) ([]*ReportDetail, error) {
 				"solve":        1,
 				"createdAt":    1,
 				"reportId":     1,
+				"category":     1,
 				"_id":          1,
 			},
 		},
@@ -0,0 +1,312 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"quenc/database"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// ErrLastSuperAdmin - The change of the roles would leave nobody to manage them
+var ErrLastSuperAdmin = errors.New("cannot revoke the last super admin")
+
+// Roles of the Users
+const (
+	RoleSuperAdmin        = "super-admin"
+	RoleModerator         = "moderator"
+	RoleCategoryModerator = "category-moderator" // only for the categories in User.ModeratedCategories
+	RoleUser              = "user"
+	RoleSuspended         = "suspended" // read-only without any permission, like a suspension until the role is revoked
+)
+
+// Permissions granted by the roles
+const (
+	PermissionPostCreate       = "post.create"
+	PermissionPostUpdateAny    = "post.update.any"
+	PermissionPostDeleteAny    = "post.delete.any"
+	PermissionPostRestore      = "post.restore" // restore a previous revision of any post
+	PermissionCommentCreate    = "comment.create"
+	PermissionCommentUpdateAny = "comment.update.any"
+	PermissionCommentDeleteAny = "comment.delete.any"
+	PermissionReportCreate     = "report.create"
+	PermissionReportView       = "report.view"
+	PermissionReportResolve    = "report.resolve"
+	PermissionReportDelete     = "report.delete"
+	PermissionChatSend         = "chat.send"
+	PermissionCategoryManage   = "category.manage"
+	PermissionUniversityManage = "university.manage"
+	PermissionAuditView        = "audit.view"
+	PermissionRoleManage       = "role.manage"
+	PermissionUserModerate     = "user.moderate" // suspend and ban
+	PermissionUserManage       = "user.manage"   // list the users, verify the emails and force the password resets
+)
+
+// The permissions every signed up User has
+var userPermissions = []string{
+	PermissionPostCreate,
+	PermissionCommentCreate,
+	PermissionReportCreate,
+	PermissionChatSend,
+}
+
+// The permissions of moderating the content, category moderators have them for their categories only
+var contentModerationPermissions = []string{
+	PermissionPostUpdateAny,
+	PermissionPostDeleteAny,
+	PermissionCommentUpdateAny,
+	PermissionCommentDeleteAny,
+	PermissionReportView,
+	PermissionReportResolve,
+}
+
+// RolePermissions - The permissions of each role
+var RolePermissions = map[string][]string{
+	RoleSuperAdmin: joinPermissions(userPermissions, contentModerationPermissions, []string{
+		PermissionReportDelete,
+		PermissionUserModerate,
+		PermissionCategoryManage,
+		PermissionUniversityManage,
+		PermissionAuditView,
+		PermissionRoleManage,
+		PermissionUserManage,
+		PermissionPostRestore,
+	}),
+	RoleModerator:         joinPermissions(userPermissions, contentModerationPermissions, []string{PermissionReportDelete, PermissionUserModerate, PermissionPostRestore}),
+	RoleCategoryModerator: joinPermissions(userPermissions, contentModerationPermissions),
+	RoleUser:              joinPermissions(userPermissions),
+	RoleSuspended:         []string{},
+}
+
+func joinPermissions(lists ...[]string) []string {
+	joined := []string{}
+	for _, list := range lists {
+		joined = append(joined, list...)
+	}
+	return joined
+}
+
+// IsValidRole - Whether the role is one of the roles above
+func IsValidRole(role string) bool {
+	_, ok := RolePermissions[role]
+	return ok
+}
+
+// IsModerationPermission - Whether the permission is beyond what every User has
+// The two-factor authentication is required for these
+func IsModerationPermission(permission string) bool {
+	return !containsString(userPermissions, permission)
+}
+
+func containsString(list []string, s string) bool {
+	for _, e := range list {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
+
+// HasRole - Whether the User has the role
+func (u *User) HasRole(role string) bool {
+	return containsString(u.Roles, role)
+}
+
+// IsSuperAdmin - Whether the User is a super admin
+func (u *User) IsSuperAdmin() bool {
+	return u.HasRole(RoleSuperAdmin)
+}
+
+// IsStaff - Whether the User has any role with moderation permissions
+func (u *User) IsStaff() bool {
+	return u.HasRole(RoleSuperAdmin) || u.HasRole(RoleModerator) || u.HasRole(RoleCategoryModerator)
+}
+
+// HasPermission - Whether the User has the permission everywhere, the suspended Users have none
+// The category moderator role is not counted, see HasPermissionInCategory
+func (u *User) HasPermission(permission string) bool {
+	if u.IsSuspended() {
+		return false
+	}
+
+	for _, role := range u.Roles {
+		if role == RoleCategoryModerator {
+			continue
+		}
+		if containsString(RolePermissions[role], permission) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// HasPermissionInCategory - Whether the User has the permission for the content in the category
+func (u *User) HasPermissionInCategory(permission string, cOID primitive.ObjectID) bool {
+	if u.HasPermission(permission) {
+		return true
+	}
+
+	if u.IsSuspended() || !u.HasRole(RoleCategoryModerator) {
+		return false
+	}
+
+	if !containsString(RolePermissions[RoleCategoryModerator], permission) {
+		return false
+	}
+
+	for _, moderated := range u.ModeratedCategories {
+		if moderated == cOID {
+			return true
+		}
+	}
+
+	return false
+}
+
+// HasPermissionInAnyCategory - Whether the User has the permission everywhere or for some categories
+func (u *User) HasPermissionInAnyCategory(permission string) bool {
+	if u.HasPermission(permission) {
+		return true
+	}
+
+	return !u.IsSuspended() &&
+		u.HasRole(RoleCategoryModerator) &&
+		len(u.ModeratedCategories) > 0 &&
+		containsString(RolePermissions[RoleCategoryModerator], permission)
+}
+
+// Permissions - Every permission the User has, including the ones scoped to categories
+func (u *User) Permissions() []string {
+	permissions := []string{}
+
+	if u.IsSuspended() {
+		return permissions
+	}
+
+	seen := map[string]bool{}
+	for _, role := range u.Roles {
+		for _, p := range RolePermissions[role] {
+			if !seen[p] {
+				seen[p] = true
+				permissions = append(permissions, p)
+			}
+		}
+	}
+
+	return permissions
+}
+
+// GrantRoleToUser - Add the role to the User, the categories are added to the moderated ones for category moderators
+func GrantRoleToUser(uOID primitive.ObjectID, role string, categories []primitive.ObjectID) (*mongo.UpdateResult, error) {
+	update := bson.M{"$addToSet": bson.M{"roles": role}}
+
+	if role == RoleCategoryModerator && len(categories) > 0 {
+		update["$addToSet"] = bson.M{
+			"roles":               role,
+			"moderatedCategories": bson.M{"$each": categories},
+		}
+	}
+
+	return database.UserCollection.UpdateOne(context.TODO(), bson.M{"_id": uOID}, update)
+}
+
+// changeUserRoles - Make the change to the roles of the User, undone when it has left no super admin
+// The super admins are counted after the change rather than before, so two admins revoking each other at once are both undone
+func changeUserRoles(target *User, change func() (*mongo.UpdateResult, error)) (*mongo.UpdateResult, error) {
+	result, err := change()
+
+	if err != nil || !target.IsSuperAdmin() {
+		return result, err
+	}
+
+	count, err := CountUsersWithRole(RoleSuperAdmin)
+
+	if err != nil || count > 0 {
+		return result, err
+	}
+
+	if _, err := UpdateUserByOID(target.ID, bson.M{
+		"roles":               target.Roles,
+		"moderatedCategories": target.ModeratedCategories,
+	}); err != nil {
+		return nil, err
+	}
+
+	return nil, ErrLastSuperAdmin
+}
+
+// RevokeRoleFromUser - Remove the role from the User, ErrLastSuperAdmin is returned when nobody would be left to manage the roles
+// For category moderators only the given categories are removed, the role is removed with the last category
+func RevokeRoleFromUser(target *User, role string, categories []primitive.ObjectID) (*mongo.UpdateResult, error) {
+	return changeUserRoles(target, func() (*mongo.UpdateResult, error) {
+		if role == RoleCategoryModerator && len(categories) > 0 {
+			result, err := database.UserCollection.UpdateOne(
+				context.TODO(),
+				bson.M{"_id": target.ID},
+				bson.M{"$pullAll": bson.M{"moderatedCategories": categories}},
+			)
+
+			if err != nil {
+				return result, err
+			}
+
+			return database.UserCollection.UpdateOne(
+				context.TODO(),
+				bson.M{"_id": target.ID, "moderatedCategories": bson.M{"$size": 0}},
+				bson.M{"$pull": bson.M{"roles": role}},
+			)
+		}
+
+		update := bson.M{"$pull": bson.M{"roles": role}}
+
+		if role == RoleCategoryModerator {
+			update["$set"] = bson.M{"moderatedCategories": []primitive.ObjectID{}}
+		}
+
+		return database.UserCollection.UpdateOne(context.TODO(), bson.M{"_id": target.ID}, update)
+	})
+}
+
+// SetUserRoles - Replace the roles of the User, ErrLastSuperAdmin is returned when nobody would be left to manage the roles
+// The categories are only kept for category moderators
+func SetUserRoles(target *User, roles []string, categories []primitive.ObjectID) (*mongo.UpdateResult, error) {
+	if !containsString(roles, RoleCategoryModerator) || categories == nil {
+		categories = []primitive.ObjectID{}
+	}
+
+	return changeUserRoles(target, func() (*mongo.UpdateResult, error) {
+		return UpdateUserByOID(target.ID, bson.M{
+			"roles":               roles,
+			"moderatedCategories": categories,
+		})
+	})
+}
+
+// CountUsersWithRole - How many Users have the role
+func CountUsersWithRole(role string) (int64, error) {
+	return database.UserCollection.CountDocuments(context.TODO(), bson.M{"roles": role})
+}
+
+// MigrateUserRoles - Convert the old Role int (0 is admin) to the roles
+func MigrateUserRoles() error {
+	_, err := database.UserCollection.UpdateMany(
+		context.TODO(),
+		bson.M{"roles": bson.M{"$exists": false}, "role": 0},
+		bson.M{"$set": bson.M{"roles": []string{RoleSuperAdmin}}, "$unset": bson.M{"role": ""}},
+	)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = database.UserCollection.UpdateMany(
+		context.TODO(),
+		bson.M{"roles": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"roles": []string{RoleUser}}, "$unset": bson.M{"role": ""}},
+	)
+
+	return err
+}
@@ -0,0 +1,377 @@
+package models
+
+import (
+	"context"
+	"quenc/database"
+	"strings"
+	"time"
+	"unicode"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+)
+
+const (
+	// SearchRecencyHalfLife - How long it takes for the recency boost to halve
+	SearchRecencyHalfLife = 30 * 24 * time.Hour
+	// SearchRecencyWeight - The boost of a post created just now, a relevance of 1 is ranked as 1 + SearchRecencyWeight
+	SearchRecencyWeight = 1.0
+)
+
+// SearchFilter - The empty fields are not filtered
+// The domain is of the author, so the anonymous posts are never matched by it
+type SearchFilter struct {
+	Query     string
+	Category  *primitive.ObjectID
+	Domain    string
+	CreatedAt bson.M // the range of the createdAt, like {"$gte": from}
+}
+
+// PostSearchResult - A found Post with its rank
+type PostSearchResult struct {
+	PostPreview `bson:",inline"`
+	Score       float64 `json:"score" bson:"score"`
+}
+
+// CommentSearchResult - A found Comment with its rank and the Post it belongs to
+type CommentSearchResult struct {
+	CommentDetail `bson:",inline"`
+	Post          *PostPreview `json:"post" bson:"post"`
+	Score         float64      `json:"score" bson:"score"`
+}
+
+// isCJK - Whether the rune is written without spaces between the words
+func isCJK(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul)
+}
+
+// cjkRuns - The runs of CJK characters in the text
+func cjkRuns(text string) [][]rune {
+	runs := [][]rune{}
+	run := []rune{}
+
+	for _, r := range text {
+		if isCJK(r) {
+			run = append(run, r)
+			continue
+		}
+		if len(run) > 0 {
+			runs = append(runs, run)
+			run = []rune{}
+		}
+	}
+
+	if len(run) > 0 {
+		runs = append(runs, run)
+	}
+
+	return runs
+}
+
+// SearchGrams - The n-grams of the CJK text for the text index, which can only split the words by spaces
+// Every character and every bigram of the CJK runs is given, the other words are left to the index
+func SearchGrams(texts ...string) string {
+	grams := []string{}
+
+	for _, text := range texts {
+		for _, run := range cjkRuns(text) {
+			for i := range run {
+				grams = append(grams, string(run[i]))
+				if i+1 < len(run) {
+					grams = append(grams, string(run[i:i+2]))
+				}
+			}
+		}
+	}
+
+	return strings.Join(grams, " ")
+}
+
+// SearchTerms - The terms of the query for $text, the CJK runs are given as bigrams like SearchGrams
+// The other words are kept, without the quotes and minus signs of the $text syntax
+func SearchTerms(query string) string {
+	terms := []string{}
+
+	words := strings.FieldsFunc(query, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+
+	for _, word := range words {
+		rest := []rune{}
+		for _, r := range word {
+			if !isCJK(r) {
+				rest = append(rest, r)
+			}
+		}
+		if len(rest) > 0 {
+			terms = append(terms, strings.ToLower(string(rest)))
+		}
+
+		for _, run := range cjkRuns(word) {
+			if len(run) == 1 {
+				terms = append(terms, string(run))
+				continue
+			}
+			for i := 0; i+1 < len(run); i++ {
+				terms = append(terms, string(run[i:i+2]))
+			}
+		}
+	}
+
+	return strings.Join(terms, " ")
+}
+
+// SetSearchGrams - Fill in the grams of the title, content and previewText
+func (p *PostAdding) SetSearchGrams() {
+	p.TitleGrams = SearchGrams(p.Title)
+	p.BodyGrams = SearchGrams(p.Content, p.PreviewText)
+}
+
+// SetSearchGrams - Fill in the grams of the content
+func (c *CommentAdding) SetSearchGrams() {
+	c.ContentGrams = SearchGrams(c.Content)
+}
+
+// EnsureSearchIndexes - The text indexes of the posts and comments
+// The language is none, so the words are neither stemmed nor dropped as stop words
+func EnsureSearchIndexes() error {
+	_, err := database.PostCollection.Indexes().CreateOne(context.TODO(), mongo.IndexModel{
+		Keys: bson.D{
+			{Key: "title", Value: "text"},
+			{Key: "content", Value: "text"},
+			{Key: "previewText", Value: "text"},
+			{Key: "titleGrams", Value: "text"},
+			{Key: "bodyGrams", Value: "text"},
+		},
+		Options: options.Index().
+			SetName("search").
+			SetDefaultLanguage("none").
+			SetWeights(bson.M{"title": 5, "titleGrams": 5, "previewText": 2, "content": 1, "bodyGrams": 1}),
+	})
+
+	if err != nil {
+		return err
+	}
+
+	_, err = database.CommentCollection.Indexes().CreateOne(context.TODO(), mongo.IndexModel{
+		Keys: bson.D{
+			{Key: "content", Value: "text"},
+			{Key: "contentGrams", Value: "text"},
+		},
+		Options: options.Index().SetName("search").SetDefaultLanguage("none"),
+	})
+
+	return err
+}
+
+// MigrateSearchGrams - Fill in the grams of the posts and comments created before the search existed
+func MigrateSearchGrams() error {
+	posts, err := FindPosts(bson.M{"titleGrams": bson.M{"$exists": false}}, nil)
+
+	if err != nil {
+		return err
+	}
+
+	for _, post := range posts {
+		post.SetSearchGrams()
+		if _, err := UpdatePostByOID(post.ID, bson.M{"titleGrams": post.TitleGrams, "bodyGrams": post.BodyGrams}); err != nil {
+			return err
+		}
+	}
+
+	comments, err := FindComments(bson.M{"contentGrams": bson.M{"$exists": false}}, nil)
+
+	if err != nil {
+		return err
+	}
+
+	for _, comment := range comments {
+		comment.SetSearchGrams()
+		if _, err := UpdateCommentByOID(comment.ID, bson.M{"contentGrams": comment.ContentGrams}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// searchMatchStage - Match the query and the filters, the category and domain are matched later by the callers
+func searchMatchStage(filter *SearchFilter, excludedAuthors []primitive.ObjectID) bson.M {
+	match := bson.M{"$text": bson.M{"$search": SearchTerms(filter.Query)}}
+
+	if len(filter.CreatedAt) > 0 {
+		match["createdAt"] = filter.CreatedAt
+	}
+
+	if len(excludedAuthors) > 0 {
+		match["author"] = bson.M{"$nin": excludedAuthors}
+	}
+
+	return bson.M{"$match": match}
+}
+
+// searchRelevanceStage - Keep the text score right after the $text match, the later stages can't read it
+var searchRelevanceStage = bson.M{"$addFields": bson.M{"relevance": bson.M{"$meta": "textScore"}}}
+
+// searchRankStages - Rank by the relevance boosted by the recency, then page
+// The boost halves every SearchRecencyHalfLife
+func searchRankStages(now time.Time, skip int, limit int) []bson.M {
+	recency := bson.M{"$pow": bson.A{
+		0.5,
+		bson.M{"$divide": bson.A{
+			bson.M{"$max": bson.A{0, bson.M{"$subtract": bson.A{now, "$createdAt"}}}},
+			SearchRecencyHalfLife.Milliseconds(),
+		}},
+	}}
+
+	stages := []bson.M{
+		bson.M{"$addFields": bson.M{
+			"score": bson.M{"$multiply": bson.A{
+				"$relevance",
+				bson.M{"$add": bson.A{1, bson.M{"$multiply": bson.A{SearchRecencyWeight, recency}}}},
+			}},
+		}},
+		bson.M{"$sort": bson.D{{Key: "score", Value: -1}, {Key: "_id", Value: -1}}},
+	}
+
+	if skip > 0 {
+		stages = append(stages, bson.M{"$skip": skip})
+	}
+
+	if limit > 0 {
+		stages = append(stages, bson.M{"$limit": limit})
+	}
+
+	return stages
+}
+
+// SearchPosts - Find the Posts matching the query, ranked by relevance with recency boosting
+func SearchPosts(filter *SearchFilter, excludedAuthors []primitive.ObjectID, skip int, limit int) ([]*PostSearchResult, error) {
+	posts := []*PostSearchResult{}
+
+	match := searchMatchStage(filter, excludedAuthors)
+	if filter.Category != nil {
+		match["$match"].(bson.M)["category"] = *filter.Category
+	}
+
+	pipeline := []bson.M{match, searchRelevanceStage, postAuthorLookupStage()}
+
+	// The domain of the anonymous authors is blanked by the lookup
+	if filter.Domain != "" {
+		pipeline = append(pipeline, bson.M{"$match": bson.M{"author.domain": filter.Domain}})
+	}
+
+	pipeline = append(pipeline, searchRankStages(time.Now(), skip, limit)...)
+
+	pipeline = append(pipeline,
+		postCategoryLookupStage(),
+		bson.M{"$project": bson.M{
+			"_id":          1,
+			"likeCount":    bson.M{"$size": "$likers"},
+			"author":       bson.M{"$arrayElemAt": bson.A{"$author", 0}},
+			"category":     bson.M{"$arrayElemAt": bson.A{"$category", 0}},
+			"title":        1,
+			"previewText":  1,
+			"previewPhoto": 1,
+			"createdAt":    1,
+			"anonymous":    1,
+			"edited":       1,
+			"score":        1,
+		}},
+	)
+
+	result, err := database.PostCollection.Aggregate(context.TODO(), pipeline)
+	if result != nil {
+		defer result.Close(context.TODO())
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := result.All(context.TODO(), &posts); err != nil {
+		return nil, err
+	}
+
+	return posts, nil
+}
+
+// SearchComments - Find the Comments matching the query, ranked by relevance with recency boosting
+// The category is the one of the Post, the comments of the posts by the excludedAuthors are left out as well
+func SearchComments(filter *SearchFilter, excludedAuthors []primitive.ObjectID, skip int, limit int) ([]*CommentSearchResult, error) {
+	comments := []*CommentSearchResult{}
+
+	postMatch := bson.A{bson.M{"$expr": bson.M{"$eq": bson.A{"$_id", "$$belongPost"}}}}
+	if filter.Category != nil {
+		postMatch = append(postMatch, bson.M{"category": *filter.Category})
+	}
+	if len(excludedAuthors) > 0 {
+		postMatch = append(postMatch, bson.M{"author": bson.M{"$nin": excludedAuthors}})
+	}
+
+	pipeline := []bson.M{
+		searchMatchStage(filter, excludedAuthors),
+		searchRelevanceStage,
+		// Populate Author
+		bson.M{
+			"$lookup": bson.M{
+				"from": "user",
+				"let":  bson.M{"author": "$author"},
+				"pipeline": bson.A{
+					bson.M{"$match": bson.M{"$expr": bson.M{"$eq": bson.A{"$_id", "$$author"}}}},
+					bson.M{"$project": bson.M{"_id": 1, "gender": publicGenderProjection(), "domain": 1}},
+				},
+				"as": "author",
+			},
+		},
+		// Populate Post
+		bson.M{
+			"$lookup": bson.M{
+				"from": "post",
+				"let":  bson.M{"belongPost": "$belongPost"},
+				"pipeline": bson.A{
+					bson.M{"$match": bson.M{"$and": postMatch}},
+					bson.M{"$project": bson.M{"_id": 1, "title": 1, "previewText": 1, "previewPhoto": 1, "anonymous": 1, "createdAt": 1}},
+				},
+				"as": "post",
+			},
+		},
+		bson.M{"$match": bson.M{"post.0": bson.M{"$exists": true}}},
+	}
+
+	if filter.Domain != "" {
+		pipeline = append(pipeline, bson.M{"$match": bson.M{"author.domain": filter.Domain}})
+	}
+
+	pipeline = append(pipeline, searchRankStages(time.Now(), skip, limit)...)
+
+	pipeline = append(pipeline, bson.M{"$project": bson.M{
+		"_id":        1,
+		"belongPost": 1,
+		"likeCount":  bson.M{"$size": "$likers"},
+		"author":     bson.M{"$arrayElemAt": bson.A{"$author", 0}},
+		"post":       bson.M{"$arrayElemAt": bson.A{"$post", 0}},
+		"content":    1,
+		"createdAt":  1,
+		"updatedAt":  1,
+		"score":      1,
+	}})
+
+	result, err := database.CommentCollection.Aggregate(context.TODO(), pipeline)
+	if result != nil {
+		defer result.Close(context.TODO())
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := result.All(context.TODO(), &comments); err != nil {
+		return nil, err
+	}
+
+	return comments, nil
+}
@@ -0,0 +1,130 @@
+package models
+
+import (
+	"context"
+	"quenc/database"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Session - Session Schema
+// A session is created on every login, its ID is the jti of the tokens and the family of the refresh tokens
+type Session struct {
+	ID         primitive.ObjectID `json:"_id" bson:"_id,omitempty"`
+	User       primitive.ObjectID `json:"user" bson:"user"`
+	UserAgent  string             `json:"userAgent" bson:"userAgent"`
+	IP         string             `json:"ip" bson:"ip"`
+	Revoked    bool               `json:"revoked" bson:"revoked"`
+	TwoFactor  bool               `json:"twoFactor" bson:"twoFactor"` // passed the two-factor authentication
+	LastUsedAt time.Time          `json:"lastUsedAt" bson:"lastUsedAt"`
+	CreatedAt  time.Time          `json:"createdAt" bson:"createdAt"`
+}
+
+// AddSession - Adding Session to MongoDB
+func AddSession(inputSession *Session) (interface{}, error) {
+
+	result, err := database.SessionCollection.InsertOne(context.TODO(), inputSession)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return result.InsertedID, nil
+}
+
+// FindSessionByOID - Find Session by its OID
+func FindSessionByOID(oid primitive.ObjectID) (*Session, error) {
+	var session Session
+
+	err := database.SessionCollection.FindOne(context.TODO(), bson.M{"_id": oid}).Decode(&session)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &session, nil
+}
+
+// FindActiveSessionsForUser - Find the sessions which are not revoked, the latest used one first
+func FindActiveSessionsForUser(uOID primitive.ObjectID) ([]*Session, error) {
+	var sessions []*Session
+
+	result, err := database.SessionCollection.Find(
+		context.TODO(),
+		bson.M{"user": uOID, "revoked": false},
+		options.Find().SetSort(bson.M{"lastUsedAt": -1}),
+	)
+	if result != nil {
+		defer result.Close(context.TODO())
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	for result.Next(context.TODO()) {
+		var elem Session
+		err := result.Decode(&elem)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, &elem)
+	}
+
+	return sessions, nil
+}
+
+// TouchSession - Update the last used time of the session
+func TouchSession(oid primitive.ObjectID) (*mongo.UpdateResult, error) {
+
+	result, err := database.SessionCollection.UpdateOne(context.TODO(), bson.M{"_id": oid}, bson.M{"$set": bson.M{"lastUsedAt": time.Now()}})
+
+	return result, err
+}
+
+// MarkSessionTwoFactor - Mark the session has passed the two-factor authentication
+func MarkSessionTwoFactor(oid primitive.ObjectID) (*mongo.UpdateResult, error) {
+
+	result, err := database.SessionCollection.UpdateOne(context.TODO(), bson.M{"_id": oid}, bson.M{"$set": bson.M{"twoFactor": true}})
+
+	return result, err
+}
+
+// RevokeSessionByOID - Revoke the session and its refresh tokens
+func RevokeSessionByOID(oid primitive.ObjectID) (*mongo.UpdateResult, error) {
+
+	result, err := database.SessionCollection.UpdateOne(context.TODO(), bson.M{"_id": oid}, bson.M{"$set": bson.M{"revoked": true}})
+
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = RevokeRefreshTokenFamily(oid)
+
+	return result, err
+}
+
+// RevokeSessionsForUser - Revoke every session of the user, except the one given in keepOID
+func RevokeSessionsForUser(uOID primitive.ObjectID, keepOID *primitive.ObjectID) (*mongo.UpdateResult, error) {
+	filter := bson.M{"user": uOID, "revoked": false}
+	tokenFilter := bson.M{"user": uOID}
+
+	if keepOID != nil {
+		filter["_id"] = bson.M{"$ne": *keepOID}
+		tokenFilter["family"] = bson.M{"$ne": *keepOID}
+	}
+
+	result, err := database.SessionCollection.UpdateMany(context.TODO(), filter, bson.M{"$set": bson.M{"revoked": true}})
+
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = database.RefreshTokenCollection.UpdateMany(context.TODO(), tokenFilter, bson.M{"$set": bson.M{"revoked": true}})
+
+	return result, err
+}
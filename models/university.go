@@ -0,0 +1,288 @@
+package models
+
+import (
+	"context"
+	"quenc/database"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// DefaultUniversityLanguage - The language used when a display name is not given for the requested one
+const DefaultUniversityLanguage = "zh-TW"
+
+// University - University Schema
+// The first domain is the main one, users signed up with any of the domains (or their subdomains) belong to it
+type University struct {
+	ID        primitive.ObjectID `json:"_id" bson:"_id,omitempty"`
+	Domains   []string           `json:"domains" bson:"domains"`
+	Names     map[string]string  `json:"names" bson:"names"` // language -> display name, e.g. "zh-TW", "en"
+	LogoURL   string             `json:"logoURL" bson:"logoURL"`
+	Majors    []string           `json:"majors" bson:"majors"` // the majors the users can choose, see HasMajor
+	Enabled   bool               `json:"enabled" bson:"enabled"`
+	UpdatedAt time.Time          `json:"updatedAt" bson:"updatedAt"`
+	CreatedAt time.Time          `json:"createdAt" bson:"createdAt"`
+}
+
+// UniversityPreview - The University shown with a post author
+type UniversityPreview struct {
+	ID      primitive.ObjectID `json:"_id" bson:"_id,omitempty"`
+	Names   map[string]string  `json:"names" bson:"names"`
+	LogoURL string             `json:"logoURL" bson:"logoURL"`
+}
+
+// The universities supported before the registry existed
+var defaultUniversities = []University{
+	{Domains: []string{"qut.edu.au"}, Names: map[string]string{"zh-TW": "昆士蘭理工", "en": "Queensland University of Technology"}, Enabled: true},
+	{Domains: []string{"uq.edu.au"}, Names: map[string]string{"zh-TW": "昆士蘭大學", "en": "The University of Queensland"}, Enabled: true},
+	{Domains: []string{"griffith.edu.au"}, Names: map[string]string{"zh-TW": "格里菲斯", "en": "Griffith University"}, Enabled: true},
+}
+
+// DisplayName - Return the name in the given language, or the default one
+func (u *University) DisplayName(lang string) string {
+	if name, ok := u.Names[lang]; ok && name != "" {
+		return name
+	}
+
+	if name, ok := u.Names[DefaultUniversityLanguage]; ok && name != "" {
+		return name
+	}
+
+	if name, ok := u.Names["en"]; ok && name != "" {
+		return name
+	}
+
+	if len(u.Domains) > 0 {
+		return u.Domains[0]
+	}
+
+	return ""
+}
+
+// MainDomain - The domain stored for the users of this University
+func (u *University) MainDomain() string {
+	if len(u.Domains) == 0 {
+		return ""
+	}
+	return u.Domains[0]
+}
+
+/*
+	Cache
+*/
+
+// How long the universities are kept in memory before reading MongoDB again
+const universityCacheTTL = 5 * time.Minute
+
+var universityCache struct {
+	sync.RWMutex
+	byDomain map[string]*University
+	loadedAt time.Time
+}
+
+// universitiesByDomain - Return every University keyed by each of its domains, from the cache when it is fresh
+func universitiesByDomain() (map[string]*University, error) {
+	universityCache.RLock()
+	if universityCache.byDomain != nil && time.Since(universityCache.loadedAt) < universityCacheTTL {
+		byDomain := universityCache.byDomain
+		universityCache.RUnlock()
+		return byDomain, nil
+	}
+	universityCache.RUnlock()
+
+	universities, err := FindUniversities(bson.M{}, nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	byDomain := map[string]*University{}
+	for _, u := range universities {
+		for _, d := range u.Domains {
+			byDomain[d] = u
+		}
+	}
+
+	universityCache.Lock()
+	universityCache.byDomain = byDomain
+	universityCache.loadedAt = time.Now()
+	universityCache.Unlock()
+
+	return byDomain, nil
+}
+
+// InvalidateUniversityCache - Force the next lookup to read MongoDB again
+func InvalidateUniversityCache() {
+	universityCache.Lock()
+	universityCache.byDomain = nil
+	universityCache.Unlock()
+}
+
+// FindUniversityByDomain - Find the University of the domain, subdomains belong to their parent domain
+// nil is returned when no University has the domain
+func FindUniversityByDomain(domain string) (*University, error) {
+	byDomain, err := universitiesByDomain()
+
+	if err != nil {
+		return nil, err
+	}
+
+	// connect.qut.edu.au -> qut.edu.au -> edu.au
+	domain = strings.ToLower(strings.TrimSpace(domain))
+	for domain != "" {
+		if u, ok := byDomain[domain]; ok {
+			return u, nil
+		}
+
+		i := strings.Index(domain, ".")
+		if i < 0 {
+			break
+		}
+		domain = domain[i+1:]
+	}
+
+	return nil, nil
+}
+
+// FindEnabledUniversityDomains - Every domain of the enabled universities
+func FindEnabledUniversityDomains() ([]string, error) {
+	byDomain, err := universitiesByDomain()
+
+	if err != nil {
+		return nil, err
+	}
+
+	domains := []string{}
+	for d, u := range byDomain {
+		if u.Enabled {
+			domains = append(domains, d)
+		}
+	}
+
+	return domains, nil
+}
+
+/*
+	CRUD
+*/
+
+// AddUniversity - Adding University to MongoDB
+func AddUniversity(inputUniversity *University) (interface{}, error) {
+
+	result, err := database.UniversityCollection.InsertOne(context.TODO(), inputUniversity)
+
+	if err != nil {
+		return nil, err
+	}
+
+	InvalidateUniversityCache()
+
+	return result.InsertedID, nil
+}
+
+// UpdateUniversityByOID - Update University in MongoDB by its OID
+func UpdateUniversityByOID(oid primitive.ObjectID, updateDetail bson.M) (*mongo.UpdateResult, error) {
+
+	result, err := database.UniversityCollection.UpdateOne(context.TODO(), bson.M{"_id": oid}, bson.M{"$set": updateDetail})
+
+	InvalidateUniversityCache()
+
+	return result, err
+}
+
+// DeleteUniversityByOID - Delete University by its OID
+func DeleteUniversityByOID(oid primitive.ObjectID) (*mongo.DeleteResult, error) {
+	result, err := database.UniversityCollection.DeleteOne(context.TODO(), bson.M{"_id": oid})
+
+	InvalidateUniversityCache()
+
+	return result, err
+}
+
+// FindUniversityByOID - Find University by its OID
+func FindUniversityByOID(oid primitive.ObjectID) (*University, error) {
+	var university University
+
+	err := database.UniversityCollection.FindOne(context.TODO(), bson.M{"_id": oid}).Decode(&university)
+
+	return &university, err
+}
+
+// FindUniversities - Find Multiple Universities by filterDetail
+func FindUniversities(filterDetail bson.M, findOptions *options.FindOptions) ([]*University, error) {
+	var universities []*University
+	result, err := database.UniversityCollection.Find(context.TODO(), filterDetail, findOptions)
+	if result != nil {
+		defer result.Close(context.TODO())
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	for result.Next(context.TODO()) {
+		var elem University
+		err := result.Decode(&elem)
+		if err != nil {
+			return nil, err
+		}
+		universities = append(universities, &elem)
+	}
+
+	return universities, nil
+}
+
+// EnsureDefaultUniversities - Insert the default universities when the registry is empty
+func EnsureDefaultUniversities() error {
+	count, err := database.UniversityCollection.CountDocuments(context.TODO(), bson.M{})
+
+	if err != nil || count > 0 {
+		return err
+	}
+
+	now := time.Now()
+	for _, u := range defaultUniversities {
+		u.CreatedAt = now
+		u.UpdatedAt = now
+		if _, err := AddUniversity(&u); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// universityLookupStage - The stage used in the author lookup pipelines to populate the University by domain
+var universityLookupStage = bson.M{
+	"$lookup": bson.M{
+		"from":         "university",
+		"localField":   "domain",
+		"foreignField": "domains",
+		"as":           "university",
+	},
+}
+
+// universityProjection - Project the populated University (after universityLookupStage) to UniversityPreview
+// The University is null for anonymous posts or unknown domains
+func universityProjection(anonymousExpr interface{}) bson.M {
+	return bson.M{
+		"$cond": bson.M{
+			"if": bson.M{"$or": bson.A{
+				bson.M{"$eq": bson.A{anonymousExpr, true}},
+				bson.M{"$eq": bson.A{bson.M{"$size": "$university"}, 0}},
+			}},
+			"then": nil,
+			"else": bson.M{
+				"$let": bson.M{
+					"vars": bson.M{"u": bson.M{"$arrayElemAt": bson.A{"$university", 0}}},
+					"in":   bson.M{"_id": "$$u._id", "names": "$$u.names", "logoURL": "$$u.logoURL"},
+				},
+			},
+		},
+	}
+}
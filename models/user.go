@@ -2,9 +2,10 @@ package models
 
 import (
 	"context"
-	"net/smtp"
 	"os"
 	"quenc/database"
+	"quenc/mailer"
+	"strings"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
@@ -17,38 +18,81 @@ import (
 
 // User - User Schema
 type User struct {
-	ID             primitive.ObjectID   `json:"_id" bson:"_id,omitempty"`
-	RandomChatRoom *primitive.ObjectID  `json:"randomChatRoom" bson:"randomChatRoom"`
-	Name           string               `json:"name" bson:"name"`
-	Domain         string               `json:"domain" bson:"domain"`
-	Email          string               `json:"email" bson:"email"`
-	Password       string               `json:"password" bson:"password"`
-	PhotoURL       string               `json:"photoURL" bson:"photoURL"`
-	Major          string               `json:"major" bson:"major"`
-	Dob            string               `json:"dob" bson:"dob"`
-	Role           int                  `json:"role" bson:"role"`
-	Gender         int                  `json:"gender" bson:"gender"`
-	EmailVerified  bool                 `json:"emailVerified" bson:"emailVerified"`
-	LastSeen       time.Time            `json:"lastSeen" bson:"lastSeen"`
-	CreatedAt      time.Time            `json:"createdAt" bson:"createdAt"`
-	ChatRooms      []primitive.ObjectID `json:"chatRooms" bson:"chatRooms"`
-	LikePosts      []primitive.ObjectID `json:"likePosts" bson:"likePosts"`
-	LikeComments   []primitive.ObjectID `json:"likeComments" bson:"likeComments"`
-	Friends        []primitive.ObjectID `json:"friends" bson:"friends"`
-	SavedPosts     []primitive.ObjectID `json:"savedPosts" bson:"savedPosts"`
+	ID                         primitive.ObjectID   `json:"_id" bson:"_id,omitempty"`
+	RandomChatRoom             *primitive.ObjectID  `json:"randomChatRoom" bson:"randomChatRoom"`
+	Name                       string               `json:"name" bson:"name"`
+	SearchName                 string               `json:"-" bson:"searchName,omitempty"` // the lower-case name for the search, see SearchName
+	Domain                     string               `json:"domain" bson:"domain"`
+	Email                      string               `json:"email" bson:"email"`
+	Password                   string               `json:"password" bson:"password"`
+	PhotoURL                   string               `json:"photoURL" bson:"photoURL"`
+	Major                      string               `json:"major" bson:"major"`
+	Dob                        string               `json:"dob" bson:"dob"`
+	Roles                      []string             `json:"roles" bson:"roles"`
+	ModeratedCategories        []primitive.ObjectID `json:"moderatedCategories" bson:"moderatedCategories"` // the PostCategories of a category moderator
+	Restriction                *Restriction         `json:"restriction" bson:"restriction,omitempty"`       // the suspension or ban in effect
+	Deletion                   *AccountDeletion     `json:"deletion" bson:"deletion,omitempty"`             // waiting for the grace period to end
+	Gender                     int                  `json:"gender" bson:"gender"`
+	EmailVerified              bool                 `json:"emailVerified" bson:"emailVerified"`
+	PasswordResetRequired      bool                 `json:"passwordResetRequired" bson:"passwordResetRequired,omitempty"` // forced by an admin, the login is refused until the reset
+	LastSeen                   time.Time            `json:"lastSeen" bson:"lastSeen"`
+	Presence                   string               `json:"presence" bson:"presence,omitempty"` // online or away, see IsOnline
+	CreatedAt                  time.Time            `json:"createdAt" bson:"createdAt"`
+	ChatRooms                  []primitive.ObjectID `json:"chatRooms" bson:"chatRooms"`
+	LikePosts                  []primitive.ObjectID `json:"likePosts" bson:"likePosts"`
+	LikeComments               []primitive.ObjectID `json:"likeComments" bson:"likeComments"`
+	Friends                    []primitive.ObjectID `json:"friends" bson:"friends"`
+	BlockedUsers               []primitive.ObjectID `json:"blockedUsers" bson:"blockedUsers"`
+	Privacy                    *PrivacySettings     `json:"privacy" bson:"privacy,omitempty"`
+	SavedPosts                 []primitive.ObjectID `json:"savedPosts" bson:"savedPosts"`
+	HiddenPosts                []primitive.ObjectID `json:"hiddenPosts" bson:"hiddenPosts"` // left out of the home feed
+	FollowedCategories         []primitive.ObjectID `json:"followedCategories" bson:"followedCategories"`
+	FollowedAuthors            []primitive.ObjectID `json:"followedAuthors" bson:"followedAuthors"`           // only their posts which are not anonymous are followed
+	University                 *UniversityPreview   `json:"university,omitempty" bson:"university,omitempty"` // only populated in the lookups
+	EmailVerificationTokenHash string               `json:"-" bson:"emailVerificationTokenHash,omitempty"`    // only the hash of the token is stored
+	EmailVerificationExpiresAt time.Time            `json:"-" bson:"emailVerificationExpiresAt,omitempty"`
+	EmailVerificationSentAt    time.Time            `json:"-" bson:"emailVerificationSentAt,omitempty"`
+	FailedLoginCount           int                  `json:"-" bson:"failedLoginCount,omitempty"` // consecutive failures since the last login or lock
+	LockedUntil                time.Time            `json:"-" bson:"lockedUntil,omitempty"`
+	UnlockTokenHash            string               `json:"-" bson:"unlockTokenHash,omitempty"`
+	TwoFactorEnabled           bool                 `json:"twoFactorEnabled" bson:"twoFactorEnabled"`
+	TwoFactorSecret            string               `json:"-" bson:"twoFactorSecret,omitempty"`
+	TwoFactorPendingSecret     string               `json:"-" bson:"twoFactorPendingSecret,omitempty"` // waiting for the first code to enable
+	TwoFactorLastCounter       int64                `json:"-" bson:"twoFactorLastCounter,omitempty"`   // the last used TOTP period, so codes can't be replayed
+	RecoveryCodeHashes         []string             `json:"-" bson:"recoveryCodeHashes,omitempty"`
 }
 
 var ( // Changing to env variables
 	// username                      = os.Getenv("EMAIL_SENDING_USERNAME")
 	// password                      = os.Getenv("EMAIL_SENDING_PASSWORD")
 	projectionForRemovingPassword = bson.D{
-		{"password", 0},
+		{Key: "password", Value: 0},
 	}
-	verificationBaseURL = "http://192.168.1.135:8080/user/email/activate/"
 )
 
-func (u *User) IsAmin() bool {
-	return u.Role == 0
+const (
+	// EmailVerificationLifetime - How long a verification link can be used
+	EmailVerificationLifetime = 24 * time.Hour
+	// EmailVerificationResendInterval - How long a User has to wait before sending another verification email
+	EmailVerificationResendInterval = 2 * time.Minute
+)
+
+// publicBaseURL - The URL the users can reach this service with, set by PUBLIC_BASE_URL
+func publicBaseURL() string {
+	if baseURL := strings.TrimSpace(os.Getenv("PUBLIC_BASE_URL")); baseURL != "" {
+		return strings.TrimRight(baseURL, "/")
+	}
+	return "http://localhost:8080"
+}
+
+// RequiresTwoFactor - Users with moderation roles have to use the two-factor authentication
+func (u *User) RequiresTwoFactor() bool {
+	return u.IsStaff()
+}
+
+// IsLocked - Whether the account is locked after too many failed logins
+func (u *User) IsLocked() bool {
+	return time.Now().Before(u.LockedUntil)
 }
 
 // AddUser - Adding User to MongoDB
@@ -94,8 +138,7 @@ func FindUserByOID(oid primitive.ObjectID) (*User, error) {
 func FindUserByEmail(email string) (*User, error) {
 	var user User
 
-	options.FindOne().SetProjection(projectionForRemovingPassword)
-	err := database.UserCollection.FindOne(context.TODO(), bson.M{"email": email}).Decode(&user)
+	err := database.UserCollection.FindOne(context.TODO(), bson.M{"email": email}, options.FindOne().SetProjection(projectionForRemovingPassword)).Decode(&user)
 	if err != nil {
 		return nil, err
 	}
@@ -128,39 +171,136 @@ func FindUsers(filterDetail bson.M) ([]*User, error) {
 	return users, nil
 }
 
-// SendingVerificationEmail - Sending Email Verification to a User
-func SendingVerificationEmail(user *User) error {
-	var host = "smtp.gmail.com:587"
-	var username = os.Getenv("EMAIL_SENDING_USERNAME")
-	var password = os.Getenv("EMAIL_SENDING_PASSWORD")
-	plainAuth := smtp.PlainAuth(host, username, password, "smtp.gmail.com")
-	to := []string{user.Email}
-	msg := []byte(
-		"Subject: 激活您的Quenc帳號!\r\n" +
-			"From: no-reply@gmail.com\r\n" +
-			`Content-Type: text/plain;` +
-			"\r\n" +
-			"\r\n" +
-			"您好，歡迎您加入昆嗑社群\r\n" +
-			"請點擊以下的連結激活帳號：" +
-			"\r\n" +
-			verificationBaseURL + user.ID.Hex(),
+// sendingEmail - Render the email template and send it with the mailer
+func sendingEmail(to string, templateName string, data interface{}) error {
+	msg, err := mailer.Render(templateName, data)
+
+	if err != nil {
+		return err
+	}
+
+	msg.To = []string{to}
+
+	return mailer.Send(msg)
+}
+
+// SendingVerificationEmail - Sending Email Verification with the token to a User
+func SendingVerificationEmail(user *User, verificationToken string) error {
+	return sendingEmail(user.Email, "verification", map[string]interface{}{
+		"Email":          user.Email,
+		"Link":           publicBaseURL() + "/user/email/activate/" + verificationToken,
+		"ExpiresInHours": int(EmailVerificationLifetime.Hours()),
+	})
+}
+
+// SendingPasswordResetEmail - Sending the reset token to a User who forgot the password
+func SendingPasswordResetEmail(user *User, resetToken string) error {
+	return sendingEmail(user.Email, "passwordReset", map[string]interface{}{
+		"Email":            user.Email,
+		"Token":            resetToken,
+		"ExpiresInMinutes": int(PasswordResetLifetime.Minutes()),
+	})
+}
+
+// SendingAccountLockedEmail - Tell the User the account is locked, with a link to unlock it
+func SendingAccountLockedEmail(user *User, unlockToken string) error {
+	return sendingEmail(user.Email, "accountLocked", map[string]interface{}{
+		"Email":            user.Email,
+		"Link":             publicBaseURL() + "/user/unlock/" + unlockToken,
+		"LockedForMinutes": int(LoginLockDuration.Minutes()),
+	})
+}
+
+// SendingAccountExistsEmail - Tell the User someone tried to sign up with the email again
+func SendingAccountExistsEmail(user *User) error {
+	return sendingEmail(user.Email, "accountExists", map[string]interface{}{
+		"Email": user.Email,
+	})
+}
+
+// SendingAccountDeletionEmail - Tell the User when the account will be deleted
+func SendingAccountDeletionEmail(user *User, scheduledAt time.Time) error {
+	return sendingEmail(user.Email, "accountDeletion", map[string]interface{}{
+		"Email":       user.Email,
+		"ScheduledAt": scheduledAt.UTC().Format("2006-01-02 15:04 MST"),
+	})
+}
+
+// SetEmailVerificationToken - Save the hash of the newest verification token, the old one can't be used anymore
+func SetEmailVerificationToken(uOID primitive.ObjectID, tokenHash string) (*mongo.UpdateResult, error) {
+	now := time.Now()
+
+	return UpdateUserByOID(uOID, bson.M{
+		"emailVerificationTokenHash": tokenHash,
+		"emailVerificationExpiresAt": now.Add(EmailVerificationLifetime),
+		"emailVerificationSentAt":    now,
+	})
+}
+
+// FindUserByEmailVerificationTokenHash - Find User by the hash of its verification token
+func FindUserByEmailVerificationTokenHash(tokenHash string) (*User, error) {
+	var user User
+
+	err := database.UserCollection.FindOne(context.TODO(), bson.M{"emailVerificationTokenHash": tokenHash},
+		options.FindOne().SetProjection(projectionForRemovingPassword)).Decode(&user)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// ActivateUserEmailByToken - Verify the email of the User and consume the token
+// false is returned when the token has been used in the meantime
+func ActivateUserEmailByToken(uOID primitive.ObjectID, tokenHash string) (bool, error) {
+	result, err := database.UserCollection.UpdateOne(
+		context.TODO(),
+		bson.M{"_id": uOID, "emailVerificationTokenHash": tokenHash},
+		bson.M{
+			"$set":   bson.M{"emailVerified": true},
+			"$unset": bson.M{"emailVerificationTokenHash": "", "emailVerificationExpiresAt": ""},
+		},
 	)
-	err := smtp.SendMail(
-		host,
-		plainAuth,
-		username,
-		to,
-		msg,
+
+	if err != nil {
+		return false, err
+	}
+
+	return result.ModifiedCount == 1, nil
+}
+
+// UpdatePasswordByOID - Hash and save the new password of a User, a forced reset is done with it
+func UpdatePasswordByOID(oid primitive.ObjectID, newPassword string) (*mongo.UpdateResult, error) {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return database.UserCollection.UpdateOne(
+		context.TODO(),
+		bson.M{"_id": oid},
+		bson.M{
+			"$set":   bson.M{"password": string(hashedPassword)},
+			"$unset": bson.M{"passwordResetRequired": ""},
+		},
 	)
-	return err
 }
 
-// CheckingTheAuth - Checking if email and password are valid
+// dummyPasswordHash - Compared against when the email is unknown, so the timing doesn't reveal it
+var dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("quenc-dummy-password"), bcrypt.DefaultCost)
+
+// CheckingTheAuth - Check the password of the email, the same error is returned for unknown emails and wrong passwords
 func CheckingTheAuth(email string, password string) (*User, error) {
 	var user User
 	err := database.UserCollection.FindOne(context.TODO(), bson.M{"email": email}).Decode(&user)
 
+	if err != nil {
+		bcrypt.CompareHashAndPassword(dummyPasswordHash, []byte(password))
+		return nil, bcrypt.ErrMismatchedHashAndPassword
+	}
+
 	err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password))
 
 	if err != nil {
@@ -169,6 +309,80 @@ func CheckingTheAuth(email string, password string) (*User, error) {
 	return &user, nil
 }
 
+// RegisterFailedLogin - Count a failed login of the User, the updated User is returned
+func RegisterFailedLogin(uOID primitive.ObjectID) (*User, error) {
+	var user User
+
+	err := database.UserCollection.FindOneAndUpdate(
+		context.TODO(),
+		bson.M{"_id": uOID},
+		bson.M{"$inc": bson.M{"failedLoginCount": 1}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After).SetProjection(projectionForRemovingPassword),
+	).Decode(&user)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// LockUserAccount - Lock the account until the given time, false if it has been locked by another request
+func LockUserAccount(uOID primitive.ObjectID, unlockTokenHash string, lockedUntil time.Time) (bool, error) {
+	result, err := database.UserCollection.UpdateOne(
+		context.TODO(),
+		bson.M{
+			"_id": uOID,
+			"$or": bson.A{
+				bson.M{"lockedUntil": bson.M{"$exists": false}},
+				bson.M{"lockedUntil": bson.M{"$lte": time.Now()}},
+			},
+		},
+		bson.M{
+			"$set": bson.M{"lockedUntil": lockedUntil, "unlockTokenHash": unlockTokenHash},
+			// The count starts again, so the account is not locked again by the first failure after the lock
+			"$unset": bson.M{"failedLoginCount": ""},
+		},
+	)
+
+	if err != nil {
+		return false, err
+	}
+
+	return result.ModifiedCount == 1, nil
+}
+
+// ResetFailedLogins - Clear the failed login count and the lock of the User
+func ResetFailedLogins(uOID primitive.ObjectID) (*mongo.UpdateResult, error) {
+	return database.UserCollection.UpdateOne(
+		context.TODO(),
+		bson.M{"_id": uOID},
+		bson.M{"$unset": bson.M{"failedLoginCount": "", "lockedUntil": "", "unlockTokenHash": ""}},
+	)
+}
+
+// UnlockUserAccountByToken - Unlock the account with the token from the unlock email, nil if the token is not valid
+func UnlockUserAccountByToken(unlockTokenHash string) (*User, error) {
+	var user User
+
+	err := database.UserCollection.FindOneAndUpdate(
+		context.TODO(),
+		bson.M{"unlockTokenHash": unlockTokenHash},
+		bson.M{"$unset": bson.M{"failedLoginCount": "", "lockedUntil": "", "unlockTokenHash": ""}},
+		options.FindOneAndUpdate().SetProjection(projectionForRemovingPassword),
+	).Decode(&user)
+
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
 func WatchUser(pipeline []bson.M, changeStreamOption *options.ChangeStreamOptions) (*mongo.ChangeStream, error) {
 	collectionStream, err := database.UserCollection.Watch(context.TODO(), pipeline, changeStreamOption)
 	return collectionStream, err
@@ -199,3 +413,93 @@ func ToggleElementToUserArray(field string, adding bool, element primitive.Objec
 	}
 	return result, err
 }
+
+// SetPendingTwoFactorSecret - Store the secret of the enrolment until the first code is verified
+func SetPendingTwoFactorSecret(uOID primitive.ObjectID, secret string) (*mongo.UpdateResult, error) {
+	return database.UserCollection.UpdateOne(
+		context.TODO(),
+		bson.M{"_id": uOID},
+		bson.M{"$set": bson.M{"twoFactorPendingSecret": secret}},
+	)
+}
+
+// EnableTwoFactor - Enable the pending secret with the period of the verified code and the recovery codes
+// False if the pending secret has been replaced by another enrolment
+func EnableTwoFactor(uOID primitive.ObjectID, secret string, counter int64, recoveryCodeHashes []string) (bool, error) {
+	result, err := database.UserCollection.UpdateOne(
+		context.TODO(),
+		bson.M{"_id": uOID, "twoFactorPendingSecret": secret},
+		bson.M{
+			"$set": bson.M{
+				"twoFactorEnabled":     true,
+				"twoFactorSecret":      secret,
+				"twoFactorLastCounter": counter,
+				"recoveryCodeHashes":   recoveryCodeHashes,
+			},
+			"$unset": bson.M{"twoFactorPendingSecret": ""},
+		},
+	)
+
+	if err != nil {
+		return false, err
+	}
+
+	return result.ModifiedCount == 1, nil
+}
+
+// DisableTwoFactor - Remove the secret and the recovery codes of the User
+func DisableTwoFactor(uOID primitive.ObjectID) (*mongo.UpdateResult, error) {
+	return database.UserCollection.UpdateOne(
+		context.TODO(),
+		bson.M{"_id": uOID},
+		bson.M{
+			"$set":   bson.M{"twoFactorEnabled": false},
+			"$unset": bson.M{"twoFactorSecret": "", "twoFactorPendingSecret": "", "twoFactorLastCounter": "", "recoveryCodeHashes": ""},
+		},
+	)
+}
+
+// UseTwoFactorCounter - Record the TOTP period as used, false if it or a later one has been used
+func UseTwoFactorCounter(uOID primitive.ObjectID, counter int64) (bool, error) {
+	result, err := database.UserCollection.UpdateOne(
+		context.TODO(),
+		bson.M{
+			"_id": uOID,
+			"$or": bson.A{
+				bson.M{"twoFactorLastCounter": bson.M{"$exists": false}},
+				bson.M{"twoFactorLastCounter": bson.M{"$lt": counter}},
+			},
+		},
+		bson.M{"$set": bson.M{"twoFactorLastCounter": counter}},
+	)
+
+	if err != nil {
+		return false, err
+	}
+
+	return result.ModifiedCount == 1, nil
+}
+
+// SetRecoveryCodes - Replace the recovery codes of the User
+func SetRecoveryCodes(uOID primitive.ObjectID, recoveryCodeHashes []string) (*mongo.UpdateResult, error) {
+	return database.UserCollection.UpdateOne(
+		context.TODO(),
+		bson.M{"_id": uOID},
+		bson.M{"$set": bson.M{"recoveryCodeHashes": recoveryCodeHashes}},
+	)
+}
+
+// UseRecoveryCode - Remove the recovery code from the User, false if it is not one of the codes
+func UseRecoveryCode(uOID primitive.ObjectID, recoveryCodeHash string) (bool, error) {
+	result, err := database.UserCollection.UpdateOne(
+		context.TODO(),
+		bson.M{"_id": uOID, "recoveryCodeHashes": recoveryCodeHash},
+		bson.M{"$pull": bson.M{"recoveryCodeHashes": recoveryCodeHash}},
+	)
+
+	if err != nil {
+		return false, err
+	}
+
+	return result.ModifiedCount == 1, nil
+}
@@ -0,0 +1,280 @@
+package models
+
+import (
+	"context"
+	"quenc/database"
+	"regexp"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+)
+
+// UserSearchFilter - The empty fields are not filtered, the gender is only filtered when HasGender is set
+type UserSearchFilter struct {
+	NamePrefix string
+	Major      string
+	Domain     string
+	Gender     int
+	HasGender  bool
+}
+
+// UserSuggestion - A User the viewer may know
+type UserSuggestion struct {
+	Profile       *PublicProfile `json:"profile"`
+	MutualFriends int            `json:"mutualFriends"`
+	SharedMajor   bool           `json:"sharedMajor"`
+}
+
+// The fields needed for the PublicProfile of the found Users
+var projectionForUserSearch = bson.M{
+	"_id":      1,
+	"name":     1,
+	"photoURL": 1,
+	"domain":   1,
+	"major":    1,
+	"dob":      1,
+	"gender":   1,
+	"lastSeen": 1,
+	"friends":  1,
+	"privacy":  1,
+}
+
+// SearchName - The name stored for the prefix search, case-insensitive prefixes can use the index this way
+func SearchName(name string) string {
+	return strings.ToLower(strings.TrimSpace(name))
+}
+
+// EnsureUserIndexes - The indexes of the search, the suggestions and the block lookups
+func EnsureUserIndexes() error {
+	_, err := database.UserCollection.Indexes().CreateMany(context.TODO(), []mongo.IndexModel{
+		{Keys: bson.D{{Key: "searchName", Value: 1}}},
+		{Keys: bson.D{{Key: "domain", Value: 1}, {Key: "major", Value: 1}, {Key: "searchName", Value: 1}}},
+		{Keys: bson.D{{Key: "domain", Value: 1}, {Key: "gender", Value: 1}, {Key: "searchName", Value: 1}}},
+		{Keys: bson.D{{Key: "major", Value: 1}}},
+		{Keys: bson.D{{Key: "friends", Value: 1}}},
+		{Keys: bson.D{{Key: "blockedUsers", Value: 1}}},
+	})
+	return err
+}
+
+// MigrateUserSearchNames - Set the searchName of the Users created before the search existed
+func MigrateUserSearchNames() error {
+	users, err := FindUsers(bson.M{"searchName": bson.M{"$exists": false}, "name": bson.M{"$ne": ""}})
+
+	if err != nil {
+		return err
+	}
+
+	for _, user := range users {
+		if _, err := UpdateUserByOID(user.ID, bson.M{"searchName": SearchName(user.Name)}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// visibleToFilter - Match the Users whose field can be seen by the viewer, following the privacy settings
+func visibleToFilter(field string, defaultPrivacy string, viewerOID primitive.ObjectID) bson.M {
+	key := "privacy." + field
+	visible := bson.A{
+		bson.M{key: PrivacyPublic},
+		bson.M{key: PrivacyFriends, "friends": viewerOID},
+	}
+
+	switch defaultPrivacy {
+	case PrivacyPublic:
+		visible = append(visible, bson.M{key: bson.M{"$exists": false}})
+	case PrivacyFriends:
+		visible = append(visible, bson.M{key: bson.M{"$exists": false}, "friends": viewerOID})
+	}
+
+	return bson.M{"$or": visible}
+}
+
+// discoverableFilter - The Users who can be found by the viewer
+func discoverableFilter(viewer *User, excluded []primitive.ObjectID) bson.M {
+	return bson.M{
+		"$and": bson.A{
+			bson.M{"_id": bson.M{"$nin": append([]primitive.ObjectID{viewer.ID}, excluded...)}},
+			bson.M{"blockedUsers": bson.M{"$ne": viewer.ID}},
+			bson.M{"emailVerified": true},
+			bson.M{"deletion": bson.M{"$exists": false}},
+			bson.M{"restriction.type": bson.M{"$ne": ModerationBan}},
+		},
+	}
+}
+
+// SearchUsers - Find the Users for the viewer, sorted by name
+// The major and gender are only matched when the viewer can see them, so the hidden ones can't be probed
+func SearchUsers(viewer *User, filter *UserSearchFilter, excluded []primitive.ObjectID, skip int, limit int) ([]*PublicProfile, error) {
+	var users []*User
+
+	conditions := discoverableFilter(viewer, excluded)["$and"].(bson.A)
+
+	if prefix := SearchName(filter.NamePrefix); prefix != "" {
+		conditions = append(conditions, bson.M{"searchName": bson.M{"$regex": "^" + regexp.QuoteMeta(prefix)}})
+	}
+
+	if filter.Domain != "" {
+		conditions = append(conditions, bson.M{"domain": strings.ToLower(filter.Domain)})
+	}
+
+	if filter.Major != "" {
+		conditions = append(conditions,
+			bson.M{"major": filter.Major},
+			visibleToFilter("major", DefaultPrivacySettings.Major, viewer.ID),
+		)
+	}
+
+	if filter.HasGender {
+		conditions = append(conditions,
+			bson.M{"gender": filter.Gender},
+			visibleToFilter("gender", DefaultPrivacySettings.Gender, viewer.ID),
+		)
+	}
+
+	findOptions := options.Find().
+		SetProjection(projectionForUserSearch).
+		SetSort(bson.D{{Key: "searchName", Value: 1}, {Key: "_id", Value: 1}})
+
+	if skip > 0 {
+		findOptions.SetSkip(int64(skip))
+	}
+
+	if limit > 0 {
+		findOptions.SetLimit(int64(limit))
+	}
+
+	result, err := database.UserCollection.Find(context.TODO(), bson.M{"$and": conditions}, findOptions)
+	if result != nil {
+		defer result.Close(context.TODO())
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = result.All(context.TODO(), &users)
+
+	if err != nil {
+		return nil, err
+	}
+
+	profiles := []*PublicProfile{}
+	for _, user := range users {
+		profiles = append(profiles, user.PublicProfileFor(viewer))
+	}
+
+	return profiles, nil
+}
+
+// FindUserSuggestions - The people the viewer may know, by the mutual friends and the shared major
+// A mutual friend counts twice as much as the major, only the public majors are used
+func FindUserSuggestions(viewer *User, excluded []primitive.ObjectID, limit int) ([]*UserSuggestion, error) {
+	var found []struct {
+		User          `bson:",inline"`
+		MutualFriends int  `bson:"mutualFriends"`
+		SharedMajor   bool `bson:"sharedMajor"`
+	}
+
+	friends := append([]primitive.ObjectID{}, viewer.Friends...)
+
+	// The mutual friends come from the friend lists of the viewer's friends, except the private ones
+	// The friendships are symmetric, so a candidate lists the mutual friend as well
+	sharingFriends := []primitive.ObjectID{}
+	if len(friends) > 0 {
+		friendUsers, err := FindUsers(bson.M{"_id": bson.M{"$in": friends}})
+
+		if err != nil {
+			return nil, err
+		}
+
+		for _, friend := range friendUsers {
+			if friend.PrivacySettings().Friends != PrivacyPrivate {
+				sharingFriends = append(sharingFriends, friend.ID)
+			}
+		}
+	}
+
+	publicMajor := bson.M{"$or": bson.A{
+		bson.M{"privacy.major": PrivacyPublic},
+		bson.M{"privacy.major": bson.M{"$exists": false}},
+	}}
+
+	candidates := bson.A{
+		bson.M{"friends": bson.M{"$in": sharingFriends}},
+	}
+
+	if viewer.Major != "" {
+		candidates = append(candidates, bson.M{"$and": bson.A{bson.M{"major": viewer.Major}, publicMajor}})
+	}
+
+	conditions := discoverableFilter(viewer, append(friends, excluded...))["$and"].(bson.A)
+	conditions = append(conditions, bson.M{"$or": candidates})
+
+	isPublic := func(field string, defaultPrivacy string) bson.M {
+		return bson.M{"$eq": bson.A{bson.M{"$ifNull": bson.A{"$privacy." + field, defaultPrivacy}}, PrivacyPublic}}
+	}
+
+	projection := bson.M{}
+	for field := range projectionForUserSearch {
+		projection[field] = 1
+	}
+	projection["mutualFriends"] = bson.M{
+		"$size": bson.M{"$setIntersection": bson.A{bson.M{"$ifNull": bson.A{"$friends", bson.A{}}}, sharingFriends}},
+	}
+	projection["sharedMajor"] = bson.M{
+		"$and": bson.A{
+			bson.M{"$ne": bson.A{viewer.Major, ""}},
+			bson.M{"$eq": bson.A{"$major", viewer.Major}},
+			isPublic("major", DefaultPrivacySettings.Major),
+		},
+	}
+
+	pipeline := []bson.M{
+		bson.M{"$match": bson.M{"$and": conditions}},
+		bson.M{"$project": projection},
+		bson.M{"$addFields": bson.M{
+			"score": bson.M{"$add": bson.A{
+				bson.M{"$multiply": bson.A{"$mutualFriends", 2}},
+				bson.M{"$cond": bson.A{"$sharedMajor", 1, 0}},
+			}},
+		}},
+		bson.M{"$sort": bson.D{{Key: "score", Value: -1}, {Key: "lastSeen", Value: -1}}},
+	}
+
+	if limit > 0 {
+		pipeline = append(pipeline, bson.M{"$limit": limit})
+	}
+
+	result, err := database.UserCollection.Aggregate(context.TODO(), pipeline)
+	if result != nil {
+		defer result.Close(context.TODO())
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = result.All(context.TODO(), &found)
+
+	if err != nil {
+		return nil, err
+	}
+
+	suggestions := []*UserSuggestion{}
+	for i := range found {
+		suggestions = append(suggestions, &UserSuggestion{
+			Profile:       found[i].User.PublicProfileFor(viewer),
+			MutualFriends: found[i].MutualFriends,
+			SharedMajor:   found[i].SharedMajor,
+		})
+	}
+
+	return suggestions, nil
+}
@@ -0,0 +1,83 @@
+package models
+
+import (
+	"path/filepath"
+	"quenc/mailer"
+	"strings"
+	"testing"
+)
+
+// useTestMailer - Capture the emails in memory, rendered from the templates of the repo, the environment is restored after the test
+func useTestMailer(t *testing.T) *mailer.MemoryMailer {
+	t.Helper()
+
+	t.Setenv("MAIL_TEMPLATE_DIR", filepath.Join("..", "templates", "email"))
+	t.Setenv("PUBLIC_BASE_URL", "https://quenc.test/")
+
+	return mailer.UseMemoryMailer()
+}
+
+// onlyMessageTo - The one email captured for the address
+func onlyMessageTo(t *testing.T, m *mailer.MemoryMailer, address string) mailer.Message {
+	t.Helper()
+
+	messages := m.MessagesTo(address)
+
+	if len(messages) != 1 {
+		t.Fatalf("%d emails were sent to %s, want 1", len(messages), address)
+	}
+
+	return messages[0]
+}
+
+// assertBodiesContain - Both bodies of the email contain every part
+func assertBodiesContain(t *testing.T, msg mailer.Message, parts ...string) {
+	t.Helper()
+
+	for _, part := range parts {
+		if !strings.Contains(msg.TextBody, part) {
+			t.Errorf("The text body doesn't contain %q:\n%s", part, msg.TextBody)
+		}
+
+		if !strings.Contains(msg.HTMLBody, part) {
+			t.Errorf("The HTML body doesn't contain %q:\n%s", part, msg.HTMLBody)
+		}
+	}
+}
+
+func TestSendingVerificationEmail(t *testing.T) {
+	m := useTestMailer(t)
+	user := &User{Email: "student@example.edu"}
+
+	if err := SendingVerificationEmail(user, "verification-token"); err != nil {
+		t.Fatalf("SendingVerificationEmail: %+v", err)
+	}
+
+	msg := onlyMessageTo(t, m, user.Email)
+
+	if !strings.Contains(msg.Subject, "Activate your QuenC account") {
+		t.Errorf("Unexpected subject %q", msg.Subject)
+	}
+
+	assertBodiesContain(t, msg,
+		user.Email,
+		"https://quenc.test/user/email/activate/verification-token",
+	)
+}
+
+func TestSendingPasswordResetEmail(t *testing.T) {
+	m := useTestMailer(t)
+	user := &User{Email: "student@example.edu"}
+
+	if err := SendingPasswordResetEmail(user, "reset-token"); err != nil {
+		t.Fatalf("SendingPasswordResetEmail: %+v", err)
+	}
+
+	msg := onlyMessageTo(t, m, user.Email)
+
+	if !strings.Contains(msg.Subject, "Reset your QuenC password") {
+		t.Errorf("Unexpected subject %q", msg.Subject)
+	}
+
+	assertBodiesContain(t, msg, user.Email, "reset-token")
+}
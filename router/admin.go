@@ -0,0 +1,22 @@
+package router
+
+import "github.com/gin-gonic/gin"
+
+import "quenc/middlewares"
+
+import "quenc/apis"
+
+import "quenc/models"
+
+func InitAdminRouter(router *gin.Engine) {
+	adminRouter := router.Group("/admin")
+	{
+		adminRouter.GET("/users", middlewares.RequirePermission(models.PermissionUserManage), apis.FindUsersForAdmin)
+		adminRouter.GET("/users/:uid", middlewares.RequirePermission(models.PermissionUserManage), apis.FindUserDetailForAdmin)
+		adminRouter.POST("/users/:uid/verify-email", middlewares.RequirePermission(models.PermissionUserManage), apis.VerifyUserEmailForAdmin)
+		adminRouter.PUT("/users/:uid/roles", middlewares.RequirePermission(models.PermissionRoleManage), apis.UpdateUserRoles)
+		adminRouter.POST("/users/:uid/password-reset", middlewares.RequirePermission(models.PermissionUserManage), apis.ForceUserPasswordReset)
+		adminRouter.GET("/audit", middlewares.RequirePermission(models.PermissionAuditView), apis.FindAdminAudit)
+	}
+
+}
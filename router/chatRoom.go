@@ -6,18 +6,20 @@ import "quenc/middlewares"
 
 import "quenc/apis"
 
+import "quenc/models"
+
 func InitChatRoomRouter(router *gin.Engine) {
 	chatRoomRouter := router.Group("/chat-room")
 	{
-		chatRoomRouter.POST("/", middlewares.UserAuth(), apis.AddChatRoom)
-		chatRoomRouter.POST("/message/:rid", middlewares.UserAuth(), apis.AddMessageToChatRoom)
-		chatRoomRouter.POST("/test/message", middlewares.UserAuth(), apis.TestAddMessageToChatRoom)
+		chatRoomRouter.POST("/", middlewares.RequirePermission(models.PermissionChatSend), middlewares.RequireCompleteProfile(), apis.AddChatRoom)
+		chatRoomRouter.POST("/message/:rid", middlewares.RequirePermission(models.PermissionChatSend), middlewares.RequireCompleteProfile(), apis.AddMessageToChatRoom)
+		chatRoomRouter.POST("/test/message", middlewares.RequirePermission(models.PermissionChatSend), apis.TestAddMessageToChatRoom)
 		chatRoomRouter.PATCH("/:rid", middlewares.UserAuth(), apis.UpdateChatRoom)
 		chatRoomRouter.DELETE("/detail/:rid", middlewares.UserAuth(), apis.DeleteChatRoom)
 		chatRoomRouter.GET("/rooms", middlewares.UserAuth(), apis.FindUserChatRoomDetailWithLastMessages)
 		chatRoomRouter.GET("/message/:rid", middlewares.UserAuth(), apis.FindMessagesForRoom)
 		chatRoomRouter.GET("/user/subscribe", middlewares.UserAuth(), apis.SubscribeUserChatRoomDetail)
-		chatRoomRouter.POST("/random/connect", middlewares.UserAuth(), apis.AssignRandomChatRoomForUser)
+		chatRoomRouter.POST("/random/connect", middlewares.RequirePermission(models.PermissionChatSend), middlewares.RequireCompleteProfile(), apis.AssignRandomChatRoomForUser)
 		chatRoomRouter.GET("/random/room", middlewares.UserAuth(), apis.FindDetailOfRandomRoom)
 		chatRoomRouter.GET("/random/message", middlewares.UserAuth(), apis.FindMessageForRandomChatRoom)
 		chatRoomRouter.GET("/random/subscribe", middlewares.UserAuth(), apis.SubscribeUserRandomChatRoomDetail)
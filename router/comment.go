@@ -6,14 +6,16 @@ import "quenc/middlewares"
 
 import "quenc/apis"
 
+import "quenc/models"
+
 func InitCommentRouter(router *gin.Engine) {
 	commentRouter := router.Group("/comment")
 	{
-		commentRouter.POST("/", middlewares.UserAuth(), apis.AddComment)
-		commentRouter.PATCH("/detail/:cid", middlewares.AdminAuth(), apis.UpdateComment)
+		commentRouter.POST("/", middlewares.RequirePermission(models.PermissionCommentCreate), middlewares.RequireCompleteProfile(), apis.AddComment)
+		commentRouter.PATCH("/detail/:cid", middlewares.RequirePermission(models.PermissionCommentUpdateAny), apis.UpdateComment)
 		commentRouter.PATCH("/like/:cid", middlewares.UserAuth(), apis.LikeComment)
-		commentRouter.DELETE("/:cid", middlewares.AdminAuth(), apis.DeleteComment)
-		commentRouter.GET("/post/:pid", apis.FindCommentsByPost)
+		commentRouter.DELETE("/:cid", middlewares.RequirePermission(models.PermissionCommentDeleteAny), apis.DeleteComment)
+		commentRouter.GET("/post/:pid", middlewares.OptionalUserAuth(), apis.FindCommentsByPost)
 		commentRouter.GET("/detail/:cid", apis.FindCommentById)
 	}
 }
@@ -0,0 +1,16 @@
+package router
+
+import "github.com/gin-gonic/gin"
+
+import "quenc/middlewares"
+
+import "quenc/apis"
+
+func InitFeedRouter(router *gin.Engine) {
+	feedRouter := router.Group("/feed")
+	{
+		feedRouter.GET("/home", middlewares.UserAuth(), apis.FindHomeFeed)
+		feedRouter.POST("/seen", middlewares.UserAuth(), apis.MarkPostsSeen)
+	}
+
+}
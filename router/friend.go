@@ -0,0 +1,22 @@
+package router
+
+import "github.com/gin-gonic/gin"
+
+import "quenc/middlewares"
+
+import "quenc/apis"
+
+func InitFriendRouter(router *gin.Engine) {
+	friendRouter := router.Group("/friend")
+	{
+		friendRouter.GET("/requests/incoming", middlewares.UserAuth(), apis.FindFriendRequestsFunc("incoming"))
+		friendRouter.GET("/requests/outgoing", middlewares.UserAuth(), apis.FindFriendRequestsFunc("outgoing"))
+		friendRouter.GET("/requests/accepted", middlewares.UserAuth(), apis.FindFriendRequestsFunc("accepted"))
+		friendRouter.POST("/requests", middlewares.UserAuth(), apis.SendFriendRequest)
+		friendRouter.POST("/requests/:rid/accept", middlewares.UserAuth(), apis.AcceptFriendRequest)
+		friendRouter.POST("/requests/:rid/decline", middlewares.UserAuth(), apis.DeclineFriendRequest)
+		friendRouter.DELETE("/requests/:rid", middlewares.UserAuth(), apis.CancelFriendRequest)
+		friendRouter.POST("/unfriend/:uid", middlewares.UserAuth(), apis.Unfriend)
+	}
+
+}
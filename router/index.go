@@ -36,7 +36,7 @@ type TestInfo struct {
 // InitRouter -initialise all the routers
 func InitRouter() *gin.Engine {
 	router := gin.Default()
-	router.LoadHTMLGlob("templates/*")
+	router.LoadHTMLGlob("templates/*.tmpl") // templates/email is for the mailer
 
 	router.GET("/test", func(c *gin.Context) {
 		c.JSON(200, []string{"123", "321"})
@@ -152,7 +152,7 @@ func InitRouter() *gin.Engine {
 			return
 		}
 
-		pipeline := mongo.Pipeline{bson.D{{"$match", bson.D{{"fullDocument._id", oid}}}}}
+		pipeline := mongo.Pipeline{bson.D{{Key: "$match", Value: bson.D{{Key: "fullDocument._id", Value: oid}}}}}
 
 		collectionStream, err := database.DB.Collection("test").Watch(context.TODO(), pipeline, options.ChangeStream().SetFullDocument(options.UpdateLookup))
 
@@ -250,6 +250,15 @@ func InitRouter() *gin.Engine {
 	InitPostRouter(router)
 	InitCommentRouter(router)
 	InitChatRoomRouter(router)
+	InitUniversityRouter(router)
+	InitLoginAuditRouter(router)
+	InitRoleRouter(router)
+	InitModerationRouter(router)
+	InitFriendRouter(router)
+	InitMediaRouter(router)
+	InitAdminRouter(router)
+	InitSearchRouter(router)
+	InitFeedRouter(router)
 
 	return router
 }
@@ -0,0 +1,17 @@
+package router
+
+import "github.com/gin-gonic/gin"
+
+import "quenc/middlewares"
+
+import "quenc/apis"
+
+import "quenc/models"
+
+func InitLoginAuditRouter(router *gin.Engine) {
+	loginAuditRouter := router.Group("/login-audit")
+	{
+		loginAuditRouter.GET("/", middlewares.RequirePermission(models.PermissionAuditView), apis.FindLoginAudit)
+	}
+
+}
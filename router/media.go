@@ -0,0 +1,23 @@
+package router
+
+import "github.com/gin-gonic/gin"
+
+import "quenc/middlewares"
+
+import "quenc/apis"
+
+import "quenc/storage"
+
+func InitMediaRouter(router *gin.Engine) {
+	mediaRouter := router.Group("/media")
+	{
+		mediaRouter.POST("/", middlewares.UserAuth(), apis.UploadMedia)
+		mediaRouter.GET("/:mid", apis.FindMedia)
+		mediaRouter.GET("/:mid/:variant", apis.RedirectToMediaVariant)
+	}
+
+	// The files of the local storage are served by this service
+	if local, ok := storage.DefaultStorage.(*storage.LocalStorage); ok {
+		router.Static(storage.LocalPath, local.Dir)
+	}
+}
@@ -0,0 +1,20 @@
+package router
+
+import "github.com/gin-gonic/gin"
+
+import "quenc/middlewares"
+
+import "quenc/apis"
+
+import "quenc/models"
+
+func InitModerationRouter(router *gin.Engine) {
+	moderationRouter := router.Group("/moderation")
+	{
+		moderationRouter.GET("/history/:uid", middlewares.RequirePermission(models.PermissionUserModerate), apis.FindModerationHistory)
+		moderationRouter.POST("/suspend/:uid", middlewares.RequirePermission(models.PermissionUserModerate), apis.SuspendUser)
+		moderationRouter.POST("/ban/:uid", middlewares.RequirePermission(models.PermissionUserModerate), apis.BanUser)
+		moderationRouter.POST("/lift/:uid", middlewares.RequirePermission(models.PermissionUserModerate), apis.LiftRestriction)
+	}
+
+}
@@ -6,17 +6,22 @@ import "quenc/middlewares"
 
 import "quenc/apis"
 
+import "quenc/models"
+
 func InitPostRouter(router *gin.Engine) {
 	postRouter := router.Group("/post")
 	{
-		postRouter.POST("/", middlewares.UserAuth(), apis.AddPost)
+		postRouter.POST("/", middlewares.RequirePermission(models.PermissionPostCreate), middlewares.RequireCompleteProfile(), apis.AddPost)
 		postRouter.PATCH("/like/:pid", middlewares.UserAuth(), apis.LikePost)
 		postRouter.PATCH("/detail/:pid", middlewares.UserAuth(), apis.UpdatePost)
 		postRouter.DELETE("/:pid", middlewares.UserAuth(), apis.DeletePost)
-		postRouter.GET("/category/:cid", apis.FindAllPostWithCategory) // cid = all, then we fetch all
-		postRouter.GET("/author/:aid", apis.FindPostByAuthor)
-		postRouter.GET("/detail/:pid", apis.FindPostById)
+		postRouter.GET("/category/:cid", middlewares.OptionalUserAuth(), apis.FindAllPostWithCategory) // cid = all, then we fetch all
+		postRouter.GET("/author/:aid", middlewares.OptionalUserAuth(), apis.FindPostByAuthor)
+		postRouter.GET("/detail/:pid", middlewares.OptionalUserAuth(), apis.FindPostById)
 		postRouter.GET("/saved", middlewares.UserAuth(), apis.FindSavedPost)
-		postRouter.GET("/array", apis.FindArrayOfPosts)
+		postRouter.GET("/array", middlewares.OptionalUserAuth(), apis.FindArrayOfPosts)
+		postRouter.GET("/revisions/:pid", middlewares.OptionalUserAuth(), apis.FindPostRevisions)
+		postRouter.GET("/revisions/:pid/diff", apis.DiffPostRevisions)
+		postRouter.POST("/revisions/:pid/restore/:number", middlewares.RequirePermission(models.PermissionPostRestore), apis.RestorePostRevision)
 	}
 }
@@ -6,14 +6,18 @@ import "quenc/middlewares"
 
 import "quenc/apis"
 
+import "quenc/models"
+
 func InitPostCategoryRouter(router *gin.Engine) {
 	postCategoryRouter := router.Group("/post-category")
 	{
-		postCategoryRouter.POST("/", middlewares.AdminAuth(), apis.AddPostCategory)
-		postCategoryRouter.PATCH("/:cid", middlewares.AdminAuth(), apis.UpdatePostCategory)
-		postCategoryRouter.DELETE("/:cid", middlewares.AdminAuth(), apis.DeletePostCategoryById)
+		postCategoryRouter.POST("/", middlewares.RequirePermission(models.PermissionCategoryManage), apis.AddPostCategory)
+		postCategoryRouter.PATCH("/:cid", middlewares.RequirePermission(models.PermissionCategoryManage), apis.UpdatePostCategory)
+		postCategoryRouter.DELETE("/:cid", middlewares.RequirePermission(models.PermissionCategoryManage), apis.DeletePostCategoryById)
 		postCategoryRouter.GET("/", apis.FindAllPostCategorys)
 		postCategoryRouter.GET("/detail/:cid", apis.FindPostCategoryByID)
+		postCategoryRouter.POST("/follow/:cid", middlewares.UserAuth(), apis.FollowPostCategory)
+		postCategoryRouter.POST("/unfollow/:cid", middlewares.UserAuth(), apis.UnfollowPostCategory)
 	}
 
 }
@@ -6,15 +6,17 @@ import "quenc/middlewares"
 
 import "quenc/apis"
 
+import "quenc/models"
+
 func InitReportRouter(router *gin.Engine) {
 	reportRouter := router.Group("/report")
 	{
-		reportRouter.POST("/", middlewares.UserAuth(), apis.AddReport)
-		reportRouter.PATCH("/:rid", middlewares.AdminAuth(), apis.UpdateReport)
-		reportRouter.DELETE("/:rid", middlewares.AdminAuth(), apis.DeleteReport)
-		// reportRouter.GET("/", middlewares.AdminAuth(), apis.FindReportsForPreview)
-		reportRouter.GET("/", middlewares.AdminAuth(), apis.FindReportsWithDetail)
-		reportRouter.GET("/detail/:rid", middlewares.AdminAuth(), apis.FindSingleReport)
+		reportRouter.POST("/", middlewares.RequirePermission(models.PermissionReportCreate), apis.AddReport)
+		reportRouter.PATCH("/:rid", middlewares.RequirePermission(models.PermissionReportResolve), apis.UpdateReport)
+		reportRouter.DELETE("/:rid", middlewares.RequirePermission(models.PermissionReportDelete), apis.DeleteReport)
+		// reportRouter.GET("/", middlewares.RequirePermission(models.PermissionReportView), apis.FindReportsForPreview)
+		reportRouter.GET("/", middlewares.RequirePermission(models.PermissionReportView), apis.FindReportsWithDetail)
+		reportRouter.GET("/detail/:rid", middlewares.RequirePermission(models.PermissionReportView), apis.FindSingleReport)
 
 	}
 
@@ -0,0 +1,19 @@
+package router
+
+import "github.com/gin-gonic/gin"
+
+import "quenc/middlewares"
+
+import "quenc/apis"
+
+import "quenc/models"
+
+func InitRoleRouter(router *gin.Engine) {
+	roleRouter := router.Group("/role")
+	{
+		roleRouter.GET("/", middlewares.UserAuth(), apis.FindRoles)
+		roleRouter.POST("/grant/:uid", middlewares.RequirePermission(models.PermissionRoleManage), apis.GrantRole)
+		roleRouter.POST("/revoke/:uid", middlewares.RequirePermission(models.PermissionRoleManage), apis.RevokeRole)
+	}
+
+}
@@ -0,0 +1,16 @@
+package router
+
+import "github.com/gin-gonic/gin"
+
+import "quenc/middlewares"
+
+import "quenc/apis"
+
+func InitSearchRouter(router *gin.Engine) {
+	searchRouter := router.Group("/search")
+	{
+		searchRouter.GET("/posts", middlewares.OptionalUserAuth(), apis.SearchPosts)
+		searchRouter.GET("/comments", middlewares.OptionalUserAuth(), apis.SearchComments)
+	}
+
+}
@@ -0,0 +1,22 @@
+package router
+
+import "github.com/gin-gonic/gin"
+
+import "quenc/middlewares"
+
+import "quenc/apis"
+
+import "quenc/models"
+
+func InitUniversityRouter(router *gin.Engine) {
+	universityRouter := router.Group("/university")
+	{
+		universityRouter.POST("/", middlewares.RequirePermission(models.PermissionUniversityManage), apis.AddUniversity)
+		universityRouter.PATCH("/:unid", middlewares.RequirePermission(models.PermissionUniversityManage), apis.UpdateUniversity)
+		universityRouter.DELETE("/:unid", middlewares.RequirePermission(models.PermissionUniversityManage), apis.DeleteUniversityById)
+		universityRouter.GET("/", apis.FindEnabledUniversities)
+		universityRouter.GET("/all", middlewares.RequirePermission(models.PermissionUniversityManage), apis.FindAllUniversities)
+		universityRouter.GET("/detail/:unid", apis.FindUniversityByID)
+	}
+
+}
@@ -11,15 +11,47 @@ func InitUserRouter(router *gin.Engine) {
 	{
 		userRouter.POST("/signup", apis.SingupUser)
 		userRouter.POST("/login", apis.LoginUser)
+		userRouter.POST("/login/2fa", apis.LoginWithTwoFactor)
+		userRouter.POST("/2fa/enrol", middlewares.UserAuth(), apis.EnrolTwoFactor)
+		userRouter.POST("/2fa/verify", middlewares.UserAuth(), apis.VerifyTwoFactorEnrolment)
+		userRouter.POST("/2fa/recovery-codes", middlewares.UserAuth(), apis.RegenerateRecoveryCodes)
+		userRouter.POST("/2fa/disable", middlewares.UserAuth(), apis.DisableTwoFactor)
+		userRouter.POST("/refresh-token", apis.RefreshAuthToken)
+		userRouter.POST("/change-password", middlewares.UserAuth(), apis.ChangePassword)
+		userRouter.POST("/forgot-password", apis.ForgotPassword)
+		userRouter.POST("/reset-password", apis.ResetPassword)
+		userRouter.POST("/logout", middlewares.UserAuth(), apis.Logout)
+		userRouter.POST("/logout-all", middlewares.UserAuth(), apis.LogoutAll)
+		userRouter.GET("/sessions", middlewares.UserAuth(), apis.FindUserSessions)
+		userRouter.POST("/deletion", middlewares.UserAuth(), apis.RequestAccountDeletion)
+		userRouter.DELETE("/deletion", middlewares.UserAuth(), apis.CancelAccountDeletion)
+		userRouter.GET("/export", middlewares.UserAuth(), apis.ExportUserData)
 		userRouter.POST("/auto-login", middlewares.UserAuth(), apis.TokenAutoLogin)
 		userRouter.GET("/send-verification-email", middlewares.UserAuth(), apis.SendVerificationEmailForUser)
-		userRouter.GET("/email/activate/:uid", apis.ActivateUserEmail)
+		userRouter.GET("/email/activate/:token", apis.ActivateUserEmail)
+		userRouter.GET("/unlock/:token", apis.UnlockUserAccount)
 		userRouter.PATCH("/detail/:uid", middlewares.UserAuth(), apis.UpdateUser)
-		userRouter.PATCH("/friends/:id/:condition", middlewares.UserAuth(), apis.ToggleFunc("friends"))
+		userRouter.POST("/photo", middlewares.UserAuth(), apis.UploadUserPhoto)
+		userRouter.GET("/onboarding", middlewares.UserAuth(), apis.FindOnboardingStatus)
+		userRouter.GET("/search", middlewares.UserAuth(), apis.SearchUsers)
+		userRouter.GET("/suggestions", middlewares.UserAuth(), apis.FindUserSuggestions)
+		// Not /:uid, the wildcard would conflict with the static routes of /user
+		userRouter.GET("/profile/:uid", middlewares.OptionalUserAuth(), apis.FindUserProfile)
+		userRouter.GET("/privacy", middlewares.UserAuth(), apis.FindPrivacySettings)
+		userRouter.PATCH("/privacy", middlewares.UserAuth(), apis.UpdatePrivacySettings)
+		userRouter.POST("/block/:uid", middlewares.UserAuth(), apis.BlockUser)
+		userRouter.POST("/unblock/:uid", middlewares.UserAuth(), apis.UnblockUser)
+		userRouter.GET("/blocked", middlewares.UserAuth(), apis.FindBlockedUsers)
+		userRouter.POST("/follow/:uid", middlewares.UserAuth(), apis.FollowAuthor)
+		userRouter.POST("/unfollow/:uid", middlewares.UserAuth(), apis.UnfollowAuthor)
+		userRouter.GET("/following", middlewares.UserAuth(), apis.FindFollowing)
+		userRouter.GET("/friends/status", middlewares.UserAuth(), apis.FindFriendStatuses)
+		userRouter.GET("/friends/status/subscribe", middlewares.UserAuth(), apis.SubscribeFriendStatuses)
 		userRouter.PATCH("/chat-rooms/:id/:condition", middlewares.UserAuth(), apis.ToggleFunc("chatRooms"))
 		userRouter.PATCH("/like-posts/:id/:condition", middlewares.UserAuth(), apis.ToggleFunc("likePosts"))
 		userRouter.PATCH("/like-comments/:id/:condition", middlewares.UserAuth(), apis.ToggleFunc("likeComments"))
 		userRouter.PATCH("/saved-posts/:id/:condition", middlewares.UserAuth(), apis.ToggleFunc("savedPosts"))
+		userRouter.PATCH("/hidden-posts/:id/:condition", middlewares.UserAuth(), apis.ToggleFunc("hiddenPosts"))
 		userRouter.GET("/subsrible", middlewares.UserAuth(), apis.SubscribeUser)
 	}
 }
@@ -0,0 +1,297 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+/*
+	Local
+*/
+
+// LocalPath - The path the LocalStorage files are served under
+const LocalPath = "/uploads"
+
+// LocalStorage - Keeping the files in a local directory, served by this service under LocalPath
+type LocalStorage struct {
+	Dir     string
+	BaseURL string
+}
+
+// NewLocalStorageFromEnv - Setting up the LocalStorage, MEDIA_LOCAL_DIR defaults to uploads
+func NewLocalStorageFromEnv() *LocalStorage {
+	dir := os.Getenv("MEDIA_LOCAL_DIR")
+	if strings.TrimSpace(dir) == "" {
+		dir = "uploads"
+	}
+
+	return &LocalStorage{Dir: dir, BaseURL: publicBaseURL() + LocalPath}
+}
+
+// path - The file path of the key, the keys can't leave the directory
+func (s *LocalStorage) path(key string) (string, error) {
+	cleaned := filepath.Clean("/" + key)
+	if cleaned == "/" {
+		return "", errors.New("the key is empty")
+	}
+
+	return filepath.Join(s.Dir, filepath.FromSlash(cleaned)), nil
+}
+
+// Put - Write the file to the directory
+func (s *LocalStorage) Put(key string, contentType string, body []byte) error {
+	path, err := s.path(key)
+
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(path, body, 0644)
+}
+
+// Delete - Remove the file, a missing one is not an error
+func (s *LocalStorage) Delete(key string) error {
+	path, err := s.path(key)
+
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
+
+// URL - The URL of the file served by this service
+func (s *LocalStorage) URL(key string) string {
+	return s.BaseURL + "/" + strings.TrimLeft(key, "/")
+}
+
+/*
+	S3
+*/
+
+// S3Storage - Keeping the files in a bucket of an S3-compatible service, with path-style requests
+type S3Storage struct {
+	Endpoint  string
+	Region    string
+	Bucket    string
+	AccessKey string
+	SecretKey string
+	PublicURL string // where the files can be read, the bucket URL when not given
+	client    *http.Client
+}
+
+// NewS3StorageFromEnv - Setting up the S3Storage, the AWS endpoint of the region is used when MEDIA_S3_ENDPOINT is not given
+func NewS3StorageFromEnv() *S3Storage {
+	s := &S3Storage{
+		Endpoint:  os.Getenv("MEDIA_S3_ENDPOINT"),
+		Region:    os.Getenv("MEDIA_S3_REGION"),
+		Bucket:    os.Getenv("MEDIA_S3_BUCKET"),
+		AccessKey: os.Getenv("MEDIA_S3_ACCESS_KEY"),
+		SecretKey: os.Getenv("MEDIA_S3_SECRET_KEY"),
+		PublicURL: os.Getenv("MEDIA_S3_PUBLIC_URL"),
+		client:    &http.Client{Timeout: 30 * time.Second},
+	}
+
+	if strings.TrimSpace(s.Region) == "" {
+		s.Region = "us-east-1"
+	}
+
+	if strings.TrimSpace(s.Endpoint) == "" {
+		s.Endpoint = fmt.Sprintf("https://s3.%s.amazonaws.com", s.Region)
+	}
+	s.Endpoint = strings.TrimRight(s.Endpoint, "/")
+
+	if strings.TrimSpace(s.PublicURL) == "" {
+		s.PublicURL = s.Endpoint + "/" + s.Bucket
+	}
+	s.PublicURL = strings.TrimRight(s.PublicURL, "/")
+
+	return s
+}
+
+// objectURL - The path-style URL of the object
+func (s *S3Storage) objectURL(key string) (*url.URL, error) {
+	escaped := []string{}
+	for _, segment := range strings.Split(strings.TrimLeft(key, "/"), "/") {
+		escaped = append(escaped, url.PathEscape(segment))
+	}
+
+	return url.Parse(s.Endpoint + "/" + url.PathEscape(s.Bucket) + "/" + strings.Join(escaped, "/"))
+}
+
+// do - Send the request signed with the AWS Signature Version 4
+func (s *S3Storage) do(method string, key string, contentType string, body []byte) error {
+	objectURL, err := s.objectURL(key)
+
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(method, objectURL.String(), bytes.NewReader(body))
+
+	if err != nil {
+		return err
+	}
+
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	s.sign(req, body, time.Now().UTC())
+
+	resp, err := s.client.Do(req)
+
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		message, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("the storage responded %s: %s", resp.Status, message)
+	}
+
+	return nil
+}
+
+// sign - Add the AWS Signature Version 4 headers to the request
+func (s *S3Storage) sign(req *http.Request, body []byte, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	day := now.Format("20060102")
+	payloadHash := sha256Hex(body)
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	signedHeaders := []string{"host", "x-amz-content-sha256", "x-amz-date"}
+	if req.Header.Get("Content-Type") != "" {
+		signedHeaders = append([]string{"content-type"}, signedHeaders...)
+	}
+
+	canonicalHeaders := ""
+	for _, header := range signedHeaders {
+		value := req.Header.Get(header)
+		if header == "host" {
+			value = req.URL.Host
+		}
+		canonicalHeaders += header + ":" + strings.TrimSpace(value) + "\n"
+	}
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		canonicalURI(req.URL),
+		canonicalQuery(req.URL),
+		canonicalHeaders,
+		strings.Join(signedHeaders, ";"),
+		payloadHash,
+	}, "\n")
+
+	scope := day + "/" + s.Region + "/s3/aws4_request"
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		sha256Hex([]byte(canonicalRequest)),
+	}, "\n")
+
+	signingKey := hmacSHA256([]byte("AWS4"+s.SecretKey), day)
+	signingKey = hmacSHA256(signingKey, s.Region)
+	signingKey = hmacSHA256(signingKey, "s3")
+	signingKey = hmacSHA256(signingKey, "aws4_request")
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.AccessKey,
+		scope,
+		strings.Join(signedHeaders, ";"),
+		hex.EncodeToString(hmacSHA256(signingKey, stringToSign)),
+	))
+}
+
+// Put - Upload the file to the bucket
+func (s *S3Storage) Put(key string, contentType string, body []byte) error {
+	return s.do(http.MethodPut, key, contentType, body)
+}
+
+// Delete - Remove the file from the bucket
+func (s *S3Storage) Delete(key string) error {
+	return s.do(http.MethodDelete, key, "", nil)
+}
+
+// URL - The public URL of the file
+func (s *S3Storage) URL(key string) string {
+	return s.PublicURL + "/" + strings.TrimLeft(key, "/")
+}
+
+// canonicalURI - The path of the request, each segment encoded the way AWS does
+func canonicalURI(u *url.URL) string {
+	if u.Path == "" {
+		return "/"
+	}
+
+	segments := strings.Split(u.Path, "/")
+	for i, segment := range segments {
+		segments[i] = awsURIEncode(segment)
+	}
+
+	return strings.Join(segments, "/")
+}
+
+// canonicalQuery - The query of the request sorted by name then value, a name without a value gets an empty one
+func canonicalQuery(u *url.URL) string {
+	pairs := []string{}
+	for name, values := range u.Query() {
+		for _, value := range values {
+			pairs = append(pairs, awsURIEncode(name)+"="+awsURIEncode(value))
+		}
+	}
+	sort.Strings(pairs)
+
+	return strings.Join(pairs, "&")
+}
+
+// awsURIEncode - Percent-encode everything but the unreserved characters, spaces included
+func awsURIEncode(s string) string {
+	var encoded strings.Builder
+	for _, b := range []byte(s) {
+		if (b >= 'A' && b <= 'Z') || (b >= 'a' && b <= 'z') || (b >= '0' && b <= '9') || strings.IndexByte("-_.~", b) >= 0 {
+			encoded.WriteByte(b)
+		} else {
+			fmt.Fprintf(&encoded, "%%%02X", b)
+		}
+	}
+
+	return encoded.String()
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,66 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Storage - Anything which can keep the uploaded files and give a URL for them
+type Storage interface {
+	Put(key string, contentType string, body []byte) error
+	Delete(key string) error
+	URL(key string) string
+}
+
+// DefaultStorage - The Storage used by Put, Delete and URL, set by InitStorage
+var DefaultStorage Storage
+
+// InitStorage - Initialise the DefaultStorage from the environment variables
+// MEDIA_STORAGE can be local (default) or s3
+func InitStorage() {
+	switch strings.ToLower(strings.TrimSpace(os.Getenv("MEDIA_STORAGE"))) {
+	case "s3":
+		DefaultStorage = NewS3StorageFromEnv()
+	default:
+		DefaultStorage = NewLocalStorageFromEnv()
+	}
+
+	fmt.Printf("Storage initialised with %T\n", DefaultStorage)
+}
+
+// Put - Store the file with the DefaultStorage
+func Put(key string, contentType string, body []byte) error {
+	if DefaultStorage == nil {
+		return errors.New("the storage is not initialised")
+	}
+
+	return DefaultStorage.Put(key, contentType, body)
+}
+
+// Delete - Remove the file from the DefaultStorage
+func Delete(key string) error {
+	if DefaultStorage == nil {
+		return errors.New("the storage is not initialised")
+	}
+
+	return DefaultStorage.Delete(key)
+}
+
+// URL - The URL of the file in the DefaultStorage
+func URL(key string) string {
+	if DefaultStorage == nil {
+		return ""
+	}
+
+	return DefaultStorage.URL(key)
+}
+
+// publicBaseURL - The URL the users can reach this service with, set by PUBLIC_BASE_URL
+func publicBaseURL() string {
+	if baseURL := strings.TrimSpace(os.Getenv("PUBLIC_BASE_URL")); baseURL != "" {
+		return strings.TrimRight(baseURL, "/")
+	}
+	return "http://localhost:8080"
+}
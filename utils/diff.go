@@ -0,0 +1,133 @@
+package utils
+
+import "strings"
+
+// The operations of the DiffLines
+const (
+	DiffEqual  = "equal"
+	DiffInsert = "insert"
+	DiffDelete = "delete"
+)
+
+// diffMaxCells - The product of the numbers of the lines compared, the longer texts are replaced as a whole
+// The memory of the comparison is linear, this bounds the time
+const diffMaxCells = 4000000
+
+// DiffLine - A line kept, inserted into or deleted from the text
+type DiffLine struct {
+	Op   string `json:"op"`
+	Text string `json:"text"`
+}
+
+// DiffLines - The line-by-line changes from a text to another, by their longest common subsequence
+// The subsequence is found by Hirschberg's algorithm, in space linear in the lines
+func DiffLines(from string, to string) []DiffLine {
+	a := strings.Split(from, "\n")
+	b := strings.Split(to, "\n")
+	diff := []DiffLine{}
+
+	// The common lines at both ends are kept as they are
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	for _, line := range a[:prefix] {
+		diff = append(diff, DiffLine{Op: DiffEqual, Text: line})
+	}
+
+	middleA, middleB := a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]
+
+	if len(middleA)*len(middleB) > diffMaxCells {
+		diff = appendDiffLines(diff, DiffDelete, middleA)
+		diff = appendDiffLines(diff, DiffInsert, middleB)
+	} else {
+		diff = diffMiddle(diff, middleA, middleB)
+	}
+
+	for _, line := range a[len(a)-suffix:] {
+		diff = append(diff, DiffLine{Op: DiffEqual, Text: line})
+	}
+
+	return diff
+}
+
+func appendDiffLines(diff []DiffLine, op string, lines []string) []DiffLine {
+	for _, line := range lines {
+		diff = append(diff, DiffLine{Op: op, Text: line})
+	}
+	return diff
+}
+
+// diffMiddle - Append the changes from a to b, splitting a in half where the subsequences of both halves meet in b
+func diffMiddle(diff []DiffLine, a []string, b []string) []DiffLine {
+	switch {
+	case len(a) == 0:
+		return appendDiffLines(diff, DiffInsert, b)
+	case len(b) == 0:
+		return appendDiffLines(diff, DiffDelete, a)
+	case len(a) == 1:
+		for k, line := range b {
+			if line == a[0] {
+				diff = appendDiffLines(diff, DiffInsert, b[:k])
+				diff = append(diff, DiffLine{Op: DiffEqual, Text: line})
+				return appendDiffLines(diff, DiffInsert, b[k+1:])
+			}
+		}
+		diff = append(diff, DiffLine{Op: DiffDelete, Text: a[0]})
+		return appendDiffLines(diff, DiffInsert, b)
+	}
+
+	mid := len(a) / 2
+	forward := lcsLengths(a[:mid], b, false)
+	backward := lcsLengths(a[mid:], b, true)
+
+	split, best := 0, -1
+	for k := 0; k <= len(b); k++ {
+		if length := forward[k] + backward[len(b)-k]; length > best {
+			split, best = k, length
+		}
+	}
+
+	diff = diffMiddle(diff, a[:mid], b[:split])
+	return diffMiddle(diff, a[mid:], b[split:])
+}
+
+// lcsLengths - The lengths of the longest common subsequences of a and each prefix of b, or of each suffix of b when reversed
+// Only two rows are kept
+func lcsLengths(a []string, b []string, reversed bool) []int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+
+	for i := range a {
+		lineA := a[i]
+		if reversed {
+			lineA = a[len(a)-1-i]
+		}
+
+		for j := 1; j <= len(b); j++ {
+			lineB := b[j-1]
+			if reversed {
+				lineB = b[len(b)-j]
+			}
+
+			switch {
+			case lineA == lineB:
+				current[j] = previous[j-1] + 1
+			case previous[j] >= current[j-1]:
+				current[j] = previous[j]
+			default:
+				current[j] = current[j-1]
+			}
+		}
+
+		previous, current = current, previous
+	}
+
+	return previous
+}
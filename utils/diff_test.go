@@ -0,0 +1,122 @@
+package utils
+
+import (
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// applyDiff - The texts before and after the changes, and how many lines are kept
+func applyDiff(diff []DiffLine) (string, string, int) {
+	from, to := []string{}, []string{}
+	kept := 0
+
+	for _, line := range diff {
+		switch line.Op {
+		case DiffEqual:
+			from = append(from, line.Text)
+			to = append(to, line.Text)
+			kept++
+		case DiffDelete:
+			from = append(from, line.Text)
+		case DiffInsert:
+			to = append(to, line.Text)
+		}
+	}
+
+	return strings.Join(from, "\n"), strings.Join(to, "\n"), kept
+}
+
+// lcsLength - The length of the longest common subsequence by the full table, to check DiffLines against
+func lcsLength(a []string, b []string) int {
+	table := make([][]int, len(a)+1)
+	for i := range table {
+		table[i] = make([]int, len(b)+1)
+	}
+
+	for i := 1; i <= len(a); i++ {
+		for j := 1; j <= len(b); j++ {
+			switch {
+			case a[i-1] == b[j-1]:
+				table[i][j] = table[i-1][j-1] + 1
+			case table[i-1][j] >= table[i][j-1]:
+				table[i][j] = table[i-1][j]
+			default:
+				table[i][j] = table[i][j-1]
+			}
+		}
+	}
+
+	return table[len(a)][len(b)]
+}
+
+func TestDiffLines(t *testing.T) {
+	cases := []struct {
+		name string
+		from string
+		to   string
+		want []DiffLine
+	}{
+		{"same", "a\nb", "a\nb", []DiffLine{{DiffEqual, "a"}, {DiffEqual, "b"}}},
+		{"inserted", "a\nc", "a\nb\nc", []DiffLine{{DiffEqual, "a"}, {DiffInsert, "b"}, {DiffEqual, "c"}}},
+		{"deleted", "a\nb\nc", "a\nc", []DiffLine{{DiffEqual, "a"}, {DiffDelete, "b"}, {DiffEqual, "c"}}},
+		{"replaced", "a\nb\nc", "a\nx\nc", []DiffLine{{DiffEqual, "a"}, {DiffDelete, "b"}, {DiffInsert, "x"}, {DiffEqual, "c"}}},
+		{"from empty", "", "a", []DiffLine{{DiffDelete, ""}, {DiffInsert, "a"}}},
+		{"moved", "a\nb\nc", "b\nc\na", []DiffLine{{DiffDelete, "a"}, {DiffEqual, "b"}, {DiffEqual, "c"}, {DiffInsert, "a"}}},
+	}
+
+	for _, tc := range cases {
+		if got := DiffLines(tc.from, tc.to); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: DiffLines = %+v, want %+v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestDiffLinesLongestCommonSubsequence(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+	alphabet := []string{"a", "b", "c", "d"}
+
+	randomText := func() []string {
+		lines := make([]string, random.Intn(30))
+		for i := range lines {
+			lines[i] = alphabet[random.Intn(len(alphabet))]
+		}
+		return lines
+	}
+
+	for n := 0; n < 500; n++ {
+		a, b := randomText(), randomText()
+		from, to := strings.Join(a, "\n"), strings.Join(b, "\n")
+
+		gotFrom, gotTo, kept := applyDiff(DiffLines(from, to))
+
+		if gotFrom != from || gotTo != to {
+			t.Fatalf("DiffLines(%q, %q) doesn't give back the texts: %q, %q", from, to, gotFrom, gotTo)
+		}
+
+		if want := lcsLength(strings.Split(from, "\n"), strings.Split(to, "\n")); kept != want {
+			t.Fatalf("DiffLines(%q, %q) keeps %d lines, want %d", from, to, kept, want)
+		}
+	}
+}
+
+func TestDiffLinesOverTheLimit(t *testing.T) {
+	a := make([]string, 3000)
+	b := make([]string, 3000)
+	for i := range a {
+		a[i] = "from " + strings.Repeat("x", i%7)
+		b[i] = "to " + strings.Repeat("y", i%5)
+	}
+	a[0], b[0] = "same", "same"
+
+	from, to, kept := applyDiff(DiffLines(strings.Join(a, "\n"), strings.Join(b, "\n")))
+
+	if from != strings.Join(a, "\n") || to != strings.Join(b, "\n") {
+		t.Fatal("DiffLines over the limit doesn't give back the texts")
+	}
+
+	if kept != 1 {
+		t.Errorf("DiffLines over the limit keeps %d lines, want only the common prefix", kept)
+	}
+}
@@ -0,0 +1,284 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+)
+
+// The image types which can be uploaded
+const (
+	ImageJPEG = "image/jpeg"
+	ImagePNG  = "image/png"
+	ImageGIF  = "image/gif"
+)
+
+// MaxImagePixels - The largest image which is decoded, so a small file can't expand to gigabytes in memory
+// It's decoded then copied to RGBA, and copied again when it's turned upright, up to about 12 bytes per pixel
+const MaxImagePixels = 16 * 1000 * 1000
+
+// MaxImageDecodes - How many images can be held decoded at once, the rest wait for a slot
+const MaxImageDecodes = 4
+
+// JPEGQuality - The quality of the re-encoded JPEG images
+const JPEGQuality = 85
+
+// ErrUnsupportedImage - The file is not one of the image types which can be uploaded
+var ErrUnsupportedImage = errors.New("the file is not a JPEG, PNG or GIF image")
+
+// ErrImageTooLarge - The image has more than MaxImagePixels
+var ErrImageTooLarge = errors.New("the image has too many pixels")
+
+var imageDecodeSlots = make(chan struct{}, MaxImageDecodes)
+
+// AcquireImageSlot - Wait for one of the MaxImageDecodes slots, the returned func gives it back once the image is done with
+func AcquireImageSlot(ctx context.Context) (func(), error) {
+	select {
+	case imageDecodeSlots <- struct{}{}:
+		return func() { <-imageDecodeSlots }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// DetectImageType - The type of the image sniffed from its content, the type given by the client is not trusted
+func DetectImageType(data []byte) (string, error) {
+	switch contentType := http.DetectContentType(data); contentType {
+	case ImageJPEG, ImagePNG, ImageGIF:
+		return contentType, nil
+	default:
+		return "", ErrUnsupportedImage
+	}
+}
+
+// DecodeImage - Decode the image, turned upright by the EXIF orientation of the JPEG images
+// Only the pixels are kept, so the EXIF and other metadata are gone once it's encoded again
+func DecodeImage(data []byte) (*image.RGBA, error) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+
+	if err != nil {
+		return nil, ErrUnsupportedImage
+	}
+
+	if config.Width*config.Height > MaxImagePixels {
+		return nil, ErrImageTooLarge
+	}
+
+	var decoded image.Image
+
+	switch contentType, _ := DetectImageType(data); contentType {
+	case ImageJPEG:
+		decoded, err = jpeg.Decode(bytes.NewReader(data))
+	case ImagePNG:
+		decoded, err = png.Decode(bytes.NewReader(data))
+	case ImageGIF:
+		// Only the first frame of the animated ones
+		decoded, err = gif.Decode(bytes.NewReader(data))
+	default:
+		return nil, ErrUnsupportedImage
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	bounds := decoded.Bounds()
+	img := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(img, img.Bounds(), decoded, bounds.Min, draw.Src)
+
+	return orientImage(img, jpegOrientation(data)), nil
+}
+
+// ResizeImage - Scale the image down so its longer side is at most maxSide, the smaller ones are returned as they are
+// Each pixel is the average of the pixels it covers, which keeps the details of the large photos
+func ResizeImage(img *image.RGBA, maxSide int) *image.RGBA {
+	srcW, srcH := img.Bounds().Dx(), img.Bounds().Dy()
+
+	if srcW <= maxSide && srcH <= maxSide {
+		return img
+	}
+
+	dstW, dstH := maxSide, srcH*maxSide/srcW
+	if srcH > srcW {
+		dstW, dstH = srcW*maxSide/srcH, maxSide
+	}
+	if dstW < 1 {
+		dstW = 1
+	}
+	if dstH < 1 {
+		dstH = 1
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dstW, dstH))
+
+	for dy := 0; dy < dstH; dy++ {
+		y0, y1 := dy*srcH/dstH, (dy+1)*srcH/dstH
+		if y1 <= y0 {
+			y1 = y0 + 1
+		}
+
+		for dx := 0; dx < dstW; dx++ {
+			x0, x1 := dx*srcW/dstW, (dx+1)*srcW/dstW
+			if x1 <= x0 {
+				x1 = x0 + 1
+			}
+
+			var sum [4]int
+			for y := y0; y < y1; y++ {
+				row := img.Pix[y*img.Stride+x0*4 : y*img.Stride+x1*4]
+				for i := 0; i < len(row); i += 4 {
+					sum[0] += int(row[i])
+					sum[1] += int(row[i+1])
+					sum[2] += int(row[i+2])
+					sum[3] += int(row[i+3])
+				}
+			}
+
+			count := (x1 - x0) * (y1 - y0)
+			offset := dy*dst.Stride + dx*4
+			for i := range sum {
+				dst.Pix[offset+i] = uint8(sum[i] / count)
+			}
+		}
+	}
+
+	return dst
+}
+
+// EncodeImage - Encode the image as a JPEG for the photos, and as a PNG for the others so the transparency is kept
+func EncodeImage(img *image.RGBA, contentType string) ([]byte, string, error) {
+	var buf bytes.Buffer
+
+	if contentType == ImageJPEG {
+		if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: JPEGQuality}); err != nil {
+			return nil, "", err
+		}
+		return buf.Bytes(), ImageJPEG, nil
+	}
+
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, "", err
+	}
+	return buf.Bytes(), ImagePNG, nil
+}
+
+// jpegOrientation - The EXIF orientation of the JPEG image, 1 (upright) when there is none
+func jpegOrientation(data []byte) int {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return 1
+	}
+
+	for i := 2; i+4 <= len(data); {
+		if data[i] != 0xFF {
+			return 1
+		}
+
+		marker := data[i+1]
+		length := int(binary.BigEndian.Uint16(data[i+2 : i+4]))
+
+		// The image data starts, there is no EXIF before it
+		if marker == 0xDA || length < 2 || i+2+length > len(data) {
+			return 1
+		}
+
+		segment := data[i+4 : i+2+length]
+
+		if marker == 0xE1 && len(segment) > 6 && string(segment[:6]) == "Exif\x00\x00" {
+			return exifOrientation(segment[6:])
+		}
+
+		i += 2 + length
+	}
+
+	return 1
+}
+
+// exifOrientation - Find the orientation tag (0x0112) in the first IFD of the TIFF data
+func exifOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+
+	offset := int(order.Uint32(tiff[4:8]))
+	if offset+2 > len(tiff) {
+		return 1
+	}
+
+	count := int(order.Uint16(tiff[offset : offset+2]))
+	for i := 0; i < count; i++ {
+		entry := offset + 2 + i*12
+		if entry+12 > len(tiff) {
+			return 1
+		}
+
+		if order.Uint16(tiff[entry:entry+2]) == 0x0112 {
+			orientation := int(order.Uint16(tiff[entry+8 : entry+10]))
+			if orientation < 1 || orientation > 8 {
+				return 1
+			}
+			return orientation
+		}
+	}
+
+	return 1
+}
+
+// orientImage - Turn the image upright following the EXIF orientation
+func orientImage(img *image.RGBA, orientation int) *image.RGBA {
+	if orientation <= 1 || orientation > 8 {
+		return img
+	}
+
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+
+	// The orientations from 5 to 8 swap the sides
+	dstW, dstH := w, h
+	if orientation >= 5 {
+		dstW, dstH = h, w
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dstW, dstH))
+
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2:
+				dx, dy = w-1-x, y
+			case 3:
+				dx, dy = w-1-x, h-1-y
+			case 4:
+				dx, dy = x, h-1-y
+			case 5:
+				dx, dy = y, x
+			case 6:
+				dx, dy = h-1-y, x
+			case 7:
+				dx, dy = h-1-y, w-1-x
+			case 8:
+				dx, dy = y, w-1-x
+			}
+
+			copy(dst.Pix[dy*dst.Stride+dx*4:dy*dst.Stride+dx*4+4], img.Pix[y*img.Stride+x*4:y*img.Stride+x*4+4])
+		}
+	}
+
+	return dst
+}
@@ -0,0 +1,150 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+// The size of the blocks of the test image, large enough for the colors to survive the JPEG compression
+const orientationBlock = 16
+
+// The colors of the blocks of the test image, as stored, 2 rows of 3
+var orientationColors = map[byte]color.RGBA{
+	'a': {255, 0, 0, 255},
+	'b': {0, 255, 0, 255},
+	'c': {0, 0, 255, 255},
+	'd': {255, 255, 0, 255},
+	'e': {255, 0, 255, 255},
+	'f': {0, 255, 255, 255},
+}
+
+// orientationJPEG - The JPEG of the stored blocks, with an EXIF segment of the orientation in the byte order
+func orientationJPEG(t *testing.T, orientation int, order binary.ByteOrder) []byte {
+	stored := []string{"abc", "def"}
+	img := image.NewRGBA(image.Rect(0, 0, 3*orientationBlock, 2*orientationBlock))
+	for y := 0; y < img.Bounds().Dy(); y++ {
+		for x := 0; x < img.Bounds().Dx(); x++ {
+			img.SetRGBA(x, y, orientationColors[stored[y/orientationBlock][x/orientationBlock]])
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 100}); err != nil {
+		t.Fatalf("jpeg.Encode: %+v", err)
+	}
+
+	// The TIFF header, then an IFD with the orientation tag as its only entry
+	tiff := make([]byte, 8+2+12+4)
+	if order == binary.LittleEndian {
+		copy(tiff, "II")
+	} else {
+		copy(tiff, "MM")
+	}
+	order.PutUint16(tiff[2:], 42)
+	order.PutUint32(tiff[4:], 8)
+	order.PutUint16(tiff[8:], 1)
+	order.PutUint16(tiff[10:], 0x0112)
+	order.PutUint16(tiff[12:], 3) // SHORT
+	order.PutUint32(tiff[14:], 1)
+	order.PutUint16(tiff[18:], uint16(orientation))
+
+	segment := append([]byte("Exif\x00\x00"), tiff...)
+	app1 := []byte{0xFF, 0xE1, 0, 0}
+	binary.BigEndian.PutUint16(app1[2:], uint16(2+len(segment)))
+	app1 = append(app1, segment...)
+
+	// Right after the SOI marker
+	data := buf.Bytes()
+	return append(append(append([]byte{}, data[:2]...), app1...), data[2:]...)
+}
+
+func closeColor(got color.RGBA, want color.RGBA) bool {
+	near := func(a, b uint8) bool { return int(a)-int(b) < 64 && int(b)-int(a) < 64 }
+	return near(got.R, want.R) && near(got.G, want.G) && near(got.B, want.B)
+}
+
+func TestDecodeImageEXIFOrientation(t *testing.T) {
+	// How each orientation is seen once upright, row by row
+	upright := map[int][]string{
+		1: {"abc", "def"},
+		2: {"cba", "fed"},
+		3: {"fed", "cba"},
+		4: {"def", "abc"},
+		5: {"ad", "be", "cf"},
+		6: {"da", "eb", "fc"},
+		7: {"fc", "eb", "da"},
+		8: {"cf", "be", "ad"},
+	}
+
+	for _, order := range []binary.ByteOrder{binary.BigEndian, binary.LittleEndian} {
+		for orientation := 1; orientation <= 8; orientation++ {
+			data := orientationJPEG(t, orientation, order)
+
+			if got := jpegOrientation(data); got != orientation {
+				t.Errorf("jpegOrientation %v = %d, want %d", order, got, orientation)
+			}
+
+			img, err := DecodeImage(data)
+
+			if err != nil {
+				t.Fatalf("DecodeImage %d %v: %+v", orientation, order, err)
+			}
+
+			rows := upright[orientation]
+			wantW, wantH := len(rows[0])*orientationBlock, len(rows)*orientationBlock
+
+			if img.Bounds().Dx() != wantW || img.Bounds().Dy() != wantH {
+				t.Fatalf("DecodeImage %d %v is %dx%d, want %dx%d", orientation, order, img.Bounds().Dx(), img.Bounds().Dy(), wantW, wantH)
+			}
+
+			for r, row := range rows {
+				for col := range row {
+					x, y := col*orientationBlock+orientationBlock/2, r*orientationBlock+orientationBlock/2
+					if got := img.RGBAAt(x, y); !closeColor(got, orientationColors[row[col]]) {
+						t.Errorf("DecodeImage %d %v has %+v at block %d,%d, want the color of %c", orientation, order, got, r, col, row[col])
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestJPEGOrientationWithoutEXIF(t *testing.T) {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 8, 8)), nil); err != nil {
+		t.Fatalf("jpeg.Encode: %+v", err)
+	}
+
+	if got := jpegOrientation(buf.Bytes()); got != 1 {
+		t.Errorf("jpegOrientation without EXIF = %d, want 1", got)
+	}
+
+	// An orientation out of the range is ignored
+	if got := jpegOrientation(orientationJPEG(t, 9, binary.BigEndian)); got != 1 {
+		t.Errorf("jpegOrientation of 9 = %d, want 1", got)
+	}
+}
+
+func TestDecodeImageTooLarge(t *testing.T) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, 1, 1))); err != nil {
+		t.Fatalf("png.Encode: %+v", err)
+	}
+
+	// Claim more pixels in the IHDR chunk than can be decoded, the pixels themselves are never read
+	data := buf.Bytes()
+	ihdr := data[8+8 : 8+8+13]
+	binary.BigEndian.PutUint32(ihdr[0:], 5000)
+	binary.BigEndian.PutUint32(ihdr[4:], MaxImagePixels/5000+1)
+	binary.BigEndian.PutUint32(data[8+8+13:], crc32.ChecksumIEEE(data[8+4:8+8+13]))
+
+	if _, err := DecodeImage(data); err != ErrImageTooLarge {
+		t.Errorf("DecodeImage of %d pixels = %+v, want ErrImageTooLarge", 5000*(MaxImagePixels/5000+1), err)
+	}
+}
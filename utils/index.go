@@ -1,6 +1,10 @@
 package utils
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -8,6 +12,7 @@ import (
 	"quenc/models"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/dgrijalva/jwt-go"
 	"github.com/gin-gonic/gin"
@@ -16,6 +21,18 @@ import (
 
 )
 
+const (
+	// AccessTokenLifetime - How long a JWT can be used before refreshing
+	AccessTokenLifetime = 15 * time.Minute
+	// RefreshTokenLifetime - How long a refresh token can be used
+	RefreshTokenLifetime = 30 * 24 * time.Hour
+	// TwoFactorChallengeLifetime - How long the second step of the login can be done after the password
+	TwoFactorChallengeLifetime = 5 * time.Minute
+)
+
+// The purpose claim of the token between the two steps of the login
+const twoFactorChallengePurpose = "2fa-challenge"
+
 // SetupFindOptions - Setting up the FindOptions for the Query
 func SetupFindOptions(findOptions *options.FindOptions, c *gin.Context) error {
 
@@ -94,14 +111,19 @@ func GetOID(id string, c *gin.Context) *primitive.ObjectID {
 	return &oid
 }
 
-// GenerateAuthToken - Generate the Auth token for given id
-func GenerateAuthToken(id string) (interface{}, error) {
+// GenerateAuthToken - Generate the short-lived Auth token for given id and session (jti)
+// The mfa claim tells whether the session has passed the two-factor authentication
+func GenerateAuthToken(id string, jti string, twoFactor bool) (interface{}, error) {
 	/*
 		Method for generating the token
 	*/
+	now := time.Now()
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
 		"_id": id,
-		// "exp":   time.Now().Add(time.Hour * 2).Unix(),
+		"jti": jti,
+		"mfa": twoFactor,
+		"iat": now.Unix(),
+		"exp": now.Add(AccessTokenLifetime).Unix(),
 	})
 
 	authToken, err := token.SignedString([]byte(os.Getenv("JWT_SECRET")))
@@ -113,6 +135,134 @@ func GenerateAuthToken(id string) (interface{}, error) {
 	return authToken, nil
 }
 
+// GenerateTwoFactorChallengeToken - The token given after the password, exchanged for the Auth token with a TOTP code
+// It has no jti, so it can't be used as an Auth token
+func GenerateTwoFactorChallengeToken(id string) (string, error) {
+	now := time.Now()
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"_id":     id,
+		"purpose": twoFactorChallengePurpose,
+		"iat":     now.Unix(),
+		"exp":     now.Add(TwoFactorChallengeLifetime).Unix(),
+	})
+
+	return token.SignedString([]byte(os.Getenv("JWT_SECRET")))
+}
+
+// ParseTwoFactorChallengeToken - Return the user OID of a valid challenge token
+func ParseTwoFactorChallengeToken(tokenStr string) (*primitive.ObjectID, error) {
+	token, err := jwt.Parse(tokenStr, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("Invalid Token")
+		}
+
+		return []byte(os.Getenv("JWT_SECRET")), nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid || claims["purpose"] != twoFactorChallengePurpose {
+		return nil, fmt.Errorf("The token is not a challenge token")
+	}
+
+	id, _ := claims["_id"].(string)
+
+	oid, err := primitive.ObjectIDFromHex(id)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &oid, nil
+}
+
+// GenerateRandomToken - Generate a url-safe random token with n bytes of entropy
+func GenerateRandomToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// HashToken - Hash the token before saving it to MongoDB
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// GenerateRefreshToken - Generate and store a refresh token for the user
+// The family is the session the token belongs to
+func GenerateRefreshToken(uOID primitive.ObjectID, family primitive.ObjectID) (string, error) {
+	refreshToken, err := GenerateRandomToken(32)
+
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+
+	_, err = models.AddRefreshToken(&models.RefreshToken{
+		User:      uOID,
+		Family:    family,
+		TokenHash: HashToken(refreshToken),
+		Used:      false,
+		Revoked:   false,
+		ExpiresAt: now.Add(RefreshTokenLifetime),
+		CreatedAt: now,
+	})
+
+	if err != nil {
+		return "", err
+	}
+
+	return refreshToken, nil
+}
+
+// CreateSession - Create a new session for the device sending the request
+func CreateSession(uOID primitive.ObjectID, twoFactor bool, c *gin.Context) (*models.Session, error) {
+	now := time.Now()
+	session := models.Session{
+		User:       uOID,
+		TwoFactor:  twoFactor,
+		UserAgent:  c.Request.UserAgent(),
+		IP:         c.ClientIP(),
+		Revoked:    false,
+		LastUsedAt: now,
+		CreatedAt:  now,
+	}
+
+	InsertedID, err := models.AddSession(&session)
+
+	if err != nil {
+		return nil, err
+	}
+
+	session.ID = InsertedID.(primitive.ObjectID)
+
+	return &session, nil
+}
+
+// GenerateTokensForSession - Generate the Auth token and the refresh token for the session
+func GenerateTokensForSession(session *models.Session) (interface{}, string, error) {
+	authToken, err := GenerateAuthToken(session.User.Hex(), session.ID.Hex(), session.TwoFactor)
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	refreshToken, err := GenerateRefreshToken(session.User, session.ID)
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	return authToken, refreshToken, nil
+}
+
 // GetUserFromContext - Return User Object
 func GetUserFromContext(c *gin.Context) *models.User {
 	var user *models.User
@@ -131,12 +281,53 @@ func GetUserFromContext(c *gin.Context) *models.User {
 	return user
 }
 
+// GetOptionalUserFromContext - Return the User if the request has a token, nil for the guests
+func GetOptionalUserFromContext(c *gin.Context) *models.User {
+	user, ok := c.Get("user")
+
+	if !ok {
+		return nil
+	}
+
+	return user.(*models.User)
+}
+
+// GetSessionFromContext - Return the Session of the token
+func GetSessionFromContext(c *gin.Context) *models.Session {
+	sessionStr, ok := c.Get("session")
+
+	if !ok {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"err": "Cannot retrieve the session after token authorization",
+			"msg": "Cannot retrieve the session after token authorization",
+		})
+		return nil
+	}
+
+	return sessionStr.(*models.Session)
+}
+
+// HasPermissionInCategory - Whether the user in the context has the permission for the content in the category
+// A nil category means the content has no category, so only the permission everywhere counts
+// The moderation permissions only count when the token passed the two-factor authentication
+func HasPermissionInCategory(c *gin.Context, user *models.User, permission string, cOID *primitive.ObjectID) bool {
+	if models.IsModerationPermission(permission) && !c.GetBool("twoFactor") {
+		return false
+	}
+
+	if cOID == nil {
+		return user.HasPermission(permission)
+	}
+
+	return user.HasPermissionInCategory(permission, *cOID)
+}
+
 func GetDomainFromEmail(email string) string {
 	emailParts := strings.Split(email, "@")
-	if len(emailParts) > 2 {
+	if len(emailParts) != 2 {
 		return ""
 	}
-	return emailParts[1]
+	return strings.ToLower(emailParts[1])
 }
 
 func GetSkipLimitSortFromContext(c *gin.Context) (*int, *int, *string, error) {
@@ -189,34 +380,77 @@ func GetSkipLimitSortFromContext(c *gin.Context) (*int, *int, *string, error) {
 	return &skip, &limit, sort, nil
 }
 
+// GetPageQueryFromContext - The ?cursor= given as the nextCursor of the previous page, with ?limit= and the old ?skip=
+func GetPageQueryFromContext(c *gin.Context) (*models.PageQuery, error) {
+	page := models.PageQuery{}
+
+	for param, value := range map[string]*int{"skip": &page.Skip, "limit": &page.Limit} {
+		str := strings.TrimSpace(c.Query(param))
+		if str == "" {
+			continue
+		}
+
+		n, err := strconv.Atoi(str)
+		if err != nil {
+			errStr := fmt.Sprintf("Cannot convert the given %s: %+v", param, err)
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"err": errStr,
+				"msg": fmt.Sprintf("Cannot convert the given %s", param),
+			})
+			return nil, err
+		}
+		*value = n
+	}
+
+	if token := strings.TrimSpace(c.Query("cursor")); token != "" {
+		cursor, err := models.DecodeCursor(token)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"err":    err.Error(),
+				"msg":    "The cursor is not valid",
+				"cursor": token,
+			})
+			return nil, err
+		}
+		page.Cursor = cursor
+	}
+
+	return &page, nil
+}
+
+// AbortIfInvalidCursor - Answer with a 400 when the cursor was given by a listing with another sort
+func AbortIfInvalidCursor(c *gin.Context, err error) bool {
+	if err != models.ErrInvalidCursor {
+		return false
+	}
+
+	c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+		"err": err.Error(),
+		"msg": "The cursor is not valid for this sort",
+	})
+	return true
+}
+
+// GetDisplayNameFromDomain - Return the name of the University in the registry
 func GetDisplayNameFromDomain(domain string) string {
-	var uni string
+	uni, err := models.FindUniversityByDomain(domain)
 
-	switch domain {
-	case "qut.edu.au":
-		uni = "昆士蘭理工"
-		break
-	case "uq.edu.au":
-		uni = "昆士蘭大學"
-		break
-	case "griffith.edu.au":
-		uni = "格里菲斯"
-		break
-	default:
-		uni = "UNKNOWN"
+	if err != nil || uni == nil {
+		return "UNKNOWN"
 	}
 
-	return uni
+	return uni.DisplayName(models.DefaultUniversityLanguage)
 }
 
+// CheckDomainValid - Checking if the domain belongs to an enabled University in the registry
 func CheckDomainValid(domain string) bool {
-	unis := []string{"qut.edu.au", "uq.edu.au", "griffith.edu.au"}
-	for _, u := range unis {
-		if u == domain {
-			return true
-		}
+	uni, err := models.FindUniversityByDomain(domain)
+
+	if err != nil || uni == nil {
+		return false
 	}
-	return false
+
+	return uni.Enabled
 }
 
 func StructToMap(inputStruct interface{}) (map[string]interface{}, error) {
@@ -0,0 +1,161 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"quenc/models"
+	"strings"
+	"time"
+)
+
+// TOTP parameters (RFC 6238), the defaults of the authenticator apps
+const (
+	TOTPPeriod = 30 * time.Second
+	TOTPDigits = 6
+	TOTPSkew   = 1 // codes of the previous and next periods are accepted for clock drift
+	TOTPIssuer = "QuenC"
+)
+
+// RecoveryCodeCount - How many recovery codes are generated at once
+const RecoveryCodeCount = 10
+
+// TOTPNow - The clock of the TOTP, replaced by a fake one to test offline
+var TOTPNow = time.Now
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateTOTPSecret - A random 160 bits secret in base32, as the authenticator apps expect
+func GenerateTOTPSecret() (string, error) {
+	b := make([]byte, 20)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return totpEncoding.EncodeToString(b), nil
+}
+
+// TOTPAuthURI - The otpauth:// URI shown as a QR code for the authenticator apps
+func TOTPAuthURI(secret string, account string) string {
+	params := url.Values{}
+	params.Set("secret", secret)
+	params.Set("issuer", TOTPIssuer)
+	params.Set("algorithm", "SHA1")
+	params.Set("digits", fmt.Sprint(TOTPDigits))
+	params.Set("period", fmt.Sprint(int(TOTPPeriod.Seconds())))
+
+	label := url.PathEscape(TOTPIssuer + ":" + account)
+
+	return "otpauth://totp/" + label + "?" + params.Encode()
+}
+
+// TOTPCounter - The period number of the given time
+func TOTPCounter(t time.Time) int64 {
+	return t.Unix() / int64(TOTPPeriod.Seconds())
+}
+
+// TOTPCode - The code of the secret for the given period number
+func TOTPCode(secret string, counter int64) (string, error) {
+	key, err := totpEncoding.DecodeString(strings.ToUpper(strings.TrimSpace(secret)))
+
+	if err != nil {
+		return "", err
+	}
+
+	msg := make([]byte, 8)
+	binary.BigEndian.PutUint64(msg, uint64(counter))
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg)
+	sum := mac.Sum(nil)
+
+	// Dynamic truncation (RFC 4226)
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	mod := uint32(1)
+	for i := 0; i < TOTPDigits; i++ {
+		mod *= 10
+	}
+
+	return fmt.Sprintf("%0*d", TOTPDigits, value%mod), nil
+}
+
+// ValidateTOTP - Check the code against the current time, the matched period number is returned
+// The caller has to reject period numbers which have been used, so a code can't be replayed
+func ValidateTOTP(secret string, code string) (int64, bool) {
+	code = strings.TrimSpace(code)
+
+	if len(code) != TOTPDigits {
+		return 0, false
+	}
+
+	now := TOTPCounter(TOTPNow())
+
+	for i := -TOTPSkew; i <= TOTPSkew; i++ {
+		expected, err := TOTPCode(secret, now+int64(i))
+
+		if err != nil {
+			return 0, false
+		}
+
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return now + int64(i), true
+		}
+	}
+
+	return 0, false
+}
+
+// ValidateTwoFactorCode - ValidateTOTP for the secret of the User, the periods up to its last used one are rejected
+// The caller still has to store the period atomically, see models.UseTwoFactorCounter
+func ValidateTwoFactorCode(user *models.User, code string) (int64, bool) {
+	counter, ok := ValidateTOTP(user.TwoFactorSecret, code)
+
+	if !ok || counter <= user.TwoFactorLastCounter {
+		return 0, false
+	}
+
+	return counter, true
+}
+
+// GenerateRecoveryCodes - Generate the one-time recovery codes, e.g. "3f9a1-c07d2"
+func GenerateRecoveryCodes() ([]string, error) {
+	codes := make([]string, RecoveryCodeCount)
+
+	for i := range codes {
+		b := make([]byte, 5)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+		h := hex.EncodeToString(b)
+		codes[i] = h[:5] + "-" + h[5:]
+	}
+
+	return codes, nil
+}
+
+// HashRecoveryCode - The hash stored for a recovery code, the dash and the case don't matter
+func HashRecoveryCode(code string) string {
+	return HashToken(strings.ToLower(strings.Replace(strings.TrimSpace(code), "-", "", -1)))
+}
+
+// UseRecoveryCodeHash - The recovery code hashes left after using the code, false if it isn't one of them
+// The caller still has to remove it atomically, see models.UseRecoveryCode
+func UseRecoveryCodeHash(hashes []string, code string) ([]string, bool) {
+	hash := HashRecoveryCode(code)
+
+	for i, h := range hashes {
+		if subtle.ConstantTimeCompare([]byte(h), []byte(hash)) == 1 {
+			left := append([]string{}, hashes[:i]...)
+			return append(left, hashes[i+1:]...), true
+		}
+	}
+
+	return hashes, false
+}
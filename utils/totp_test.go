@@ -0,0 +1,160 @@
+package utils
+
+import (
+	"quenc/models"
+	"strings"
+	"testing"
+	"time"
+)
+
+// The secret of the RFC 6238 vectors, "12345678901234567890" in base32
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+// pinTOTPNow - Pin the clock of the TOTP to the time, the returned func restores it
+func pinTOTPNow(now time.Time) func() {
+	previous := TOTPNow
+	TOTPNow = func() time.Time { return now }
+	return func() { TOTPNow = previous }
+}
+
+func TestTOTPCodeRFC6238(t *testing.T) {
+	// The SHA-1 vectors of the RFC, cut to the last TOTPDigits digits
+	vectors := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+
+	for _, v := range vectors {
+		code, err := TOTPCode(rfcSecret, TOTPCounter(time.Unix(v.unix, 0)))
+
+		if err != nil {
+			t.Fatalf("TOTPCode at %d: %+v", v.unix, err)
+		}
+
+		if code != v.code {
+			t.Errorf("TOTPCode at %d = %s, want %s", v.unix, code, v.code)
+		}
+	}
+}
+
+func TestValidateTOTPSkew(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+	defer pinTOTPNow(now)()
+
+	current := TOTPCounter(now)
+
+	for step := int64(-TOTPSkew - 1); step <= TOTPSkew+1; step++ {
+		code, err := TOTPCode(rfcSecret, current+step)
+
+		if err != nil {
+			t.Fatalf("TOTPCode: %+v", err)
+		}
+
+		counter, ok := ValidateTOTP(rfcSecret, code)
+		accepted := step >= -TOTPSkew && step <= TOTPSkew
+
+		if ok != accepted {
+			t.Errorf("ValidateTOTP %d steps away = %v, want %v", step, ok, accepted)
+		}
+
+		if ok && counter != current+step {
+			t.Errorf("ValidateTOTP %d steps away returned the counter %d, want %d", step, counter, current+step)
+		}
+	}
+
+	if _, ok := ValidateTOTP(rfcSecret, "not a code"); ok {
+		t.Error("ValidateTOTP accepted a malformed code")
+	}
+}
+
+func TestValidateTwoFactorCodeReplay(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+	defer pinTOTPNow(now)()
+
+	user := &models.User{TwoFactorSecret: rfcSecret}
+	current := TOTPCounter(now)
+
+	code, err := TOTPCode(rfcSecret, current)
+
+	if err != nil {
+		t.Fatalf("TOTPCode: %+v", err)
+	}
+
+	counter, ok := ValidateTwoFactorCode(user, code)
+
+	if !ok || counter != current {
+		t.Fatalf("ValidateTwoFactorCode = %d, %v, want %d, true", counter, ok, current)
+	}
+
+	// What models.UseTwoFactorCounter stores once the code is used
+	user.TwoFactorLastCounter = counter
+
+	if _, ok := ValidateTwoFactorCode(user, code); ok {
+		t.Error("ValidateTwoFactorCode accepted the code again")
+	}
+
+	previous, err := TOTPCode(rfcSecret, current-1)
+
+	if err != nil {
+		t.Fatalf("TOTPCode: %+v", err)
+	}
+
+	if _, ok := ValidateTwoFactorCode(user, previous); ok {
+		t.Error("ValidateTwoFactorCode accepted a code older than the last used one")
+	}
+
+	next, err := TOTPCode(rfcSecret, current+1)
+
+	if err != nil {
+		t.Fatalf("TOTPCode: %+v", err)
+	}
+
+	if _, ok := ValidateTwoFactorCode(user, next); !ok {
+		t.Error("ValidateTwoFactorCode rejected a code newer than the last used one")
+	}
+}
+
+func TestUseRecoveryCodeHashOnce(t *testing.T) {
+	codes, err := GenerateRecoveryCodes()
+
+	if err != nil {
+		t.Fatalf("GenerateRecoveryCodes: %+v", err)
+	}
+
+	hashes := []string{}
+	for _, code := range codes {
+		hashes = append(hashes, HashRecoveryCode(code))
+	}
+
+	left, ok := UseRecoveryCodeHash(hashes, codes[0])
+
+	if !ok || len(left) != len(hashes)-1 {
+		t.Fatalf("UseRecoveryCodeHash = %d hashes, %v, want %d, true", len(left), ok, len(hashes)-1)
+	}
+
+	if hashes[0] != HashRecoveryCode(codes[0]) {
+		t.Error("UseRecoveryCodeHash changed the hashes it was given")
+	}
+
+	if _, ok := UseRecoveryCodeHash(left, codes[0]); ok {
+		t.Error("UseRecoveryCodeHash accepted a used code again")
+	}
+
+	// The code is matched whatever the case, and with or without the dash
+	typed := strings.ToUpper(strings.Replace(codes[1], "-", "", -1))
+
+	if _, ok := UseRecoveryCodeHash(left, typed); !ok {
+		t.Errorf("UseRecoveryCodeHash rejected %s typed as %s", codes[1], typed)
+	}
+
+	if _, ok := UseRecoveryCodeHash(left, "00000-00000"); ok {
+		t.Error("UseRecoveryCodeHash accepted an unknown code")
+	}
+}